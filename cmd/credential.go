@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/crypto"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+)
+
+// Credential helpers talk to git/docker over stdin/stdout, so every prompt
+// needed to unlock the vault has to go through the controlling terminal.
+// Where there is none (CI jobs, docker builds), the master password can be
+// supplied in vaultPasswordEnv instead.
+
+// vaultPasswordEnv names the environment variable the credential helpers
+// read the master password from instead of prompting.
+const vaultPasswordEnv = "KYLRIX_VAULT_PASSWORD"
+
+// unlockForHelper obtains the MEK from vaultPasswordEnv, checked against the
+// vault, or else on the controlling terminal.
+func unlockForHelper(database *sql.DB) (*crypto.SecureBuffer, error) {
+	if password, ok := os.LookupEnv(vaultPasswordEnv); ok {
+		key := deriveMasterKey(password)
+		if err := verifyMEK(database, key.Bytes()); err != nil {
+			key.Destroy()
+			return nil, fmt.Errorf("%s: %w", vaultPasswordEnv, err)
+		}
+		return key, nil
+	}
+
+	restore, err := utils.AttachTTY()
+	if err != nil {
+		return nil, fmt.Errorf("vault is locked and %v to unlock it (or set %s)", err, vaultPasswordEnv)
+	}
+	defer restore()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return getMEK(cfg)
+}
+
+// loadCredential decrypts the credential stored under name. found is false
+// (without prompting for an unlock) when no such entry exists.
+func loadCredential(database *sql.DB, name string) (cred map[string]string, found bool, err error) {
+	var payload string
+	err = database.QueryRow("SELECT payload FROM vault_secrets WHERE name = ?", name).Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	key, err := unlockForHelper(database)
+	if err != nil {
+		return nil, true, err
+	}
+	defer key.Destroy()
+
+	cred, err = decryptCredential(name, payload, key.Bytes())
+	return cred, true, err
+}
+
+// decryptCredential decrypts a credential payload into its string fields.
+func decryptCredential(name, payload string, key []byte) (map[string]string, error) {
+	plaintext, err := crypto.Decrypt(payload, key)
+	if err != nil {
+		return nil, err
+	}
+	defer plaintext.Destroy()
+
+	var fields map[string]interface{}
+	if err := plaintext.Unmarshal(&fields); err != nil || fields == nil {
+		return nil, fmt.Errorf("secret '%s' is not a credential", name)
+	}
+	cred := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			cred[k] = s
+		}
+	}
+	return cred, nil
+}
+
+// storeCredential encrypts cred and saves it under name, replacing any previous entry.
+func storeCredential(database *sql.DB, name string, cred map[string]string) error {
+	key, err := unlockForHelper(database)
+	if err != nil {
+		return err
+	}
+	defer key.Destroy()
+
+	encrypted, err := crypto.Encrypt(cred, key.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Exec("INSERT OR REPLACE INTO vault_secrets (name, payload) VALUES (?, ?)", name, encrypted)
+	return err
+}
+
+// eraseCredential removes the entry stored under name. It never needs the MEK.
+func eraseCredential(database *sql.DB, name string) (bool, error) {
+	res, err := database.Exec("DELETE FROM vault_secrets WHERE name = ?", name)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
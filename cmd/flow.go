@@ -2,11 +2,35 @@ package cmd
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/flow"
+	"github.com/nathfavour/kylrix/cli/pkg/recur"
 	"github.com/nathfavour/kylrix/cli/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
+var (
+	taskTitle    string
+	taskStatus   string
+	taskPriority string
+	taskDue      string
+	taskProject  string
+	taskTags     []string
+	taskUntags   []string
+	taskEvery    string
+	taskParent   string
+	taskBlockers []string
+	taskUnblock  []string
+	allTasks     bool
+	treeTasks    bool
+	forceTask    bool
+	nextLimit    int
+)
+
 var flowCmd = &cobra.Command{
 	Use:   "flow",
 	Short: "Manage Kylrix Flow productivity tasks",
@@ -15,30 +39,476 @@ var flowCmd = &cobra.Command{
 	},
 }
 
+// withTask opens the database, resolves ref (an ID, ID prefix or title) and
+// runs fn in a transaction, so a command's changes are written together.
+func withTask(ref string, fn func(q db.Querier, t *flow.Task) error) error {
+	database, err := db.InitDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t, err := flow.Get(tx, ref)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// dueCell shows a due date, highlighted when it has passed and marked when the
+// task repeats.
+func dueCell(t *flow.Task, now time.Time) string {
+	due := t.Due
+	if t.Overdue(now) {
+		due = utils.Alert(due)
+	}
+	if t.Recur != "" {
+		due = strings.TrimSpace(due + " ↻")
+	}
+	return due
+}
+
+// parseEvery reads an --every value into an RRULE ("" for none).
+func parseEvery(s string) (string, error) {
+	if s == "" || s == "none" {
+		return "", nil
+	}
+	rule, err := recur.Parse(s, time.Local)
+	if err != nil {
+		return "", err
+	}
+	return rule.String(), nil
+}
+
+// statusCell shows a task's status, noting when it waits on other tasks.
+func statusCell(t *flow.Task) string {
+	if t.Waiting > 0 && t.Status != flow.Done {
+		return t.Status + " (waiting)"
+	}
+	return t.Status
+}
+
+// addBlockers makes t wait on each of the referenced tasks.
+func addBlockers(q db.Querier, t *flow.Task, refs []string) error {
+	for _, ref := range refs {
+		blocker, err := flow.Get(q, ref)
+		if err != nil {
+			return err
+		}
+		if err := flow.AddBlocker(q, t.ID, blocker.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// completeTask marks t done and reports the next instance of a recurring task.
+// Open subtasks are completed with it only with --force.
+func completeTask(q db.Querier, t *flow.Task) error {
+	next, err := flow.Complete(q, t, time.Now(), forceTask)
+	if open, ok := err.(*flow.OpenSubtasksError); ok {
+		return fmt.Errorf("task %s has %d open subtasks; finish them first or use --force", t.UID, open.Open)
+	}
+	if err != nil {
+		return err
+	}
+	utils.Success(fmt.Sprintf("Task %s done: %s", t.UID, t.Title))
+	if next != nil {
+		utils.Info(fmt.Sprintf("Next occurrence %s is due %s.", next.UID, next.Due))
+	}
+	return nil
+}
+
+// dueBy turns a --due filter (overdue, today, week or a date) into a deadline.
+func dueBy(s string, now time.Time) (time.Time, error) {
+	switch strings.ToLower(s) {
+	case "overdue":
+		return now, nil
+	case "week":
+		s = now.AddDate(0, 0, 7).Format(flow.DateLayout)
+	}
+	due, err := flow.ParseDue(s, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	at, _ := flow.DueTime(due, now.Location())
+	return at, nil
+}
+
 var flowTasksCmd = &cobra.Command{
 	Use:   "tasks",
 	Short: "List tasks",
-	Run: func(cmd *cobra.Command, args []string) {
+	Long: `List open tasks, those in progress first, then by due date and priority.
+Done tasks are shown with --all or --status done.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		f := flow.Filter{Project: taskProject, Tags: taskTags, AllStatus: allTasks}
+		if taskStatus != "" {
+			for _, s := range strings.Split(taskStatus, ",") {
+				status, err := flow.ParseStatus(s)
+				if err != nil {
+					return err
+				}
+				f.Statuses = append(f.Statuses, status)
+			}
+		}
+		if taskDue != "" {
+			var err error
+			if f.DueBy, err = dueBy(taskDue, now); err != nil {
+				return err
+			}
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		list, err := flow.List(database, f)
+		if err != nil {
+			return err
+		}
+
 		utils.Banner("Kylrix Flow - Tasks")
-		tasks := []string{"[ ] Review PR #123", "[x] Implement CLI foundations", "[ ] Update AGENTS.md"}
-		for _, t := range tasks {
-			fmt.Printf("- %s\n", t)
+		if len(list) == 0 {
+			utils.Info("No tasks found. Add one with: kylrix flow add <title>")
+			return nil
+		}
+		var data [][]string
+		row := func(t *flow.Task, title string) {
+			data = append(data, []string{t.UID, statusCell(t), flow.PriorityName(t.Priority), title,
+				t.Project, dueCell(t, now), strings.Join(t.Tags, ", ")})
+		}
+		if treeTasks {
+			for _, n := range flow.Tree(list) {
+				row(n.Task, n.Prefix+n.Task.Title)
+			}
+		} else {
+			for i := range list {
+				row(&list[i], list[i].Title)
+			}
 		}
+		utils.Table([]string{"ID", "STATUS", "PRIORITY", "TITLE", "PROJECT", "DUE", "TAGS"}, data)
+		return nil
 	},
 }
 
-var flowSyncCmd = &cobra.Command{
-	Use:   "sync",
-	Short: "Sync flow data with backend",
-	Run: func(cmd *cobra.Command, args []string) {
-		utils.Banner("Kylrix Flow - Sync")
-		utils.Info("Synchronizing tasks and calendars...")
-		utils.Success("Synchronization complete.")
+var flowAddCmd = &cobra.Command{
+	Use:   "add [title]",
+	Short: "Add a task",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t := flow.Task{Title: strings.Join(args, " "), Status: flow.Todo, Project: taskProject, Tags: taskTags}
+		var err error
+		if taskStatus != "" {
+			if t.Status, err = flow.ParseStatus(taskStatus); err != nil {
+				return err
+			}
+		}
+		if taskPriority != "" {
+			if t.Priority, err = flow.ParsePriority(taskPriority); err != nil {
+				return err
+			}
+		}
+		if taskDue != "" {
+			if t.Due, err = flow.ParseDue(taskDue, time.Now()); err != nil {
+				return err
+			}
+		}
+		if t.Recur, err = parseEvery(taskEvery); err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		// A bad --parent or --blocked-by must not leave the task half added.
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if taskParent != "" {
+			parent, err := flow.Get(tx, taskParent)
+			if err != nil {
+				return err
+			}
+			t.ParentID = parent.ID
+			// Subtasks belong to their parent's project unless told otherwise.
+			if !cmd.Flags().Changed("project") {
+				t.Project = parent.Project
+			}
+		}
+		created, err := flow.Create(tx, t)
+		if err != nil {
+			return err
+		}
+		if err := addBlockers(tx, created, taskBlockers); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		utils.Success(fmt.Sprintf("Task %s added: %s", created.UID, created.Title))
+		if created.Due != "" {
+			utils.Info(fmt.Sprintf("Due %s.", created.Due))
+		}
+		return nil
+	},
+}
+
+var flowDoneCmd = &cobra.Command{
+	Use:   "done [id|title...]",
+	Short: "Mark tasks as done",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, ref := range args {
+			err := withTask(ref, func(q db.Querier, t *flow.Task) error {
+				if t.Status == flow.Done {
+					utils.Info(fmt.Sprintf("Task %s is already done.", t.UID))
+					return nil
+				}
+				return completeTask(q, t)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var flowEditCmd = &cobra.Command{
+	Use:   "edit [id|title]",
+	Short: "Change a task",
+	Long: `Change the fields given as flags. --due none, --every none, --parent none
+and --project "" clear the due date, recurrence, parent and project.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withTask(args[0], func(q db.Querier, t *flow.Task) error {
+			flags := cmd.Flags()
+			var err error
+			if flags.Changed("title") {
+				if t.Title = strings.TrimSpace(taskTitle); t.Title == "" {
+					return fmt.Errorf("title cannot be empty")
+				}
+			}
+			wasDone := t.Status == flow.Done
+			if flags.Changed("status") {
+				if t.Status, err = flow.ParseStatus(taskStatus); err != nil {
+					return err
+				}
+			}
+			if flags.Changed("priority") {
+				if t.Priority, err = flow.ParsePriority(taskPriority); err != nil {
+					return err
+				}
+			}
+			if flags.Changed("due") {
+				t.Due = ""
+				if taskDue != "" && taskDue != "none" {
+					if t.Due, err = flow.ParseDue(taskDue, time.Now()); err != nil {
+						return err
+					}
+				}
+			}
+			if flags.Changed("project") {
+				t.Project = taskProject
+			}
+			if flags.Changed("every") {
+				if t.Recur, err = parseEvery(taskEvery); err != nil {
+					return err
+				}
+			}
+			if err := flow.AddTags(q, t.ID, taskTags...); err != nil {
+				return err
+			}
+			if err := flow.RemoveTags(q, t.ID, taskUntags...); err != nil {
+				return err
+			}
+			if flags.Changed("parent") {
+				var parentID int64
+				if taskParent != "" && taskParent != "none" {
+					parent, err := flow.Get(q, taskParent)
+					if err != nil {
+						return err
+					}
+					parentID = parent.ID
+				}
+				if err := flow.SetParent(q, t.ID, parentID); err != nil {
+					return err
+				}
+			}
+			if err := addBlockers(q, t, taskBlockers); err != nil {
+				return err
+			}
+			for _, ref := range taskUnblock {
+				blocker, err := flow.Get(q, ref)
+				if err != nil {
+					return err
+				}
+				if err := flow.RemoveBlocker(q, t.ID, blocker.ID); err != nil {
+					return err
+				}
+			}
+			if t.Status == flow.Done && !wasDone {
+				return completeTask(q, t)
+			}
+			if err := flow.Update(q, t); err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Task %s saved.", t.UID))
+			return nil
+		})
+	},
+}
+
+var flowRmCmd = &cobra.Command{
+	Use:     "rm [id|title]",
+	Aliases: []string{"delete"},
+	Short:   "Delete a task",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withTask(args[0], func(q db.Querier, t *flow.Task) error {
+			prompt := fmt.Sprintf("Delete task '%s' (%s)", t.Title, t.UID)
+			subtasks, err := flow.Subtasks(q, t.ID)
+			if err != nil {
+				return err
+			}
+			if len(subtasks) > 0 {
+				prompt += fmt.Sprintf(" and its %d subtasks", len(subtasks))
+			}
+			if !forceTask && !utils.Confirm(prompt) {
+				utils.Info("Aborted.")
+				return nil
+			}
+			if err := flow.Delete(q, t.ID); err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Task %s deleted.", t.UID))
+			return nil
+		})
+	},
+}
+
+var flowNextCmd = &cobra.Command{
+	Use:   "next",
+	Short: "Show what to work on next",
+	Long: `Show the open tasks that can be started now, highest priority first: those
+not blocked, not waiting on other tasks and without open subtasks.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		list, err := flow.Next(database, nextLimit)
+		if err != nil {
+			return err
+		}
+
+		utils.Banner("Kylrix Flow - Next")
+		if len(list) == 0 {
+			utils.Info("Nothing to start right now.")
+			return nil
+		}
+		now := time.Now()
+		var data [][]string
+		for i := range list {
+			t := &list[i]
+			data = append(data, []string{t.UID, t.Status, flow.PriorityName(t.Priority), t.Title, t.Project, dueCell(t, now)})
+		}
+		utils.Table([]string{"ID", "STATUS", "PRIORITY", "TITLE", "PROJECT", "DUE"}, data)
+		return nil
+	},
+}
+
+var flowProjectsCmd = &cobra.Command{
+	Use:   "projects",
+	Short: "List projects with their task counts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		projects, err := flow.Projects(database)
+		if err != nil {
+			return err
+		}
+
+		utils.Banner("Kylrix Flow - Projects")
+		if len(projects) == 0 {
+			utils.Info("No projects yet. File a task with: kylrix flow add <title> --project <name>")
+			return nil
+		}
+		var data [][]string
+		for _, p := range projects {
+			data = append(data, []string{p.Name, strconv.Itoa(p.Open), strconv.Itoa(p.Done), p.NextDue})
+		}
+		utils.Table([]string{"PROJECT", "OPEN", "DONE", "NEXT DUE"}, data)
+		return nil
 	},
 }
 
 func init() {
+	flowTasksCmd.Flags().StringVar(&taskStatus, "status", "", "Only tasks with these statuses (comma-separated: todo, doing, blocked, done)")
+	flowTasksCmd.Flags().StringVar(&taskProject, "project", "", "Only tasks in this project")
+	flowTasksCmd.Flags().StringSliceVar(&taskTags, "tag", nil, "Only tasks with this tag (repeatable, all must match)")
+	flowTasksCmd.Flags().StringVar(&taskDue, "due", "", "Only tasks due by: overdue, today, tomorrow, week or a date")
+	flowTasksCmd.Flags().BoolVarP(&allTasks, "all", "a", false, "Include done tasks")
+	flowTasksCmd.Flags().BoolVar(&treeTasks, "tree", false, "Show subtasks under their parents")
+
+	flowAddCmd.Flags().StringVarP(&taskPriority, "priority", "p", "", "Priority: none (default), low, medium or high")
+	flowAddCmd.Flags().StringVarP(&taskDue, "due", "d", "", "Due date, e.g. tomorrow, \"next friday 5pm\", \"in 2 weeks\" or 2026-03-10")
+	flowAddCmd.Flags().StringVar(&taskEvery, "every", "", "Repeat when done: daily, 2w, weekdays, mon,fri, \"2nd tue\", 15th or an RRULE")
+	flowAddCmd.Flags().StringVarP(&taskProject, "project", "P", "", "File the task into a project")
+	flowAddCmd.Flags().StringSliceVarP(&taskTags, "tag", "t", nil, "Tag the task (repeatable)")
+	flowAddCmd.Flags().StringVar(&taskStatus, "status", "", "Initial status (default todo)")
+	flowAddCmd.Flags().StringVar(&taskParent, "parent", "", "Add as a subtask of this task")
+	flowAddCmd.Flags().StringSliceVar(&taskBlockers, "blocked-by", nil, "Wait for this task to be done (repeatable)")
+
+	flowDoneCmd.Flags().BoolVarP(&forceTask, "force", "f", false, "Also complete open subtasks")
+
+	flowEditCmd.Flags().StringVar(&taskTitle, "title", "", "Rename the task")
+	flowEditCmd.Flags().StringVar(&taskStatus, "status", "", "Set the status: todo, doing, blocked or done")
+	flowEditCmd.Flags().StringVarP(&taskPriority, "priority", "p", "", "Set the priority: none, low, medium or high")
+	flowEditCmd.Flags().StringVarP(&taskDue, "due", "d", "", "Set the due date ('none' clears it)")
+	flowEditCmd.Flags().StringVar(&taskEvery, "every", "", "Set the recurrence ('none' stops it)")
+	flowEditCmd.Flags().StringVarP(&taskProject, "project", "P", "", "Move the task to a project (\"\" removes it)")
+	flowEditCmd.Flags().StringSliceVarP(&taskTags, "tag", "t", nil, "Add a tag (repeatable)")
+	flowEditCmd.Flags().StringSliceVar(&taskUntags, "untag", nil, "Remove a tag (repeatable)")
+	flowEditCmd.Flags().StringVar(&taskParent, "parent", "", "Make the task a subtask of another ('none' detaches it)")
+	flowEditCmd.Flags().StringSliceVar(&taskBlockers, "blocked-by", nil, "Wait for this task to be done (repeatable)")
+	flowEditCmd.Flags().StringSliceVar(&taskUnblock, "unblock", nil, "Stop waiting for this task (repeatable)")
+	flowEditCmd.Flags().BoolVarP(&forceTask, "force", "f", false, "Also complete open subtasks when setting status done")
+
+	flowRmCmd.Flags().BoolVarP(&forceTask, "force", "f", false, "Delete without confirmation")
+
+	flowNextCmd.Flags().IntVarP(&nextLimit, "limit", "n", 5, "How many tasks to show")
+
 	flowCmd.AddCommand(flowTasksCmd)
-	flowCmd.AddCommand(flowSyncCmd)
+	flowCmd.AddCommand(flowAddCmd)
+	flowCmd.AddCommand(flowDoneCmd)
+	flowCmd.AddCommand(flowEditCmd)
+	flowCmd.AddCommand(flowRmCmd)
+	flowCmd.AddCommand(flowNextCmd)
+	flowCmd.AddCommand(flowProjectsCmd)
 	rootCmd.AddCommand(flowCmd)
 }
@@ -0,0 +1,610 @@
+package cmd
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/flow"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var boardProject string
+
+// Terminal control sequences used by the board.
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l" // alternate screen, hidden cursor
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	cursorHome  = "\x1b[H"
+	clearLine   = "\x1b[K"
+	clearBelow  = "\x1b[J"
+	styleReset  = "\x1b[0m"
+	styleBold   = "\x1b[1m"
+	styleDim    = "\x1b[2m"
+	styleRev    = "\x1b[7m"
+	styleRed    = "\x1b[31m"
+)
+
+const boardHelp = "←→↑↓/hjkl select  H/L or </> move  1-4 to column  e edit  d due  +/- priority  a add  [/] project  r reload  q quit"
+
+// cardText is the one-line summary of a task on the board.
+func cardText(t *flow.Task) string {
+	var b strings.Builder
+	if t.ParentID != 0 {
+		b.WriteString("↳ ")
+	}
+	if t.Priority > 0 {
+		b.WriteString(strings.Repeat("!", t.Priority) + " ")
+	}
+	b.WriteString(t.Title)
+	if t.Waiting > 0 {
+		b.WriteString(" (waiting)")
+	}
+	if t.Due != "" && t.Status != flow.Done {
+		b.WriteString(" · " + t.Due)
+	}
+	return b.String()
+}
+
+func projectName(name string) string {
+	if name == "" {
+		return "(no project)"
+	}
+	return name
+}
+
+// printBoards writes the boards as tables, for output that is not a terminal.
+func printBoards(boards []flow.Board) {
+	utils.Banner("Kylrix Flow - Board")
+	for i, b := range boards {
+		if i > 0 {
+			fmt.Println()
+		}
+		header := make([]string, len(flow.Statuses))
+		counts := make([]string, len(flow.Statuses))
+		rows := 0
+		for c, status := range flow.Statuses {
+			header[c] = strings.ToUpper(status)
+			counts[c] = fmt.Sprintf("%d %s", len(b.Columns[c]), status)
+			if len(b.Columns[c]) > rows {
+				rows = len(b.Columns[c])
+			}
+		}
+		fmt.Printf("%s: %s\n", utils.Emphasize(projectName(b.Project)), strings.Join(counts, ", "))
+		data := make([][]string, rows)
+		for r := range data {
+			data[r] = make([]string, len(flow.Statuses))
+			for c := range flow.Statuses {
+				if r < len(b.Columns[c]) {
+					data[r][c] = cardText(&b.Columns[c][r])
+				}
+			}
+		}
+		utils.Table(header, data)
+	}
+}
+
+// boardView is the state of the interactive board.
+type boardView struct {
+	db      *sql.DB
+	in      *bufio.Reader
+	out     *bufio.Writer
+	boards  []flow.Board
+	project int
+	col     int
+	row     []int // selected card per column
+	top     []int // first visible card per column
+	message string
+	prompt  string // label of the line being edited, if any
+	input   []rune
+}
+
+func newBoardView(database *sql.DB, in io.Reader, out io.Writer) *boardView {
+	return &boardView{
+		db:  database,
+		in:  bufio.NewReader(in),
+		out: bufio.NewWriter(out),
+		row: make([]int, len(flow.Statuses)),
+		top: make([]int, len(flow.Statuses)),
+	}
+}
+
+// load reads the boards again, staying on the current project and, when
+// selected, on the task with ID keep.
+func (v *boardView) load(keep int64) error {
+	current := ""
+	if v.project < len(v.boards) {
+		current = v.boards[v.project].Project
+	}
+	boards, err := flow.Boards(v.db)
+	if err != nil {
+		return err
+	}
+	v.boards = boards
+	v.project = 0
+	for i, b := range boards {
+		if b.Project == current {
+			v.project = i
+		}
+	}
+	if b := v.board(); b != nil && keep != 0 {
+		for c, column := range b.Columns {
+			for r, t := range column {
+				if t.ID == keep {
+					v.col, v.row[c] = c, r
+				}
+			}
+		}
+	}
+	v.clamp()
+	v.focus()
+	return nil
+}
+
+// focus moves off an empty column onto the first one with tasks.
+func (v *boardView) focus() {
+	b := v.board()
+	if b == nil || len(b.Columns[v.col]) > 0 {
+		return
+	}
+	for c, column := range b.Columns {
+		if len(column) > 0 {
+			v.col = c
+			return
+		}
+	}
+}
+
+func (v *boardView) board() *flow.Board {
+	if v.project >= len(v.boards) {
+		return nil
+	}
+	return &v.boards[v.project]
+}
+
+// selected returns the task under the cursor, or nil.
+func (v *boardView) selected() *flow.Task {
+	b := v.board()
+	if b == nil || v.row[v.col] >= len(b.Columns[v.col]) {
+		return nil
+	}
+	return &b.Columns[v.col][v.row[v.col]]
+}
+
+func (v *boardView) clamp() {
+	b := v.board()
+	for c := range v.row {
+		n := 0
+		if b != nil {
+			n = len(b.Columns[c])
+		}
+		if v.row[c] >= n {
+			v.row[c] = n - 1
+		}
+		if v.row[c] < 0 {
+			v.row[c] = 0
+		}
+	}
+}
+
+func (v *boardView) render() {
+	width, height := utils.TerminalSize()
+	lines := make([]string, 0, height)
+
+	title := "Kylrix Flow - Board"
+	if b := v.board(); b != nil {
+		title = fmt.Sprintf("%s   ‹ %s ›  %d/%d", title, projectName(b.Project), v.project+1, len(v.boards))
+	}
+	lines = append(lines, styleBold+runewidth.Truncate(title, width, "…")+styleReset, "")
+
+	n := len(flow.Statuses)
+	colWidth := (width - (n - 1)) / n
+	if colWidth < 8 {
+		colWidth = 8
+	}
+	var header []string
+	for c, status := range flow.Statuses {
+		count := 0
+		if b := v.board(); b != nil {
+			count = len(b.Columns[c])
+		}
+		cell := runewidth.FillRight(runewidth.Truncate(fmt.Sprintf(" %s (%d)", strings.ToUpper(status), count), colWidth, "…"), colWidth)
+		if c == v.col {
+			cell = styleRev + styleBold + cell + styleReset
+		} else {
+			cell = styleBold + cell + styleReset
+		}
+		header = append(header, cell)
+	}
+	lines = append(lines, strings.Join(header, "│"))
+
+	visible := height - 5
+	if visible < 1 {
+		visible = 1
+	}
+	for c := range v.top {
+		if v.row[c] < v.top[c] {
+			v.top[c] = v.row[c]
+		}
+		if v.row[c] >= v.top[c]+visible {
+			v.top[c] = v.row[c] - visible + 1
+		}
+	}
+	now := time.Now()
+	for r := 0; r < visible; r++ {
+		var cells []string
+		for c := range flow.Statuses {
+			cell := strings.Repeat(" ", colWidth)
+			if b := v.board(); b != nil && v.top[c]+r < len(b.Columns[c]) {
+				i := v.top[c] + r
+				t := &b.Columns[c][i]
+				cell = runewidth.FillRight(runewidth.Truncate(" "+cardText(t), colWidth, "…"), colWidth)
+				switch {
+				case c == v.col && i == v.row[c]:
+					cell = styleRev + cell + styleReset
+				case t.Status == flow.Done:
+					cell = styleDim + cell + styleReset
+				case t.Overdue(now):
+					cell = styleRed + cell + styleReset
+				}
+			}
+			cells = append(cells, cell)
+		}
+		lines = append(lines, strings.Join(cells, "│"))
+	}
+
+	status := v.message
+	if v.prompt != "" {
+		status = v.prompt + ": " + string(v.input) + "█"
+	}
+	lines = append(lines, runewidth.Truncate(status, width, "…"))
+	lines = append(lines, styleDim+runewidth.Truncate(boardHelp, width, "…")+styleReset)
+
+	v.out.WriteString(cursorHome)
+	for i, line := range lines {
+		if i > 0 {
+			v.out.WriteString("\r\n")
+		}
+		v.out.WriteString(line + clearLine)
+	}
+	v.out.WriteString(clearBelow)
+	v.out.Flush()
+}
+
+// readKey reads one key press: a printable rune, or a name such as "up",
+// "shift-left", "enter", "esc", "backspace", "tab" or "ctrl-c".
+func (v *boardView) readKey() (string, error) {
+	r, _, err := v.in.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	switch r {
+	case 3:
+		return "ctrl-c", nil
+	case 9:
+		return "tab", nil
+	case 13, 10:
+		return "enter", nil
+	case 21:
+		return "ctrl-u", nil
+	case 8, 127:
+		return "backspace", nil
+	case 27:
+		if v.in.Buffered() == 0 {
+			return "esc", nil
+		}
+		return v.readEscape()
+	}
+	return string(r), nil
+}
+
+// readEscape decodes the rest of an escape sequence.
+func (v *boardView) readEscape() (string, error) {
+	intro, err := v.in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if intro != '[' && intro != 'O' {
+		return "esc", nil
+	}
+	var params []byte
+	for {
+		b, err := v.in.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b >= 0x40 && b <= 0x7e {
+			name := map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left", 'Z': "backtab"}[b]
+			if name != "" && strings.HasSuffix(string(params), ";2") {
+				name = "shift-" + name
+			}
+			return name, nil
+		}
+		params = append(params, b)
+	}
+}
+
+// edit reads a line in the status bar, starting from initial. ok is false when
+// editing was cancelled with Esc.
+func (v *boardView) edit(label, initial string) (string, bool, error) {
+	v.prompt, v.input = label, []rune(initial)
+	defer func() { v.prompt, v.input = "", nil }()
+	for {
+		v.render()
+		key, err := v.readKey()
+		if err != nil {
+			return "", false, err
+		}
+		switch key {
+		case "enter":
+			return strings.TrimSpace(string(v.input)), true, nil
+		case "esc", "ctrl-c":
+			return "", false, nil
+		case "backspace":
+			if len(v.input) > 0 {
+				v.input = v.input[:len(v.input)-1]
+			}
+		case "ctrl-u":
+			v.input = nil
+		default:
+			if r := []rune(key); len(r) == 1 && unicode.IsPrint(r[0]) {
+				v.input = append(v.input, r[0])
+			}
+		}
+	}
+}
+
+// save writes the changes to t, which touch the task and its project, in one
+// transaction.
+func (v *boardView) save(t *flow.Task) error {
+	return db.InTx(v.db, func(q db.Querier) error {
+		return flow.Update(q, t)
+	})
+}
+
+// move puts the selected task in column c.
+func (v *boardView) move(c int) error {
+	t := v.selected()
+	if t == nil || c < 0 || c >= len(flow.Statuses) || c == v.col {
+		return nil
+	}
+	id, title := t.ID, t.Title
+	// Completing a recurring task also creates its next instance.
+	var next *flow.Task
+	err := db.InTx(v.db, func(q db.Querier) error {
+		var err error
+		next, err = flow.Move(q, t, flow.Statuses[c], time.Now())
+		return err
+	})
+	if open, ok := err.(*flow.OpenSubtasksError); ok {
+		v.message = fmt.Sprintf("%q has %d open subtasks; finish them first.", title, open.Open)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v.message = fmt.Sprintf("Moved %q to %s.", title, flow.Statuses[c])
+	if next != nil {
+		v.message += fmt.Sprintf(" Next occurrence is due %s.", next.Due)
+	}
+	return v.load(id)
+}
+
+// handle acts on a key. It returns false when the board should close.
+func (v *boardView) handle(key string) (bool, error) {
+	v.message = ""
+	t := v.selected()
+	switch key {
+	case "q", "esc", "ctrl-c":
+		return false, nil
+	case "left", "h":
+		if v.col > 0 {
+			v.col--
+		}
+	case "right", "l":
+		if v.col < len(flow.Statuses)-1 {
+			v.col++
+		}
+	case "up", "k":
+		if v.row[v.col] > 0 {
+			v.row[v.col]--
+		}
+	case "down", "j":
+		v.row[v.col]++
+		v.clamp()
+	case "shift-left", "H", "<":
+		return true, v.move(v.col - 1)
+	case "shift-right", "L", ">":
+		return true, v.move(v.col + 1)
+	case "1", "2", "3", "4":
+		return true, v.move(int(key[0] - '1'))
+	case "tab", "]":
+		if len(v.boards) > 0 {
+			v.project = (v.project + 1) % len(v.boards)
+			v.clamp()
+			v.focus()
+		}
+	case "backtab", "[":
+		if len(v.boards) > 0 {
+			v.project = (v.project + len(v.boards) - 1) % len(v.boards)
+			v.clamp()
+			v.focus()
+		}
+	case "r":
+		return true, v.load(0)
+	case "e", "enter":
+		if t == nil {
+			return true, nil
+		}
+		title, ok, err := v.edit("Title", t.Title)
+		if err != nil || !ok || title == "" || title == t.Title {
+			return true, err
+		}
+		t.Title = title
+		if err := v.save(t); err != nil {
+			return true, err
+		}
+		v.message = "Title saved."
+		return true, v.load(t.ID)
+	case "d":
+		if t == nil {
+			return true, nil
+		}
+		input, ok, err := v.edit("Due (empty to clear)", t.Due)
+		if err != nil || !ok {
+			return true, err
+		}
+		due := ""
+		if input != "" {
+			if due, err = flow.ParseDue(input, time.Now()); err != nil {
+				v.message = err.Error()
+				return true, nil
+			}
+		}
+		t.Due = due
+		if err := v.save(t); err != nil {
+			return true, err
+		}
+		v.message = "Due date saved."
+		return true, v.load(t.ID)
+	case "+", "-":
+		if t == nil {
+			return true, nil
+		}
+		p := t.Priority + 1
+		if key == "-" {
+			p = t.Priority - 1
+		}
+		if p < 0 || p >= len(flow.Priorities) {
+			return true, nil
+		}
+		t.Priority = p
+		if err := v.save(t); err != nil {
+			return true, err
+		}
+		v.message = fmt.Sprintf("Priority %s.", flow.PriorityName(p))
+		return true, v.load(t.ID)
+	case "a":
+		title, ok, err := v.edit("New task", "")
+		if err != nil || !ok || title == "" {
+			return true, err
+		}
+		task := flow.Task{Title: title, Status: flow.Statuses[v.col]}
+		if b := v.board(); b != nil {
+			task.Project = b.Project
+		}
+		if task.Status == flow.Done {
+			task.Status = flow.Todo
+		}
+		var created *flow.Task
+		err = db.InTx(v.db, func(q db.Querier) error {
+			created, err = flow.Create(q, task)
+			return err
+		})
+		if err != nil {
+			return true, err
+		}
+		v.message = fmt.Sprintf("Task %s added.", created.UID)
+		return true, v.load(created.ID)
+	}
+	return true, nil
+}
+
+// run shows the board until it is closed.
+func (v *boardView) run() error {
+	restore, err := utils.MakeRaw()
+	if err != nil {
+		return err
+	}
+	v.out.WriteString(enterScreen)
+	defer func() {
+		v.out.WriteString(styleReset + leaveScreen)
+		v.out.Flush()
+		restore()
+	}()
+
+	for {
+		v.render()
+		key, err := v.readKey()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		more, err := v.handle(key)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+var flowBoardCmd = &cobra.Command{
+	Use:   "board",
+	Short: "Show tasks as a kanban board",
+	Long: `Show each project's tasks in todo, doing, blocked and done columns.
+
+In a terminal the board is interactive: move around with the arrow keys (or
+h/j/k/l), move the selected task to another column with H/L, Shift+arrows or
+1-4, edit its title with e, its due date with d and its priority with +/-, and
+add a task to the current column with a. [ and ] switch projects. Changes are
+saved as they are made.
+
+When output is not a terminal the board is printed instead.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		v := newBoardView(database, os.Stdin, os.Stdout)
+		if err := v.load(0); err != nil {
+			return err
+		}
+		if boardProject != "" {
+			found := false
+			for i, b := range v.boards {
+				if strings.EqualFold(b.Project, boardProject) {
+					v.project, found = i, true
+				}
+			}
+			if !found {
+				return fmt.Errorf("no tasks in project %q", boardProject)
+			}
+		}
+
+		if !utils.StdoutIsTerminal() || utils.StdinIsPiped() {
+			if len(v.boards) == 0 {
+				utils.Info("No tasks yet. Add one with: kylrix flow add <title>")
+				return nil
+			}
+			if boardProject != "" {
+				printBoards(v.boards[v.project : v.project+1])
+			} else {
+				printBoards(v.boards)
+			}
+			return nil
+		}
+		v.clamp()
+		v.focus()
+		return v.run()
+	},
+}
+
+func init() {
+	flowBoardCmd.Flags().StringVarP(&boardProject, "project", "P", "", "Start on (or, when printing, only show) this project")
+	flowCmd.AddCommand(flowBoardCmd)
+}
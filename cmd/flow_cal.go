@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/dateparse"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/flow"
+	"github.com/nathfavour/kylrix/cli/pkg/ical"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	calWeek     bool
+	calAt       string
+	calUntil    string
+	calFor      time.Duration
+	calLocation string
+	calNote     string
+	calEvery    string
+	calTZ       string
+	calNoTasks  bool
+	forceEvent  bool
+)
+
+// timeSpan shows when an occurrence happens on day, in local time.
+func timeSpan(o flow.Occurrence, day time.Time) string {
+	if o.Event.AllDay {
+		return "all day"
+	}
+	start, end := o.Start.In(time.Local), o.End.In(time.Local)
+	from, to := start.Format("15:04"), end.Format("15:04")
+	if start.Before(day) {
+		from = "…"
+	}
+	if !end.Before(day.AddDate(0, 0, 1)) {
+		to = "…"
+	}
+	if !end.After(start) {
+		return from
+	}
+	return from + "–" + to
+}
+
+// onDay reports whether an occurrence falls within [day, next).
+func onDay(o flow.Occurrence, day, next time.Time) bool {
+	if !o.Start.Before(next) {
+		return false
+	}
+	if o.End.Equal(o.Start) {
+		return !o.Start.Before(day)
+	}
+	return o.End.After(day)
+}
+
+var flowCalCmd = &cobra.Command{
+	Use:   "cal",
+	Short: "Show the agenda for today or the week",
+	Long: `Show today's events and the open tasks due today, with overdue tasks first;
+--week shows the next seven days. Times are shown in the local time zone.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		now := time.Now()
+		today := startOfDay(now)
+		days := 1
+		if calWeek {
+			days = 7
+		}
+		end := today.AddDate(0, 0, days)
+		occurrences, err := flow.Occurrences(database, today, end)
+		if err != nil {
+			return err
+		}
+		tasks, err := flow.List(database, flow.Filter{DueBy: end.Add(-time.Nanosecond)})
+		if err != nil {
+			return err
+		}
+
+		banner := "Kylrix Flow - Today"
+		if calWeek {
+			banner = "Kylrix Flow - This Week"
+		}
+		utils.Banner(banner)
+		var data [][]string
+		for d := 0; d < days; d++ {
+			day := today.AddDate(0, 0, d)
+			next := day.AddDate(0, 0, 1)
+			label := day.Format("Mon Jan 2")
+			for i := range tasks {
+				t := &tasks[i]
+				due, _ := flow.DueTime(t.Due, time.Local)
+				// Overdue tasks are listed under today.
+				if due.Before(next) && (!due.Before(day) || d == 0) {
+					when := "due"
+					if len(t.Due) > len(flow.DateLayout) {
+						when = "due " + t.Due[len(flow.DateLayout)+1:]
+					}
+					if t.Overdue(now) {
+						when = utils.Alert("overdue " + t.Due)
+					}
+					data = append(data, []string{label, when, "☐ " + t.Title, t.UID})
+					label = ""
+				}
+			}
+			for _, o := range occurrences {
+				if !onDay(o, day, next) {
+					continue
+				}
+				title := o.Event.Title
+				if o.Event.Location != "" {
+					title += " @ " + o.Event.Location
+				}
+				if o.Event.Recur != "" {
+					title += " ↻"
+				}
+				data = append(data, []string{label, timeSpan(o, day), title, o.Event.UID})
+				label = ""
+			}
+		}
+		if len(data) == 0 {
+			utils.Info("Nothing planned. Add an event with: kylrix flow cal add <title> --at <when>")
+			return nil
+		}
+		utils.Table([]string{"DAY", "TIME", "WHAT", "ID"}, data)
+		return nil
+	},
+}
+
+var flowCalAddCmd = &cobra.Command{
+	Use:   "add [title]",
+	Short: "Add a calendar event",
+	Long: `Add an event starting --at a date and time, such as "tomorrow 3pm" or
+"fri 9:30". A date without a time makes an all-day event. It lasts --for a
+duration (default 1h) or --until a time or, for all-day events, a last day.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if calAt == "" {
+			return errors.New("--at is required")
+		}
+		loc := time.Local
+		if calTZ != "" {
+			var err error
+			if loc, err = time.LoadLocation(calTZ); err != nil {
+				return fmt.Errorf("unknown time zone %q", calTZ)
+			}
+		}
+		start, err := dateparse.Parse(calAt, time.Now().In(loc))
+		if err != nil {
+			return err
+		}
+		e := flow.Event{
+			Title:       strings.Join(args, " "),
+			Description: calNote,
+			Location:    calLocation,
+			Start:       start.Time,
+			AllDay:      !start.HasTime,
+		}
+		if !e.AllDay && calTZ != "" {
+			e.TZ = loc.String()
+		}
+		if e.AllDay && e.TZ == "" {
+			// All-day events are days wherever they are read.
+			e.Start = time.Date(e.Start.Year(), e.Start.Month(), e.Start.Day(), 0, 0, 0, 0, time.Local)
+		}
+
+		switch {
+		case calUntil != "":
+			until, err := dateparse.Parse(calUntil, e.Start)
+			if err != nil {
+				return err
+			}
+			e.End = until.Time
+			if e.AllDay {
+				e.End = time.Date(until.Time.Year(), until.Time.Month(), until.Time.Day()+1, 0, 0, 0, 0, e.Start.Location())
+			}
+		case calFor > 0:
+			e.End = e.Start.Add(calFor)
+		case !e.AllDay:
+			e.End = e.Start.Add(time.Hour)
+		}
+		if e.Recur, err = parseEvery(calEvery); err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		created, err := flow.CreateEvent(database, e)
+		if err != nil {
+			return err
+		}
+		utils.Success(fmt.Sprintf("Event %s added: %s", created.UID, created.Title))
+		when := created.Start.Format("Mon Jan 2 15:04")
+		if created.AllDay {
+			when = created.Start.Format("Mon Jan 2")
+		}
+		utils.Info(fmt.Sprintf("On %s.", when))
+		return nil
+	},
+}
+
+var flowCalRmCmd = &cobra.Command{
+	Use:     "rm [id|title]",
+	Aliases: []string{"delete"},
+	Short:   "Delete a calendar event",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		e, err := flow.GetEvent(database, args[0])
+		if err != nil {
+			return err
+		}
+		if !forceEvent && !utils.Confirm(fmt.Sprintf("Delete event '%s' (%s)", e.Title, e.UID)) {
+			utils.Info("Aborted.")
+			return nil
+		}
+		if err := flow.DeleteEvent(database, e.ID); err != nil {
+			return err
+		}
+		utils.Success(fmt.Sprintf("Event %s deleted.", e.UID))
+		return nil
+	},
+}
+
+var flowCalImportCmd = &cobra.Command{
+	Use:   "import [file.ics]",
+	Short: "Import events and to-dos from an iCalendar file",
+	Long: `Import the events (VEVENT) of an iCalendar file as calendar events and its
+to-dos (VTODO) as tasks. Entries imported or exported before are updated
+rather than added again.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		components, err := ical.Decode(bytes.NewReader(data))
+		if err != nil {
+			return errors.Wrapf(err, "cannot read %s", args[0])
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		total := &flow.CalendarImport{}
+		for _, c := range components {
+			if c.Name != "VCALENDAR" {
+				continue
+			}
+			result, err := flow.ImportCalendar(tx, c)
+			if err != nil {
+				return err
+			}
+			total.EventsCreated += result.EventsCreated
+			total.EventsUpdated += result.EventsUpdated
+			total.TasksCreated += result.TasksCreated
+			total.TasksUpdated += result.TasksUpdated
+			total.Warnings = append(total.Warnings, result.Warnings...)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		utils.Success(fmt.Sprintf("Imported %d new and %d updated events, %d new and %d updated tasks.",
+			total.EventsCreated, total.EventsUpdated, total.TasksCreated, total.TasksUpdated))
+		for _, w := range total.Warnings {
+			utils.Warning(w)
+		}
+		return nil
+	},
+}
+
+var flowCalExportCmd = &cobra.Command{
+	Use:   "export [file.ics]",
+	Short: "Export events and tasks to an iCalendar file",
+	Long: `Write every calendar event, and the tasks with a due date as to-dos, to an
+iCalendar file ("-" for stdout).`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		cal, err := flow.Calendar(database, !calNoTasks, time.Now())
+		if err != nil {
+			return err
+		}
+		if args[0] == "-" {
+			return ical.Encode(os.Stdout, cal)
+		}
+		var buf bytes.Buffer
+		if err := ical.Encode(&buf, cal); err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[0], buf.Bytes(), 0600); err != nil {
+			return err
+		}
+		events, todos := len(cal.Children("VEVENT")), len(cal.Children("VTODO"))
+		utils.Success(fmt.Sprintf("Exported %d events and %d tasks to %s.", events, todos, args[0]))
+		return nil
+	},
+}
+
+func init() {
+	flowCalCmd.Flags().BoolVar(&calWeek, "week", false, "Show the next seven days")
+
+	flowCalAddCmd.Flags().StringVar(&calAt, "at", "", "Start, e.g. \"tomorrow 3pm\", \"fri 9:30\" or 2026-03-10 (a date alone is all day)")
+	flowCalAddCmd.Flags().StringVar(&calUntil, "until", "", "End time, or last day of an all-day event")
+	flowCalAddCmd.Flags().DurationVar(&calFor, "for", 0, "Length, e.g. 30m or 2h (default 1h)")
+	flowCalAddCmd.Flags().StringVarP(&calLocation, "location", "l", "", "Where the event takes place")
+	flowCalAddCmd.Flags().StringVarP(&calNote, "note", "n", "", "Description")
+	flowCalAddCmd.Flags().StringVar(&calEvery, "every", "", "Repeat: daily, 2w, weekdays, mon,fri, \"2nd tue\", 15th or an RRULE")
+	flowCalAddCmd.Flags().StringVar(&calTZ, "tz", "", "Time zone of --at, e.g. Europe/Berlin (default local)")
+
+	flowCalRmCmd.Flags().BoolVarP(&forceEvent, "force", "f", false, "Delete without confirmation")
+
+	flowCalExportCmd.Flags().BoolVar(&calNoTasks, "no-tasks", false, "Leave out tasks")
+
+	flowCalCmd.AddCommand(flowCalAddCmd)
+	flowCalCmd.AddCommand(flowCalRmCmd)
+	flowCalCmd.AddCommand(flowCalImportCmd)
+	flowCalCmd.AddCommand(flowCalExportCmd)
+	flowCmd.AddCommand(flowCalCmd)
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api"
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/flowsync"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncDryRun    bool
+	syncConflicts bool
+)
+
+// conflictLine describes how a conflict was settled.
+func conflictLine(c flowsync.Conflict) string {
+	kept, lost := c.Local, c.Remote
+	if c.Winner == "remote" {
+		kept, lost = c.Remote, c.Local
+	}
+	if c.Field == "deleted" {
+		return fmt.Sprintf("%s %q was %s here and %s on the server; kept the %s change.",
+			c.Kind, c.Title, c.Local, c.Remote, c.Winner)
+	}
+	return fmt.Sprintf("%s %q %s changed on both sides; kept %s %q over %q.",
+		c.Kind, c.Title, c.Field, c.Winner, kept, lost)
+}
+
+var flowSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync tasks and calendar events with the Kylrix Flow backend",
+	Long: `Pull the tasks and events changed on the server since the last sync, then
+push local changes. Changes made while offline are queued and sent on the next
+sync. When the same field was changed on both sides the later change wins and
+the conflict is logged; --conflicts shows the log.
+
+--dry-run lists what a sync would change without changing anything.`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		if syncConflicts {
+			utils.Banner("Kylrix Flow - Sync Conflicts")
+			conflicts, err := flowsync.Conflicts(database, 20)
+			if err != nil {
+				return err
+			}
+			if len(conflicts) == 0 {
+				utils.Info("No conflicts logged.")
+				return nil
+			}
+			var data [][]string
+			for _, c := range conflicts {
+				when := c.ResolvedAt
+				if t, err := time.Parse(time.RFC3339, when); err == nil {
+					when = t.Local().Format("2006-01-02 15:04")
+				}
+				data = append(data, []string{when, c.Kind + " " + c.Title, c.Field, c.Local, c.Remote, c.Winner})
+			}
+			utils.Table([]string{"WHEN", "WHAT", "FIELD", "LOCAL", "REMOTE", "KEPT"}, data)
+			return nil
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.APIKey == "" && cfg.Token == "" {
+			return fmt.Errorf("not logged in; use 'kylrix login' to authenticate")
+		}
+
+		utils.Banner("Kylrix Flow - Sync")
+		report, err := flowsync.New(api.NewClient(cfg), database).Sync(syncDryRun)
+		if err != nil {
+			if n, perr := flowsync.Pending(database); perr == nil && n > 0 && !syncDryRun {
+				utils.Warning(fmt.Sprintf("%d local changes are queued and will be sent on the next sync.", n))
+			}
+			return err
+		}
+
+		if syncDryRun {
+			if len(report.Changes) == 0 {
+				utils.Info("Everything is in sync.")
+			} else {
+				var data [][]string
+				for _, c := range report.Changes {
+					dir := "pull"
+					if c.Push {
+						dir = "push"
+					}
+					data = append(data, []string{dir, c.Action, c.Kind + " " + c.Title, strings.Join(c.Fields, ", ")})
+				}
+				utils.Table([]string{"DIRECTION", "ACTION", "WHAT", "FIELDS"}, data)
+			}
+		} else {
+			utils.Success(fmt.Sprintf("Synced with %s: %d pulled, %d pushed.",
+				cfg.BaseURI, report.Count(false), report.Count(true)))
+		}
+		for _, c := range report.Conflicts {
+			utils.Warning(conflictLine(c))
+		}
+		for _, w := range report.Warnings {
+			utils.Warning(w)
+		}
+		if syncDryRun {
+			utils.Info("Dry run: nothing was changed.")
+		}
+		return nil
+	},
+}
+
+func init() {
+	flowSyncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Show the planned changes without syncing")
+	flowSyncCmd.Flags().BoolVar(&syncConflicts, "conflicts", false, "Show the latest logged conflicts")
+	flowCmd.AddCommand(flowSyncCmd)
+}
@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/flow"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logWeek        bool
+	reportFrom     string
+	reportTo       string
+	reportFormat   string
+	pomodoroWork   time.Duration
+	pomodoroBreak  time.Duration
+	pomodoroRounds int
+)
+
+// formatDuration shows a duration in hours and minutes.
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// startOfDay is midnight of t's day in its location.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek is midnight of the Monday of t's week.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// startTimer starts timing t, moving it to doing if it was still todo.
+func startTimer(q db.Querier, t *flow.Task, now time.Time) (*flow.Entry, error) {
+	if t.Status == flow.Done {
+		return nil, fmt.Errorf("task %s is done; reopen it with 'kylrix flow edit %s --status todo'", t.UID, t.UID)
+	}
+	entry, err := flow.Start(q, t.ID, now)
+	if running, ok := err.(*flow.RunningError); ok {
+		return nil, fmt.Errorf("%v; stop it first with 'kylrix flow stop'", running)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Status == flow.Todo {
+		t.Status = flow.Doing
+		if err := flow.Update(q, t); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+var flowStartCmd = &cobra.Command{
+	Use:   "start [id|title]",
+	Short: "Start timing a task",
+	Long: `Start a timer for a task. Only one timer runs at a time; stop it with
+'kylrix flow stop'. A task still to do moves to doing.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withTask(args[0], func(q db.Querier, t *flow.Task) error {
+			entry, err := startTimer(q, t, time.Now())
+			if err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Timer started for %s: %s (at %s)", t.UID, t.Title, entry.Start.Format("15:04")))
+			return nil
+		})
+	},
+}
+
+var flowStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running timer",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		entry, err := flow.Stop(database, time.Now())
+		if err == flow.ErrNoTimer {
+			utils.Info("No timer is running.")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		utils.Success(fmt.Sprintf("Timer stopped for %s: %s after %s", entry.TaskUID, entry.Title, formatDuration(entry.Duration(entry.End))))
+		return nil
+	},
+}
+
+var flowLogCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Summarize time spent today or this week",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		now := time.Now()
+		from, to, banner := startOfDay(now), startOfDay(now).AddDate(0, 0, 1), "Kylrix Flow - Today"
+		if logWeek {
+			from = startOfWeek(now)
+			to, banner = from.AddDate(0, 0, 7), "Kylrix Flow - This Week"
+		}
+		entries, err := flow.Entries(database, from, to)
+		if err != nil {
+			return err
+		}
+
+		utils.Banner(banner)
+		if running, err := flow.Running(database); err != nil {
+			return err
+		} else if running != nil {
+			utils.Info(fmt.Sprintf("Timer running for %s: %s (%s so far)", running.TaskUID, running.Title, formatDuration(running.Duration(now))))
+		}
+		if len(entries) == 0 {
+			utils.Info("No time tracked. Start a timer with: kylrix flow start <id>")
+			return nil
+		}
+
+		tasks, projects := flow.Summarize(entries, now)
+		var total time.Duration
+		var data [][]string
+		for _, t := range tasks {
+			total += t.Duration
+			data = append(data, []string{t.UID, t.Name, formatDuration(t.Duration)})
+		}
+		utils.Table([]string{"ID", "TASK", "TIME"}, data)
+		data = nil
+		for _, p := range projects {
+			name := p.Name
+			if name == "" {
+				name = "(no project)"
+			}
+			data = append(data, []string{name, formatDuration(p.Duration)})
+		}
+		utils.Table([]string{"PROJECT", "TIME"}, data)
+		utils.Info(fmt.Sprintf("Total: %s", formatDuration(total)))
+		return nil
+	},
+}
+
+// timesheetRow is one time entry in a report.
+type timesheetRow struct {
+	Task    string  `json:"task"`
+	Title   string  `json:"title"`
+	Project string  `json:"project,omitempty"`
+	Start   string  `json:"start"`
+	End     string  `json:"end,omitempty"`
+	Hours   float64 `json:"hours"`
+}
+
+// reportDay reads a --from or --to date as the start of its day.
+func reportDay(s string, now time.Time) (time.Time, error) {
+	due, err := flow.ParseDue(s, now)
+	if err != nil {
+		return time.Time{}, err
+	}
+	day, err := time.ParseInLocation(flow.DateLayout, due[:len(flow.DateLayout)], now.Location())
+	return day, err
+}
+
+var flowReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Export a timesheet as CSV or JSON",
+	Long: `Write the time entries started between --from and --to (both inclusive,
+this week by default) to stdout as CSV or JSON.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		now := time.Now()
+		from, to := startOfWeek(now), startOfWeek(now).AddDate(0, 0, 7)
+		var err error
+		if reportFrom != "" {
+			if from, err = reportDay(reportFrom, now); err != nil {
+				return err
+			}
+		}
+		if reportTo != "" {
+			if to, err = reportDay(reportTo, now); err != nil {
+				return err
+			}
+			to = to.AddDate(0, 0, 1)
+		}
+		if !to.After(from) {
+			return errors.New("--to is before --from")
+		}
+		if reportFormat != "csv" && reportFormat != "json" {
+			return fmt.Errorf("unknown format %q (use csv or json)", reportFormat)
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		entries, err := flow.Entries(database, from, to)
+		if err != nil {
+			return err
+		}
+		rows := make([]timesheetRow, 0, len(entries))
+		for i := range entries {
+			e := &entries[i]
+			row := timesheetRow{
+				Task:    e.TaskUID,
+				Title:   e.Title,
+				Project: e.Project,
+				Start:   e.Start.Format(time.RFC3339),
+				Hours:   math.Round(e.Duration(now).Hours()*100) / 100,
+			}
+			if !e.Running() {
+				row.End = e.End.Format(time.RFC3339)
+			}
+			rows = append(rows, row)
+		}
+
+		if reportFormat == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(rows)
+		}
+		w := csv.NewWriter(os.Stdout)
+		w.Write([]string{"task", "title", "project", "start", "end", "hours"})
+		for _, r := range rows {
+			w.Write([]string{r.Task, r.Title, r.Project, r.Start, r.End, strconv.FormatFloat(r.Hours, 'f', 2, 64)})
+		}
+		w.Flush()
+		return w.Error()
+	},
+}
+
+// countdown shows the time left on one line until d has passed. It returns
+// false if interrupted.
+func countdown(label string, d time.Duration, interrupt <-chan os.Signal) bool {
+	end := time.Now().Add(d)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		left := time.Until(end).Round(time.Second)
+		if left < 0 {
+			left = 0
+		}
+		fmt.Printf("\r%s %02d:%02d ", label, int(left.Minutes()), int(left.Seconds())%60)
+		if left == 0 {
+			// The bell works in any terminal, with or without a desktop.
+			fmt.Print("\a\n")
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-interrupt:
+			fmt.Println()
+			return false
+		}
+	}
+}
+
+var flowPomodoroCmd = &cobra.Command{
+	Use:   "pomodoro [id|title]",
+	Short: "Time a task in focused work sessions with breaks",
+	Long: `Run a countdown for a work session on a task, timing it as with 'kylrix flow
+start', then a break. The terminal bell rings when each one ends. Ctrl+C (or
+closing the terminal) stops the timer and ends the session early.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if pomodoroWork <= 0 || pomodoroRounds < 1 {
+			return errors.New("--work and --rounds must be positive")
+		}
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		t, err := flow.Get(database, args[0])
+		if err != nil {
+			return err
+		}
+
+		interrupt := make(chan os.Signal, 1)
+		// Closing the terminal or killing the process must still log the
+		// time worked so far.
+		signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+		defer signal.Stop(interrupt)
+
+		utils.Banner("Kylrix Flow - Pomodoro")
+		utils.Info(fmt.Sprintf("%s: %s", t.UID, t.Title))
+		for round := 1; round <= pomodoroRounds; round++ {
+			// The timer is committed before the countdown, so other commands
+			// can use the database and 'flow log' shows the running session.
+			done := false
+			entry, err := flow.Session(database, func(q db.Querier) error {
+				_, err := startTimer(q, t, time.Now())
+				return err
+			}, func() {
+				done = countdown(fmt.Sprintf("Work %d/%d", round, pomodoroRounds), pomodoroWork, interrupt)
+			}, time.Now)
+			if err != nil {
+				return err
+			}
+			if !done {
+				utils.Warning(fmt.Sprintf("Stopped early; %s tracked.", formatDuration(entry.Duration(entry.End))))
+				return nil
+			}
+			utils.Success(fmt.Sprintf("Session done; %s tracked.", formatDuration(entry.Duration(entry.End))))
+			if round == pomodoroRounds || pomodoroBreak <= 0 {
+				continue
+			}
+			if !countdown("Break", pomodoroBreak, interrupt) {
+				return nil
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	flowLogCmd.Flags().BoolVar(&logWeek, "week", false, "Summarize this week instead of today")
+
+	flowReportCmd.Flags().StringVar(&reportFrom, "from", "", "First day to include (default Monday of this week)")
+	flowReportCmd.Flags().StringVar(&reportTo, "to", "", "Last day to include (default Sunday of this week)")
+	flowReportCmd.Flags().StringVar(&reportFormat, "format", "csv", "Output format: csv or json")
+
+	flowPomodoroCmd.Flags().DurationVar(&pomodoroWork, "work", 25*time.Minute, "Length of a work session")
+	flowPomodoroCmd.Flags().DurationVar(&pomodoroBreak, "break", 5*time.Minute, "Length of the break between sessions")
+	flowPomodoroCmd.Flags().IntVar(&pomodoroRounds, "rounds", 1, "Number of work sessions")
+
+	flowCmd.AddCommand(flowStartCmd)
+	flowCmd.AddCommand(flowStopCmd)
+	flowCmd.AddCommand(flowLogCmd)
+	flowCmd.AddCommand(flowReportCmd)
+	flowCmd.AddCommand(flowPomodoroCmd)
+}
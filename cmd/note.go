@@ -1,13 +1,34 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
 	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/markdown"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/secretref"
 	"github.com/nathfavour/kylrix/cli/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
 var (
-	enhance bool
+	enhance       bool
+	resolveRefs   bool
+	renameTitle   string
+	forceNote     bool
+	noteBody      string
+	noteFile      string
+	noteTags      []string
+	noteNotebook  string
+	encryptNote   bool
+	alwaysEncrypt bool
+	rawNote       bool
+	noteTemplate  string
 )
 
 var noteCmd = &cobra.Command{
@@ -28,21 +49,16 @@ var noteListCmd = &cobra.Command{
 		}
 		defer database.Close()
 
-		rows, err := database.Query("SELECT title, created_at FROM notes")
+		list, err := notes.List(database, notes.Filter{Tags: noteTags, Notebook: noteNotebook})
 		if err != nil {
 			return err
 		}
-		defer rows.Close()
 
 		utils.Banner("Kylrix Note - List")
-		header := []string{"TITLE", "CREATED"}
+		header := []string{"ID", "TITLE", "NOTEBOOK", "TAGS", "UPDATED"}
 		var data [][]string
-		for rows.Next() {
-			var title, created string
-			if err := rows.Scan(&title, &created); err != nil {
-				return err
-			}
-			data = append(data, []string{title, created})
+		for _, n := range list {
+			data = append(data, []string{n.UID, noteLabel(&n), n.Notebook, strings.Join(n.Tags, ", "), n.UpdatedAt})
 		}
 
 		if len(data) == 0 {
@@ -57,18 +73,56 @@ var noteListCmd = &cobra.Command{
 var noteCreateCmd = &cobra.Command{
 	Use:   "create [title]",
 	Short: "Create a new note",
-	Args:  cobra.ExactArgs(1),
+	Long: `Create a new note. Content comes from --body, --file, piped stdin
+(cat log.txt | kylrix note create "incident"), or $EDITOR otherwise.
+
+With --template the note starts from a template in the templates folder; the
+title is optional when the template provides one.
+
+Encrypting piped content unlocks the vault on the terminal, or with the master
+password in KYLRIX_VAULT_PASSWORD when there is none.`,
+	Args: cobra.RangeArgs(0, 1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		title := args[0]
-		
-		content, err := utils.Prompt("Note Content")
+		title := ""
+		if len(args) > 0 {
+			title = args[0]
+		}
+
+		var content string
+		var err error
+		if noteTemplate != "" {
+			title, content, err = contentFromTemplate(cmd, title)
+			if err != nil {
+				return err
+			}
+		} else {
+			if title == "" {
+				return errors.New("a title is required")
+			}
+			content, err = readNoteContent(cmd)
+			if err != nil {
+				return err
+			}
+		}
+
+		cfg, err := config.LoadConfig()
 		if err != nil {
 			return err
 		}
+		draft := notes.Note{Title: title, Encrypted: cfg.AlwaysEncryptNotes}
+		if cmd.Flags().Changed("encrypt") {
+			draft.Encrypted = encryptNote
+		}
 
+		enhanced, useEnhanced := "", false
 		if enhance {
-			utils.Info("Enhancing note with AI...")
-			content = "[AI Enhanced] " + content
+			if draft.Encrypted {
+				return errEncryptedEnhance
+			}
+			enhanced, useEnhanced, err = enhanceContent(cmd.Context(), content)
+			if err != nil {
+				return err
+			}
 		}
 		
 		database, err := db.InitDB()
@@ -76,21 +130,316 @@ var noteCreateCmd = &cobra.Command{
 			return err
 		}
 		defer database.Close()
+		mek := &lazyMEK{}
+		defer mek.Destroy()
+		// Piped content leaves nothing on stdin to unlock the vault with.
+		if draft.Encrypted && utils.StdinIsPiped() {
+			if mek.key, err = unlockForHelper(database); err != nil {
+				return err
+			}
+		}
+		if err := setNoteContent(&draft, content, mek); err != nil {
+			return err
+		}
 
-		_, err = database.Exec("INSERT INTO notes (title, content) VALUES (?, ?)", title, content)
+		tx, err := database.Begin()
 		if err != nil {
 			return err
 		}
+		defer tx.Rollback()
 
-		utils.Success("Note created successfully in local database.")
+		n, err := notes.Create(tx, draft)
+		if err != nil {
+			return err
+		}
+		if err := notes.AddTags(tx, n.ID, noteTags...); err != nil {
+			return err
+		}
+		if err := notes.SetNotebook(tx, n.ID, noteNotebook); err != nil {
+			return err
+		}
+		if useEnhanced {
+			if _, err := applyEnhancement(tx, n, enhanced); err != nil {
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		utils.Success(fmt.Sprintf("Note %s created successfully in local database.", n.UID))
+		return nil
+	},
+}
+
+// noteLabel is the title as shown in listings, marked when pinned or encrypted.
+func noteLabel(n *notes.Note) string {
+	label := n.Title
+	if n.Encrypted {
+		label = "🔒 " + label
+	}
+	if n.Pinned {
+		label = "📌 " + label
+	}
+	return label
+}
+
+// readNoteContent takes the note body from --body, --file, piped stdin or
+// $EDITOR, in that order. Content is kept byte-for-byte.
+func readNoteContent(cmd *cobra.Command) (string, error) {
+	bodySet := cmd.Flags().Changed("body")
+	if bodySet && noteFile != "" {
+		return "", errors.New("use either --body or --file, not both")
+	}
+
+	switch {
+	case bodySet:
+		return noteBody, nil
+	case noteFile == "-":
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	case noteFile != "":
+		data, err := os.ReadFile(noteFile)
+		return string(data), err
+	case utils.StdinIsPiped():
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+
+	content, err := utils.EditText("", ".md")
+	if err != nil {
+		return "", err
+	}
+	if content == "" {
+		return "", errors.New("empty note, aborting")
+	}
+	return content, nil
+}
+
+var noteShowCmd = &cobra.Command{
+	Use:   "show [id|title]",
+	Short: "Show a note",
+	Long: `Show a note with its details, rendering the Markdown for the terminal.
+When stdout is not a terminal only the content is printed, as with --raw.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		n, err := notes.Get(database, args[0])
+		if err != nil {
+			return err
+		}
+
+		mek := &lazyMEK{}
+		defer mek.Destroy()
+
+		content, err := noteContent(n, mek)
+		if err != nil {
+			return err
+		}
+		// Secret references stay in the database; values are only substituted
+		// into what we print, and only when explicitly asked for.
+		if resolveRefs {
+			content, err = resolveSecretRefs(database, content, mek)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Piped output is for other programs: the content alone, as stored.
+		if rawNote || !utils.StdoutIsTerminal() {
+			fmt.Print(content)
+			return nil
+		}
+
+		utils.Banner(noteLabel(n))
+		utils.Info(fmt.Sprintf("ID: %s  Created: %s  Updated: %s", n.UID, n.CreatedAt, n.UpdatedAt))
+		if n.Notebook != "" || len(n.Tags) > 0 {
+			utils.Info(fmt.Sprintf("Notebook: %s  Tags: %s", n.Notebook, strings.Join(n.Tags, ", ")))
+		}
+		fmt.Print(markdown.Render(content, utils.TerminalWidth()))
+		return nil
+	},
+}
+
+var noteEditCmd = &cobra.Command{
+	Use:   "edit [id|title]",
+	Short: "Edit a note in $EDITOR",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		n, err := notes.Get(database, args[0])
+		if err != nil {
+			return err
+		}
+		return editNote(database, n, renameTitle)
+	},
+}
+
+// editNote opens n in $EDITOR and saves it, renamed to title when given.
+func editNote(q db.Querier, n *notes.Note, title string) error {
+	mek := &lazyMEK{}
+	defer mek.Destroy()
+
+	original, err := noteContent(n, mek)
+	if err != nil {
+		return err
+	}
+	content, err := utils.EditText(original, ".md")
+	if err != nil {
+		return err
+	}
+
+	if content == original && (title == "" || title == n.Title) {
+		utils.Info("No changes.")
+		return nil
+	}
+	if content != original {
+		if err := setNoteContent(n, content, mek); err != nil {
+			return err
+		}
+	}
+	if title != "" {
+		n.Title = title
+	}
+	if err := saveNote(q, n); err != nil {
+		return err
+	}
+
+	utils.Success(fmt.Sprintf("Note %s saved.", n.UID))
+	return nil
+}
+
+var noteDeleteCmd = &cobra.Command{
+	Use:   "delete [id|title]",
+	Short: "Delete a note",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		n, err := notes.Get(database, args[0])
+		if err != nil {
+			return err
+		}
+
+		if !forceNote && !utils.Confirm(fmt.Sprintf("Delete note '%s' (%s)", n.Title, n.UID)) {
+			utils.Info("Aborted.")
+			return nil
+		}
+		if err := notes.Delete(database, n.ID); err != nil {
+			return err
+		}
+
+		utils.Success(fmt.Sprintf("Note %s deleted.", n.UID))
+		return nil
+	},
+}
+
+var noteSettingsCmd = &cobra.Command{
+	Use:   "settings",
+	Short: "Show or change note settings",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		changed := false
+		if cmd.Flags().Changed("always-encrypt") {
+			cfg.AlwaysEncryptNotes = alwaysEncrypt
+			changed = true
+		}
+		if cmd.Flags().Changed("keep-revisions") {
+			cfg.NoteRevisionLimit, _ = cmd.Flags().GetInt("keep-revisions")
+			changed = true
+		}
+		for _, flag := range []string{"ai-endpoint", "ai-model", "ai-key"} {
+			if !cmd.Flags().Changed(flag) {
+				continue
+			}
+			if cfg.AI == nil {
+				cfg.AI = &config.AIConfig{}
+			}
+			value, _ := cmd.Flags().GetString(flag)
+			switch flag {
+			case "ai-endpoint":
+				cfg.AI.Endpoint = value
+			case "ai-model":
+				cfg.AI.Model = value
+			case "ai-key":
+				if cfg.AI.APIKey, err = saveAIKey(value); err != nil {
+					return err
+				}
+			}
+			changed = true
+		}
+		if changed {
+			if err := config.SaveConfig(cfg); err != nil {
+				return err
+			}
+			utils.Success("Note settings saved.")
+		}
+
+		utils.Banner("Kylrix Note - Settings")
+		utils.Info(fmt.Sprintf("Always encrypt new notes: %v", cfg.AlwaysEncryptNotes))
+		if limit := revisionLimit(); limit < 0 {
+			utils.Info("Revisions kept per note: all")
+		} else {
+			utils.Info(fmt.Sprintf("Revisions kept per note: %d", limit))
+		}
+		if cfg.AI != nil && cfg.AI.Endpoint != "" {
+			utils.Info(fmt.Sprintf("AI endpoint: %s  Model: %s", cfg.AI.Endpoint, cfg.AI.Model))
+			if _, ok := os.LookupEnv(aiKeyEnv); ok {
+				utils.Info(fmt.Sprintf("AI API Key: from %s", aiKeyEnv))
+			} else if len(secretref.Find(cfg.AI.APIKey)) > 0 {
+				utils.Info(fmt.Sprintf("AI API Key: %s", cfg.AI.APIKey))
+			} else if cfg.AI.APIKey != "" {
+				utils.Warning("AI API Key: stored in plaintext; run 'kylrix note settings --ai-key KEY' to move it into the vault")
+			}
+		} else {
+			utils.Info("AI endpoint: not configured")
+		}
 		return nil
 	},
 }
 
 func init() {
-	noteCreateCmd.Flags().BoolVar(&enhance, "enhance", false, "Use AI to enhance note content")
-	
+	noteCreateCmd.Flags().BoolVar(&enhance, "enhance", false, "Use AI to enhance note content (keeps the original as a revision)")
+	noteCreateCmd.Flags().StringVar(&noteBody, "body", "", "Note content (skips the editor)")
+	noteCreateCmd.Flags().StringVar(&noteFile, "file", "", "Read note content from a file ('-' for stdin)")
+	noteCreateCmd.Flags().StringSliceVar(&noteTags, "tag", nil, "Tag the note (repeatable)")
+	noteCreateCmd.Flags().StringVar(&noteNotebook, "notebook", "", "File the note into a notebook")
+	noteCreateCmd.Flags().StringVarP(&noteTemplate, "template", "t", "", "Start from a note template (see 'note templates')")
+	noteCreateCmd.Flags().BoolVar(&encryptNote, "encrypt", false, "Encrypt the content with the vault key")
+	noteSettingsCmd.Flags().BoolVar(&alwaysEncrypt, "always-encrypt", false, "Encrypt every new note by default")
+	noteSettingsCmd.Flags().Int("keep-revisions", 0, "Revisions kept per note (0 = default of 50, -1 = keep all)")
+	noteSettingsCmd.Flags().String("ai-endpoint", "", "OpenAI-compatible API base URL, e.g. http://localhost:11434/v1")
+	noteSettingsCmd.Flags().String("ai-model", "", "Model name sent to the AI endpoint")
+	noteSettingsCmd.Flags().String("ai-key", "", "API key for the AI endpoint, saved in the vault (or a vault:// reference; "+aiKeyEnv+" overrides it)")
+	noteListCmd.Flags().StringSliceVar(&noteTags, "tag", nil, "Only notes with this tag (repeatable, all must match)")
+	noteListCmd.Flags().StringVar(&noteNotebook, "notebook", "", "Only notes in this notebook")
+	noteShowCmd.Flags().BoolVar(&rawNote, "raw", false, "Print only the Markdown source, exactly as stored")
+	noteShowCmd.Flags().BoolVar(&resolveRefs, "resolve", false, "Decrypt and substitute vault:// secret references")
+	noteEditCmd.Flags().StringVar(&renameTitle, "title", "", "Rename the note")
+	noteDeleteCmd.Flags().BoolVarP(&forceNote, "force", "f", false, "Delete without confirmation")
+
 	noteCmd.AddCommand(noteListCmd)
 	noteCmd.AddCommand(noteCreateCmd)
+	noteCmd.AddCommand(noteShowCmd)
+	noteCmd.AddCommand(noteEditCmd)
+	noteCmd.AddCommand(noteDeleteCmd)
+	noteCmd.AddCommand(noteSettingsCmd)
 	rootCmd.AddCommand(noteCmd)
 }
@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/attachments"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	gcDryRun        bool
+	attachPlaintext bool
+)
+
+// formatSize renders a byte count for humans.
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// storeFile copies r into the store, guessing its type from name and, failing
+// that, from its first bytes.
+func storeFile(store *attachments.Store, name string, r io.Reader) (notes.Attachment, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return notes.Attachment{}, err
+	}
+	head = head[:n]
+
+	a := notes.Attachment{Name: name, Mime: mime.TypeByExtension(strings.ToLower(filepath.Ext(name)))}
+	if a.Mime == "" {
+		a.Mime = http.DetectContentType(head)
+	}
+	a.Hash, a.Size, err = store.Put(io.MultiReader(bytes.NewReader(head), r))
+	return a, err
+}
+
+// attachmentFile is the file name an attachment gets outside the store.
+func attachmentFile(a *notes.Attachment) string {
+	ext := filepath.Ext(a.Name)
+	if ext == "" {
+		if exts, _ := mime.ExtensionsByType(a.Mime); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+	return a.Hash + strings.ToLower(ext)
+}
+
+// exportedAttachmentRe matches a Markdown link or embed pointing at a file
+// written by exportAttachments, capturing the text, the path and the hash.
+var exportedAttachmentRe = regexp.MustCompile(`(!?\[([^\]]*)\]\()([^)\s]*attachments/([0-9a-f]{64})[^)\s]*)\)`)
+
+// exportAttachments copies the files of r into dir/attachments and points the
+// note's links at them, relative to folder where the note is written.
+func exportAttachments(store *attachments.Store, r *notes.Record, dir, folder string) error {
+	if len(r.Attachments) == 0 {
+		return nil
+	}
+	target := filepath.Join(dir, "attachments")
+	if err := os.MkdirAll(target, 0700); err != nil {
+		return err
+	}
+	files := make(map[string]string)
+	for i := range r.Attachments {
+		a := &r.Attachments[i]
+		files[a.Hash] = attachmentFile(a)
+		if err := copyAttachment(store, a.Hash, filepath.Join(target, files[a.Hash])); err != nil {
+			return err
+		}
+	}
+	rel, err := filepath.Rel(folder, target)
+	if err != nil {
+		return err
+	}
+	r.Content = attachments.Rewrite(r.Content, func(hash string) string {
+		if file, ok := files[hash]; ok {
+			return filepath.ToSlash(filepath.Join(rel, file))
+		}
+		return attachments.URL(hash)
+	})
+	return nil
+}
+
+func copyAttachment(store *attachments.Store, hash, path string) error {
+	src, err := store.Open(hash)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// importAttachments stores the files a record brings along: the data embedded
+// in a JSON export, or the files a Markdown export links to from its
+// attachments folder (base is the folder of the Markdown file). Attachments
+// whose files cannot be found are dropped and counted.
+func importAttachments(store *attachments.Store, r *notes.Record, base string) (int, error) {
+	var kept []notes.Attachment
+	missing := 0
+	for _, a := range r.Attachments {
+		if a.Data != nil {
+			hash, _, err := store.Put(bytes.NewReader(a.Data))
+			if err != nil {
+				return 0, err
+			}
+			if hash != a.Hash {
+				return 0, fmt.Errorf("attachment %q of %q does not match its hash", a.Name, r.Title)
+			}
+			a.Data = nil
+		}
+		if !store.Has(a.Hash) {
+			missing++
+			continue
+		}
+		kept = append(kept, a)
+	}
+	r.Attachments = kept
+
+	if base == "" || r.Encrypted {
+		return missing, nil
+	}
+	var err error
+	r.Content = exportedAttachmentRe.ReplaceAllStringFunc(r.Content, func(s string) string {
+		m := exportedAttachmentRe.FindStringSubmatch(s)
+		f, openErr := os.Open(filepath.Join(base, filepath.FromSlash(m[3])))
+		if openErr != nil {
+			missing++
+			return s
+		}
+		defer f.Close()
+		name := m[2]
+		if name == "" {
+			name = filepath.Base(m[3])
+		}
+		a, putErr := storeFile(store, name, f)
+		if putErr != nil {
+			err = putErr
+			return s
+		}
+		r.Attachments = append(r.Attachments, a)
+		return m[1] + attachments.URL(a.Hash) + ")"
+	})
+	return missing, err
+}
+
+var noteAttachCmd = &cobra.Command{
+	Use:   "attach [id|title] [file]",
+	Short: "Attach a file to a note",
+	Long: `Copy a file into the attachment store and embed it at the end of the note as
+![name](kylrix://attach/<sha256>). Files are stored once however many notes
+use them; 'kylrix note gc' removes those no note refers to any more.
+
+Attachments are not encrypted, so attaching to an encrypted note is refused
+unless --plaintext confirms the file may be stored in the clear.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			if n.Encrypted && !attachPlaintext {
+				return fmt.Errorf("note %s is encrypted but attachments are stored unencrypted; pass --plaintext to attach anyway", n.UID)
+			}
+			f, err := os.Open(args[1])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			if info, err := f.Stat(); err != nil {
+				return err
+			} else if info.IsDir() {
+				return fmt.Errorf("%s is a directory", args[1])
+			}
+
+			store, err := attachments.Default()
+			if err != nil {
+				return err
+			}
+			a, err := storeFile(store, filepath.Base(args[1]), f)
+			if err != nil {
+				return err
+			}
+			if err := notes.Attach(q, n.ID, a); err != nil {
+				return err
+			}
+
+			mek := &lazyMEK{}
+			defer mek.Destroy()
+			content, err := noteContent(n, mek)
+			if err != nil {
+				return err
+			}
+			if !strings.Contains(content, attachments.URL(a.Hash)) {
+				if content = strings.TrimRight(content, "\n"); content != "" {
+					content += "\n\n"
+				}
+				if err := setNoteContent(n, content+a.Embed()+"\n", mek); err != nil {
+					return err
+				}
+				if err := saveNote(q, n); err != nil {
+					return err
+				}
+			}
+
+			utils.Success(fmt.Sprintf("Attached %s (%s) to note %s.", a.Name, formatSize(a.Size), n.UID))
+			return nil
+		})
+	},
+}
+
+var noteAttachmentsCmd = &cobra.Command{
+	Use:   "attachments [id|title]",
+	Short: "List the files attached to a note",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			list, err := notes.Attachments(q, n.ID)
+			if err != nil {
+				return err
+			}
+			store, err := attachments.Default()
+			if err != nil {
+				return err
+			}
+
+			utils.Banner(fmt.Sprintf("Kylrix Note - Attachments of %s", n.Title))
+			if len(list) == 0 {
+				utils.Info(fmt.Sprintf("No attachments. Add one with: kylrix note attach %s <file>", n.UID))
+				return nil
+			}
+			var data [][]string
+			for _, a := range list {
+				size := formatSize(a.Size)
+				if !store.Has(a.Hash) {
+					size = "missing"
+				}
+				data = append(data, []string{a.Hash[:12], a.Name, a.Mime, size, a.CreatedAt})
+			}
+			utils.Table([]string{"HASH", "NAME", "TYPE", "SIZE", "ADDED"}, data)
+			utils.Info(fmt.Sprintf("Files are stored in %s.", store.Dir))
+			return nil
+		})
+	},
+}
+
+var noteGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove attachments no note refers to",
+	Long: `Remove attached files that no note links to any more, because their notes were
+deleted or the links were removed. Files still linked from a note's history are
+kept until that history is pruned.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+		store, err := attachments.Default()
+		if err != nil {
+			return err
+		}
+
+		var unused []string
+		if gcDryRun {
+			unused, err = notes.UnusedAttachments(database)
+		} else {
+			unused, err = pruneAttachments(database)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Files without a row were left behind by an interrupted attach.
+		known, err := notes.KnownAttachments(database)
+		if err != nil {
+			return err
+		}
+		stored, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, hash := range unused {
+			known[hash] = false
+		}
+		for _, hash := range stored {
+			if _, ok := known[hash]; !ok {
+				unused = append(unused, hash)
+			}
+		}
+
+		var freed int64
+		for _, hash := range unused {
+			if gcDryRun {
+				if info, err := os.Stat(store.Path(hash)); err == nil {
+					freed += info.Size()
+				}
+				continue
+			}
+			size, err := store.Remove(hash)
+			if err != nil {
+				return err
+			}
+			freed += size
+		}
+
+		switch {
+		case len(unused) == 0:
+			utils.Info("No unused attachments.")
+		case gcDryRun:
+			utils.Info(fmt.Sprintf("Would remove %d unused attachments (%s).", len(unused), formatSize(freed)))
+		default:
+			utils.Success(fmt.Sprintf("Removed %d unused attachments (%s).", len(unused), formatSize(freed)))
+		}
+		return nil
+	},
+}
+
+func pruneAttachments(database *sql.DB) ([]string, error) {
+	tx, err := database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	hashes, err := notes.PruneAttachments(tx)
+	if err != nil {
+		return nil, err
+	}
+	return hashes, tx.Commit()
+}
+
+func init() {
+	noteAttachCmd.Flags().BoolVar(&attachPlaintext, "plaintext", false, "Attach to an encrypted note even though the file is stored unencrypted")
+	noteGCCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Only report what would be removed")
+
+	noteCmd.AddCommand(noteAttachCmd)
+	noteCmd.AddCommand(noteAttachmentsCmd)
+	noteCmd.AddCommand(noteGCCmd)
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nathfavour/kylrix/cli/pkg/crypto"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+)
+
+// Encrypted notes use the same envelope as vault secrets (crypto.Encrypt under
+// the MEK), matching the E2E format of the Kylrix web Note app.
+
+// noteContent returns the plaintext of n, unlocking the vault only when the
+// note is encrypted.
+func noteContent(n *notes.Note, mek *lazyMEK) (string, error) {
+	if !n.Encrypted {
+		return n.Content, nil
+	}
+	key, err := mek.Get()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := crypto.Decrypt(n.Content, key.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("note %s: %w", n.UID, err)
+	}
+	defer plaintext.Destroy()
+
+	var content string
+	if err := plaintext.Unmarshal(&content); err != nil {
+		return "", fmt.Errorf("note %s: %w", n.UID, err)
+	}
+	return content, nil
+}
+
+// setNoteContent stores content in n, encrypting it when n.Encrypted is set.
+func setNoteContent(n *notes.Note, content string, mek *lazyMEK) error {
+	if !n.Encrypted {
+		n.Content = content
+		return nil
+	}
+	key, err := mek.Get()
+	if err != nil {
+		return err
+	}
+	sealed, err := crypto.Encrypt(content, key.Bytes())
+	if err != nil {
+		return err
+	}
+	n.Content = sealed
+	return nil
+}
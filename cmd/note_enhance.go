@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/ai"
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/crypto"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/diff"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/secretref"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var enhanceMode string
+
+// errEncryptedEnhance keeps E2E-encrypted content from leaving the machine.
+var errEncryptedEnhance = errors.New("refusing to send encrypted note content to an AI provider")
+
+const (
+	// aiKeyEnv names the environment variable that overrides the AI API key.
+	aiKeyEnv = "KYLRIX_AI_API_KEY"
+	// aiKeySecret is the vault entry 'note settings --ai-key' saves the key in.
+	aiKeySecret = "ai-api-key"
+)
+
+// saveAIKey keeps an AI API key out of the config: a vault:// reference is
+// returned as is, any other key is encrypted into the vault and a reference
+// to it returned instead. An empty key clears the setting.
+func saveAIKey(key string) (string, error) {
+	if key == "" || len(secretref.Find(key)) > 0 {
+		return key, nil
+	}
+	database, err := db.InitDB()
+	if err != nil {
+		return "", err
+	}
+	defer database.Close()
+	mek := &lazyMEK{}
+	defer mek.Destroy()
+	mk, err := mek.Get()
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := crypto.Encrypt(key, mk.Bytes())
+	if err != nil {
+		return "", err
+	}
+	_, err = database.Exec("INSERT OR REPLACE INTO vault_secrets (name, payload) VALUES (?, ?)", aiKeySecret, encrypted)
+	if err != nil {
+		return "", err
+	}
+	return secretref.Scheme + aiKeySecret, nil
+}
+
+// aiAPIKey returns the key for the AI endpoint: from aiKeyEnv if set, else
+// the vault secret the config refers to. A key left in the config in
+// plaintext by earlier versions is still used, with a warning.
+func aiAPIKey(cfg *config.AIConfig) (string, error) {
+	if key, ok := os.LookupEnv(aiKeyEnv); ok {
+		return key, nil
+	}
+	if cfg == nil || cfg.APIKey == "" {
+		return "", nil
+	}
+	if len(secretref.Find(cfg.APIKey)) == 0 {
+		utils.Warning("The AI API key is stored in plaintext in the config; move it into the vault with 'kylrix note settings --ai-key KEY'.")
+		return cfg.APIKey, nil
+	}
+	database, err := db.InitDB()
+	if err != nil {
+		return "", err
+	}
+	defer database.Close()
+	mek := &lazyMEK{}
+	defer mek.Destroy()
+	return resolveSecretRefs(database, cfg.APIKey, mek)
+}
+
+// enhanceContent runs the configured Enhancer on original and shows the diff.
+// ok is false when the user declines the enhanced version.
+func enhanceContent(ctx context.Context, original string) (enhanced string, ok bool, err error) {
+	mode, err := ai.ParseMode(enhanceMode)
+	if err != nil {
+		return "", false, err
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", false, err
+	}
+	key, err := aiAPIKey(cfg.AI)
+	if err != nil {
+		return "", false, err
+	}
+	enhancer, err := ai.NewEnhancer(cfg.AI, key)
+	if err != nil {
+		return "", false, err
+	}
+
+	utils.Info(fmt.Sprintf("Enhancing note with AI (%s)...", mode))
+	enhanced, err = enhancer.Enhance(ctx, mode, original)
+	if err != nil {
+		return "", false, err
+	}
+
+	changes := diff.Unified(original, enhanced, "original", "enhanced", 3)
+	if changes == "" {
+		utils.Info("The AI suggested no changes.")
+		return original, false, nil
+	}
+	utils.PrintDiff(changes)
+	return enhanced, utils.Confirm("Save the enhanced version"), nil
+}
+
+// applyEnhancement saves the enhanced content of n. The revision trigger keeps
+// the previous content; its revision number is returned.
+func applyEnhancement(q db.Querier, n *notes.Note, enhanced string) (int, error) {
+	n.Content = enhanced
+	if err := saveNote(q, n); err != nil {
+		return 0, err
+	}
+	return notes.LatestRevision(q, n.ID)
+}
+
+var noteEnhanceCmd = &cobra.Command{
+	Use:   "enhance [id|title]",
+	Short: "Rewrite a note with the configured AI provider",
+	Long: fmt.Sprintf(`Rewrite a note with the configured AI provider (see 'note settings').
+The previous content is kept as a revision and a diff is shown before saving.
+
+Modes: %s`, strings.Join(ai.Modes(), ", ")),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		n, err := notes.Get(database, args[0])
+		if err != nil {
+			return err
+		}
+		if n.Encrypted {
+			return errEncryptedEnhance
+		}
+
+		enhanced, ok, err := enhanceContent(cmd.Context(), n.Content)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			utils.Info("Note left unchanged.")
+			return nil
+		}
+
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		rev, err := applyEnhancement(tx, n, enhanced)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		utils.Success(fmt.Sprintf("Note %s enhanced; previous content kept as revision %d.", n.UID, rev))
+		return nil
+	},
+}
+
+func init() {
+	noteEnhanceCmd.Flags().StringVarP(&enhanceMode, "mode", "m", string(ai.ModeGrammar), "Enhancement mode")
+	noteCreateCmd.Flags().StringVarP(&enhanceMode, "mode", "m", string(ai.ModeGrammar), "Enhancement mode used with --enhance")
+	noteCmd.AddCommand(noteEnhanceCmd)
+}
@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/diff"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffFrom   string
+	diffTo     string
+	restoreRev int
+)
+
+// saveNote updates n and trims the revision history to the configured limit.
+// The revision itself is recorded by the notes_revision trigger.
+func saveNote(q db.Querier, n *notes.Note) error {
+	if err := notes.Update(q, n); err != nil {
+		return err
+	}
+	return notes.PruneRevisions(q, revisionLimit())
+}
+
+func revisionLimit() int {
+	cfg, err := config.LoadConfig()
+	if err != nil || cfg.NoteRevisionLimit == 0 {
+		return notes.DefaultRevisionLimit
+	}
+	return cfg.NoteRevisionLimit
+}
+
+// noteVersion resolves a --from/--to value ("current", "N" or "rN") to a note
+// value holding that version.
+func noteVersion(q db.Querier, n *notes.Note, ref string) (*notes.Note, string, error) {
+	ref = strings.ToLower(ref)
+	if ref == "" || ref == "current" {
+		return n, "current", nil
+	}
+	rev, err := strconv.Atoi(strings.TrimPrefix(ref, "r"))
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid revision %q", ref)
+	}
+	r, err := notes.GetRevision(q, n.ID, rev)
+	if err != nil {
+		return nil, "", err
+	}
+	return r.AsNote(n), fmt.Sprintf("r%d", rev), nil
+}
+
+var noteHistoryCmd = &cobra.Command{
+	Use:   "history [id|title]",
+	Short: "List the saved revisions of a note",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			revs, err := notes.Revisions(q, n.ID)
+			if err != nil {
+				return err
+			}
+
+			utils.Banner(fmt.Sprintf("Kylrix Note - History of %s", n.UID))
+			if len(revs) == 0 {
+				utils.Info("No earlier revisions.")
+				return nil
+			}
+			header := []string{"REV", "TITLE", "SAVED", "SIZE"}
+			var data [][]string
+			for _, r := range revs {
+				data = append(data, []string{fmt.Sprintf("r%d", r.Rev), noteLabel(r.AsNote(n)), r.CreatedAt, revisionSize(&r)})
+			}
+			data = append(data, []string{"current", noteLabel(n), n.UpdatedAt, fmt.Sprintf("%d B", len(n.Content))})
+			utils.Table(header, data)
+			return nil
+		})
+	},
+}
+
+func revisionSize(r *notes.Revision) string {
+	if r.Encrypted {
+		return "encrypted"
+	}
+	return fmt.Sprintf("%d B", len(r.Content))
+}
+
+var noteDiffCmd = &cobra.Command{
+	Use:   "diff [id|title]",
+	Short: "Show the changes between two revisions of a note",
+	Long: `Show a unified diff between two versions of a note. --from defaults to the
+latest revision and --to to the current note. Versions are revision numbers
+("3" or "r3") or "current".`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			from := diffFrom
+			if from == "" {
+				latest, err := notes.LatestRevision(q, n.ID)
+				if err != nil {
+					return err
+				}
+				if latest == 0 {
+					utils.Info("No earlier revisions.")
+					return nil
+				}
+				from = strconv.Itoa(latest)
+			}
+			a, fromLabel, err := noteVersion(q, n, from)
+			if err != nil {
+				return err
+			}
+			b, toLabel, err := noteVersion(q, n, diffTo)
+			if err != nil {
+				return err
+			}
+
+			mek := &lazyMEK{}
+			defer mek.Destroy()
+			before, err := noteContent(a, mek)
+			if err != nil {
+				return err
+			}
+			after, err := noteContent(b, mek)
+			if err != nil {
+				return err
+			}
+
+			if a.Title != b.Title {
+				utils.Info(fmt.Sprintf("Title: %q → %q", a.Title, b.Title))
+			}
+			changes := diff.Unified(before, after, fromLabel, toLabel, 3)
+			if changes == "" {
+				utils.Info("Content is identical.")
+				return nil
+			}
+			utils.PrintDiff(changes)
+			return nil
+		})
+	},
+}
+
+var noteRestoreCmd = &cobra.Command{
+	Use:   "restore [id|title]",
+	Short: "Restore a note to an earlier revision",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if restoreRev <= 0 {
+			return fmt.Errorf("--rev is required")
+		}
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			r, err := notes.GetRevision(q, n.ID, restoreRev)
+			if err != nil {
+				return err
+			}
+			if r.Title == n.Title && r.Content == n.Content && r.Encrypted == n.Encrypted {
+				utils.Info(fmt.Sprintf("Note %s already matches r%d.", n.UID, r.Rev))
+				return nil
+			}
+			n.Title, n.Content, n.Encrypted = r.Title, r.Content, r.Encrypted
+			if err := saveNote(q, n); err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Note %s restored to r%d (the previous version was kept in history).", n.UID, r.Rev))
+			return nil
+		})
+	},
+}
+
+func init() {
+	noteDiffCmd.Flags().StringVar(&diffFrom, "from", "", "Revision to diff from (default: latest revision)")
+	noteDiffCmd.Flags().StringVar(&diffTo, "to", "current", "Revision to diff to")
+	noteRestoreCmd.Flags().IntVar(&restoreRev, "rev", 0, "Revision number to restore")
+
+	noteCmd.AddCommand(noteHistoryCmd)
+	noteCmd.AddCommand(noteDiffCmd)
+	noteCmd.AddCommand(noteRestoreCmd)
+}
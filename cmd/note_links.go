@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var graphFormat string
+
+var noteBacklinksCmd = &cobra.Command{
+	Use:   "backlinks [id|title]",
+	Short: "List the notes that link to a note",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			list, err := notes.Backlinks(q, n)
+			if err != nil {
+				return err
+			}
+
+			utils.Banner(fmt.Sprintf("Kylrix Note - Backlinks to %s", n.Title))
+			if len(list) == 0 {
+				utils.Info(fmt.Sprintf("No notes link to this one yet. Link to it with [[%s]] or [[%s]].", n.Title, n.UID))
+				return nil
+			}
+			var data [][]string
+			for i := range list {
+				data = append(data, []string{list[i].UID, noteLabel(&list[i]), list[i].UpdatedAt})
+			}
+			utils.Table([]string{"ID", "TITLE", "UPDATED"}, data)
+			return nil
+		})
+	},
+}
+
+var noteGraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Export the note link graph as Graphviz DOT or JSON",
+	Long: `Print every note and the [[links]] between them. Render the DOT output with
+Graphviz, e.g. kylrix note graph | dot -Tsvg > notes.svg`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if graphFormat != "dot" && graphFormat != "json" {
+			return fmt.Errorf("unknown format %q (use dot or json)", graphFormat)
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		list, err := notes.List(database, notes.Filter{})
+		if err != nil {
+			return err
+		}
+		edges, err := notes.Edges(database)
+		if err != nil {
+			return err
+		}
+
+		if graphFormat == "json" {
+			type node struct {
+				ID    string `json:"id"`
+				Title string `json:"title"`
+			}
+			graph := struct {
+				Nodes []node       `json:"nodes"`
+				Edges []notes.Edge `json:"edges"`
+			}{Nodes: []node{}, Edges: edges}
+			if graph.Edges == nil {
+				graph.Edges = []notes.Edge{}
+			}
+			for _, n := range list {
+				graph.Nodes = append(graph.Nodes, node{n.UID, n.Title})
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(graph)
+		}
+
+		fmt.Println("digraph notes {")
+		fmt.Println("  node [shape=box];")
+		for _, n := range list {
+			fmt.Printf("  %s [label=%s];\n", strconv.Quote(n.UID), strconv.Quote(n.Title))
+		}
+		for _, e := range edges {
+			fmt.Printf("  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+		}
+		fmt.Println("}")
+		return nil
+	},
+}
+
+var noteLintCmd = &cobra.Command{
+	Use:          "lint",
+	Short:        "Report [[links]] that point to no note",
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		broken, err := notes.BrokenLinks(database)
+		if err != nil {
+			return err
+		}
+
+		utils.Banner("Kylrix Note - Lint")
+		if len(broken) == 0 {
+			utils.Success("No broken links.")
+			return nil
+		}
+		var data [][]string
+		for _, b := range broken {
+			data = append(data, []string{b.Source.UID, b.Source.Title, "[[" + b.Target + "]]"})
+		}
+		utils.Table([]string{"ID", "NOTE", "BROKEN LINK"}, data)
+		return fmt.Errorf("%d broken links", len(broken))
+	},
+}
+
+func init() {
+	noteGraphCmd.Flags().StringVar(&graphFormat, "format", "dot", "Output format: dot or json")
+
+	noteCmd.AddCommand(noteBacklinksCmd)
+	noteCmd.AddCommand(noteGraphCmd)
+	noteCmd.AddCommand(noteLintCmd)
+}
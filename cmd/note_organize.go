@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+// withNote opens the database, resolves ref and runs fn on the note.
+func withNote(ref string, fn func(q db.Querier, n *notes.Note) error) error {
+	database, err := db.InitDB()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	n, err := notes.Get(database, ref)
+	if err != nil {
+		return err
+	}
+	return fn(database, n)
+}
+
+var noteTagCmd = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage note tags",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var noteTagAddCmd = &cobra.Command{
+	Use:   "add [id|title] [tag...]",
+	Short: "Add tags to a note",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			if err := notes.AddTags(q, n.ID, args[1:]...); err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Tagged note %s.", n.UID))
+			return nil
+		})
+	},
+}
+
+var noteTagRemoveCmd = &cobra.Command{
+	Use:   "remove [id|title] [tag...]",
+	Short: "Remove tags from a note",
+	Args:  cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			if err := notes.RemoveTags(q, n.ID, args[1:]...); err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Untagged note %s.", n.UID))
+			return nil
+		})
+	},
+}
+
+var noteTagListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tags with their note counts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		tags, err := notes.TagCounts(database)
+		if err != nil {
+			return err
+		}
+		printCounts("Kylrix Note - Tags", "TAG", tags, "No tags yet.")
+		return nil
+	},
+}
+
+var noteNotebooksCmd = &cobra.Command{
+	Use:   "notebooks",
+	Short: "List notebooks with their note counts",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		notebooks, err := notes.NotebookCounts(database)
+		if err != nil {
+			return err
+		}
+		printCounts("Kylrix Note - Notebooks", "NOTEBOOK", notebooks, "No notebooks yet.")
+		return nil
+	},
+}
+
+func printCounts(banner, label string, counts []notes.Count, empty string) {
+	utils.Banner(banner)
+	if len(counts) == 0 {
+		utils.Info(empty)
+		return
+	}
+	var data [][]string
+	for _, c := range counts {
+		data = append(data, []string{c.Name, strconv.Itoa(c.Notes)})
+	}
+	utils.Table([]string{label, "NOTES"}, data)
+}
+
+var noteMoveCmd = &cobra.Command{
+	Use:   "move [id|title] [notebook]",
+	Short: "File a note into a notebook (\"\" to remove it from its notebook)",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+			if err := notes.SetNotebook(q, n.ID, args[1]); err != nil {
+				return err
+			}
+			utils.Success(fmt.Sprintf("Note %s moved.", n.UID))
+			return nil
+		})
+	},
+}
+
+func pinCommand(use, short string, pinned bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " [id|title]",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withNote(args[0], func(q db.Querier, n *notes.Note) error {
+				if err := notes.SetPinned(q, n.ID, pinned); err != nil {
+					return err
+				}
+				utils.Success(fmt.Sprintf("Note %s %sned.", n.UID, use))
+				return nil
+			})
+		},
+	}
+}
+
+func init() {
+	noteTagCmd.AddCommand(noteTagAddCmd)
+	noteTagCmd.AddCommand(noteTagRemoveCmd)
+	noteTagCmd.AddCommand(noteTagListCmd)
+
+	noteCmd.AddCommand(noteTagCmd)
+	noteCmd.AddCommand(noteNotebooksCmd)
+	noteCmd.AddCommand(noteMoveCmd)
+	noteCmd.AddCommand(pinCommand("pin", "Pin a note to the top of listings", true))
+	noteCmd.AddCommand(pinCommand("unpin", "Unpin a note", false))
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	searchLimit   int
+	searchDecrypt bool
+)
+
+var snippetMark = regexp.MustCompile(notes.MarkStart + "(.*?)" + notes.MarkEnd)
+
+// highlightSnippet turns FTS snippet markers into terminal emphasis.
+func highlightSnippet(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	return snippetMark.ReplaceAllStringFunc(s, func(m string) string {
+		return utils.Emphasize(strings.TrimSuffix(strings.TrimPrefix(m, notes.MarkStart), notes.MarkEnd))
+	})
+}
+
+// searchEncryptedNotes decrypts encrypted notes in memory and appends those
+// matching q. Nothing decrypted is written back or indexed.
+func searchEncryptedNotes(q db.Querier, query notes.Query, results []notes.SearchResult) ([]notes.SearchResult, error) {
+	encrypted, err := notes.List(q, notes.Filter{Encrypted: true})
+	if err != nil || len(encrypted) == 0 {
+		return results, err
+	}
+
+	seen := map[int64]int{}
+	for i, r := range results {
+		seen[r.ID] = i
+	}
+
+	mek := &lazyMEK{}
+	defer mek.Destroy()
+	for i := range encrypted {
+		n := &encrypted[i]
+		content, err := noteContent(n, mek)
+		if err != nil {
+			return nil, err
+		}
+		snippet, ok := notes.MatchPlaintext(query, n, content)
+		if !ok {
+			continue
+		}
+		// A title hit already came from the index; improve its snippet.
+		if at, found := seen[n.ID]; found {
+			results[at].Snippet = snippet
+			continue
+		}
+		results = append(results, notes.SearchResult{Note: *n, Snippet: snippet})
+	}
+	return results, nil
+}
+
+var noteSearchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "Full-text search over notes",
+	Long: `Search notes, best matches first.
+
+Words are matched anywhere in the title or content; "quoted phrases" must
+appear together and a trailing * matches a prefix (deploy*). Field filters:
+  title:<word>   only match in the title
+  tag:<name>     only notes tagged #name
+
+Encrypted notes are only matched by title unless --decrypt is given, which
+unlocks the vault and searches their content in memory.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := notes.ParseQuery(strings.Join(args, " "))
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		results, err := notes.Search(database, query, 0)
+		if err != nil {
+			return err
+		}
+		if searchDecrypt {
+			results, err = searchEncryptedNotes(database, query, results)
+			if err != nil {
+				return err
+			}
+		}
+		if searchLimit > 0 && len(results) > searchLimit {
+			results = results[:searchLimit]
+		}
+
+		utils.Banner("Kylrix Note - Search")
+		if len(results) == 0 {
+			utils.Info("No matching notes.")
+			return nil
+		}
+		for _, r := range results {
+			fmt.Printf("%s  %s\n", r.UID, utils.Emphasize(r.Title))
+			if r.Snippet != "" {
+				fmt.Printf("    %s\n", highlightSnippet(r.Snippet))
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	noteSearchCmd.Flags().IntVarP(&searchLimit, "limit", "n", 20, "Maximum number of results (0 for all)")
+	noteSearchCmd.Flags().BoolVar(&searchDecrypt, "decrypt", false, "Also search the content of encrypted notes")
+	noteCmd.AddCommand(noteSearchCmd)
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api"
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/notesync"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var noteSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Sync notes with the Kylrix Note backend",
+	Long: `Pull the notes changed on the server since the last sync, then push local
+changes. Edits made on both sides are merged line by line; when they touch the
+same lines the server version is kept and the local one is saved as a
+"(conflict ...)" copy, which is synced as well.
+
+Encrypted notes are synced as ciphertext.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.APIKey == "" && cfg.Token == "" {
+			return fmt.Errorf("not logged in; use 'kylrix login' to authenticate")
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		utils.Banner("Kylrix Note - Sync")
+		report, err := notesync.New(api.NewClient(cfg), database).Sync()
+		if err != nil {
+			return err
+		}
+		if err := notes.PruneRevisions(database, revisionLimit()); err != nil {
+			return err
+		}
+
+		utils.Success(fmt.Sprintf("Synced with %s: %d pulled, %d pushed, %d merged, %d deleted.",
+			cfg.BaseURI, report.Pulled, report.Pushed, report.Merged, report.Deleted))
+		for _, title := range report.Conflicts {
+			utils.Warning(fmt.Sprintf("Conflicting edits kept as %q.", title))
+		}
+		return nil
+	},
+}
+
+func init() {
+	noteCmd.AddCommand(noteSyncCmd)
+}
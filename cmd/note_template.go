@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/templates"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var dailyTemplate string
+
+// renderedNote is a template rendered for a new note.
+type renderedNote struct {
+	Title    string
+	Notebook string
+	Tags     []string
+	Content  string
+}
+
+// loadTemplate reads a template from the templates folder. Its prompt fields
+// are answered through utils.Prompt.
+func loadTemplate(name string) (*templates.Template, *templates.Context, error) {
+	dir, err := config.GetTemplatesDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl, err := templates.Load(dir, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tmpl, templates.NewContext(utils.Prompt), nil
+}
+
+// templateTitle renders the title a template gives its notes, falling back to
+// "<name> <date>". It never prompts unless the title itself asks a question.
+func templateTitle(tmpl *templates.Template, ctx *templates.Context) (string, error) {
+	if tmpl.Title == "" {
+		return fmt.Sprintf("%s %s", tmpl.Name, ctx.Now.Format(templates.DateLayout)), nil
+	}
+	title, err := ctx.Render(tmpl.Name+" title", tmpl.Title)
+	return strings.TrimSpace(title), err
+}
+
+// renderTemplate renders the notebook and body of tmpl for a note titled title.
+func renderTemplate(tmpl *templates.Template, ctx *templates.Context, title string) (*renderedNote, error) {
+	ctx.Title = title
+	notebook, err := ctx.Render(tmpl.Name+" notebook", tmpl.Notebook)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ctx.Render(tmpl.Name, tmpl.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &renderedNote{Title: title, Notebook: strings.TrimSpace(notebook), Tags: tmpl.Tags, Content: content}, nil
+}
+
+// contentFromTemplate renders --template for note create, merging its tags and
+// notebook into the flags. The result is opened in $EDITOR for review unless
+// stdin is piped (answers to prompts can be piped in for scripting).
+func contentFromTemplate(cmd *cobra.Command, title string) (string, string, error) {
+	if cmd.Flags().Changed("body") || noteFile != "" {
+		return "", "", errors.New("--template cannot be combined with --body or --file")
+	}
+	tmpl, ctx, err := loadTemplate(noteTemplate)
+	if err != nil {
+		return "", "", err
+	}
+	if title == "" {
+		if title, err = templateTitle(tmpl, ctx); err != nil {
+			return "", "", err
+		}
+	}
+	rendered, err := renderTemplate(tmpl, ctx, title)
+	if err != nil {
+		return "", "", err
+	}
+
+	content := rendered.Content
+	if !utils.StdinIsPiped() {
+		if content, err = utils.EditText(content, ".md"); err != nil {
+			return "", "", err
+		}
+		if strings.TrimSpace(content) == "" {
+			return "", "", errors.New("empty note, aborting")
+		}
+	}
+	noteTags = append(noteTags, rendered.Tags...)
+	if noteNotebook == "" {
+		noteNotebook = rendered.Notebook
+	}
+	return title, content, nil
+}
+
+var noteDailyCmd = &cobra.Command{
+	Use:   "daily",
+	Short: "Open today's journal note, creating it from the daily template",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tmpl, ctx, err := loadTemplate(dailyTemplate)
+		if err != nil {
+			return err
+		}
+		title, err := templateTitle(tmpl, ctx)
+		if err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		n, err := notes.Get(database, title)
+		if errors.Is(err, notes.ErrNotFound) {
+			n, err = createDaily(database, tmpl, ctx, title)
+		}
+		if err != nil {
+			return err
+		}
+
+		if utils.StdinIsPiped() || !utils.StdoutIsTerminal() {
+			utils.Info(fmt.Sprintf("Today's note: %s (%s)", n.Title, n.UID))
+			return nil
+		}
+		return editNote(database, n, "")
+	},
+}
+
+func createDaily(database *sql.DB, tmpl *templates.Template, ctx *templates.Context, title string) (*notes.Note, error) {
+	rendered, err := renderTemplate(tmpl, ctx, title)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	draft := notes.Note{Title: title, Encrypted: cfg.AlwaysEncryptNotes}
+	mek := &lazyMEK{}
+	defer mek.Destroy()
+	if err := setNoteContent(&draft, rendered.Content, mek); err != nil {
+		return nil, err
+	}
+
+	tx, err := database.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	n, err := notes.Create(tx, draft)
+	if err != nil {
+		return nil, err
+	}
+	if err := notes.AddTags(tx, n.ID, rendered.Tags...); err != nil {
+		return nil, err
+	}
+	if err := notes.SetNotebook(tx, n.ID, rendered.Notebook); err != nil {
+		return nil, err
+	}
+	if n, err = notes.GetByID(tx, n.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	utils.Success(fmt.Sprintf("Created today's note %s.", n.UID))
+	return n, nil
+}
+
+var noteTemplatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List note templates",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := config.GetTemplatesDir()
+		if err != nil {
+			return err
+		}
+		names, err := templates.List(dir)
+		if err != nil {
+			return err
+		}
+
+		utils.Banner("Kylrix Note - Templates")
+		var data [][]string
+		for _, name := range names {
+			file := filepath.Join(dir, name+".md")
+			if _, err := os.Stat(file); err != nil {
+				file = "(built in, written on first use)"
+			}
+			data = append(data, []string{name, file})
+		}
+		utils.Table([]string{"NAME", "FILE"}, data)
+		utils.Info(fmt.Sprintf("Add your own as <name>.md in %s", dir))
+		return nil
+	},
+}
+
+func init() {
+	noteDailyCmd.Flags().StringVar(&dailyTemplate, "template", "daily", "Template for new daily notes")
+
+	noteCmd.AddCommand(noteDailyCmd)
+	noteCmd.AddCommand(noteTemplatesCmd)
+}
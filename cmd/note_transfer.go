@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/attachments"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat  string
+	exportOut     string
+	exportDecrypt bool
+)
+
+// fileName makes a title safe to use as a file or directory name while keeping
+// it readable, since Obsidian uses the file name as the note title.
+func fileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '-'
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
+
+var noteExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export notes as Markdown files or JSON",
+	Long: `Export every note. --format md writes one Markdown file per note with YAML
+front matter into --out, one folder per notebook. --format json writes a single
+JSON array to --out, or to stdout when --out is omitted. Attached files go into
+an attachments folder next to the notes, or are embedded in the JSON.
+
+Encrypted notes are exported as ciphertext unless --decrypt is given. Decrypted
+notes are exported without their ID, so importing them creates new plaintext
+notes instead of replacing the encrypted ones.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if exportFormat != "md" && exportFormat != "json" {
+			return fmt.Errorf("unknown format %q (use md or json)", exportFormat)
+		}
+		if exportFormat == "md" && exportOut == "" {
+			return fmt.Errorf("--out is required for Markdown export")
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		list, err := notes.List(database, notes.Filter{})
+		if err != nil {
+			return err
+		}
+
+		store, err := attachments.Default()
+		if err != nil {
+			return err
+		}
+
+		mek := &lazyMEK{}
+		defer mek.Destroy()
+
+		records := make([]notes.Record, 0, len(list))
+		encrypted, decrypted := 0, 0
+		for i := range list {
+			r := notes.NewRecord(&list[i])
+			if r.Encrypted {
+				if exportDecrypt {
+					if r.Content, err = noteContent(&list[i], mek); err != nil {
+						return err
+					}
+					r.Encrypted = false
+					r.ID = ""
+					decrypted++
+				} else {
+					encrypted++
+				}
+			}
+			if r.Attachments, err = notes.Attachments(database, list[i].ID); err != nil {
+				return err
+			}
+			if exportFormat == "json" {
+				for j := range r.Attachments {
+					if r.Attachments[j].Data, err = os.ReadFile(store.Path(r.Attachments[j].Hash)); err != nil {
+						return err
+					}
+				}
+			}
+			records = append(records, r)
+		}
+
+		if exportFormat == "json" {
+			data, err := json.MarshalIndent(records, "", "  ")
+			if err != nil {
+				return err
+			}
+			data = append(data, '\n')
+			if exportOut == "" || exportOut == "-" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(exportOut, data, 0600); err != nil {
+				return err
+			}
+		} else if err := exportMarkdown(store, records, exportOut); err != nil {
+			return err
+		}
+
+		if exportOut != "" && exportOut != "-" {
+			utils.Success(fmt.Sprintf("Exported %d notes to %s.", len(records), exportOut))
+		}
+		if encrypted > 0 {
+			utils.Info(fmt.Sprintf("%d encrypted notes were exported as ciphertext (use --decrypt for plaintext).", encrypted))
+		}
+		if decrypted > 0 {
+			utils.Warning(fmt.Sprintf("%d encrypted notes were exported as plaintext without their IDs; importing them creates new, unencrypted notes.", decrypted))
+		}
+		return nil
+	},
+}
+
+// exportMarkdown writes one file per record under dir, in a folder per notebook,
+// and the attached files into dir/attachments.
+func exportMarkdown(store *attachments.Store, records []notes.Record, dir string) error {
+	used := make(map[string]bool)
+	for i, r := range records {
+		folder := dir
+		for _, part := range strings.Split(r.Notebook, "/") {
+			if part != "" {
+				folder = filepath.Join(folder, fileName(part))
+			}
+		}
+		path := filepath.Join(folder, fileName(r.Title)+".md")
+		if used[strings.ToLower(path)] {
+			suffix := r.ID
+			if suffix == "" {
+				suffix = strconv.Itoa(i + 1)
+			}
+			path = filepath.Join(folder, fmt.Sprintf("%s (%s).md", fileName(r.Title), suffix))
+		}
+		used[strings.ToLower(path)] = true
+
+		// Notes can be private; keep the export readable by the user only.
+		if err := os.MkdirAll(folder, 0700); err != nil {
+			return err
+		}
+		if err := exportAttachments(store, &r, dir, folder); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(r.Markdown()), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readImport loads the records at path: a JSON export, a single Markdown file,
+// or a folder of Markdown files such as an Obsidian vault. Attached files are
+// copied into store; the number that could not be found is returned.
+func readImport(store *attachments.Store, path string) ([]notes.Record, int, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var records []notes.Record
+	missing := 0
+	add := func(r notes.Record, base string) error {
+		n, err := importAttachments(store, &r, base)
+		missing += n
+		records = append(records, r)
+		return err
+	}
+
+	if !info.IsDir() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		if strings.EqualFold(filepath.Ext(path), ".json") {
+			var list []notes.Record
+			if err := json.Unmarshal(data, &list); err != nil {
+				return nil, 0, fmt.Errorf("%s: %w", path, err)
+			}
+			for _, r := range list {
+				if err := add(r, ""); err != nil {
+					return nil, 0, err
+				}
+			}
+			return records, missing, nil
+		}
+		err = add(markdownRecord(path, "", data, info), filepath.Dir(path))
+		return records, missing, err
+	}
+
+	err = filepath.WalkDir(path, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Skip .obsidian, .trash, .git and other hidden entries.
+		if strings.HasPrefix(d.Name(), ".") && file != path {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(file), ".md") {
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(path, filepath.Dir(file))
+		return add(markdownRecord(file, filepath.ToSlash(rel), data, info), filepath.Dir(file))
+	})
+	return records, missing, err
+}
+
+// markdownRecord parses a Markdown file. Files without front matter take their
+// notebook from the folder they are in and their timestamps from the file.
+func markdownRecord(file, folder string, data []byte, info fs.FileInfo) notes.Record {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	r := notes.ParseMarkdown(string(data), name)
+	if r.Notebook == "" && folder != "." {
+		r.Notebook = folder
+	}
+	if r.Updated == "" {
+		r.Updated = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	if r.Created == "" {
+		r.Created = r.Updated
+	}
+	return r
+}
+
+var noteImportCmd = &cobra.Command{
+	Use:   "import [path]",
+	Short: "Import notes from Markdown files, an Obsidian vault or a JSON export",
+	Long: `Import notes from a folder of Markdown files (including Obsidian vaults), a
+single Markdown file, or a JSON file written by 'note export --format json'.
+
+Notes carrying a Kylrix id update the matching note, keeping the previous
+version in its history; identical notes are skipped. Other files become new
+notes, titled after the file and filed into a notebook named after their folder.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := attachments.Default()
+		if err != nil {
+			return err
+		}
+		records, missing, err := readImport(store, args[0])
+		if err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		var created, updated, unchanged int
+		for _, r := range records {
+			_, result, err := notes.Import(tx, r)
+			if err != nil {
+				return fmt.Errorf("importing %q: %w", r.Title, err)
+			}
+			switch result {
+			case notes.Created:
+				created++
+			case notes.Updated:
+				updated++
+			default:
+				unchanged++
+			}
+		}
+		if err := notes.PruneRevisions(tx, revisionLimit()); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		utils.Success(fmt.Sprintf("Imported %d notes: %d new, %d updated, %d unchanged.", len(records), created, updated, unchanged))
+		if missing > 0 {
+			utils.Warning(fmt.Sprintf("%d attachments could not be found and were skipped.", missing))
+		}
+		return nil
+	},
+}
+
+func init() {
+	noteExportCmd.Flags().StringVar(&exportFormat, "format", "md", "Export format: md or json")
+	noteExportCmd.Flags().StringVarP(&exportOut, "out", "o", "", "Output folder (md) or file (json)")
+	noteExportCmd.Flags().BoolVar(&exportDecrypt, "decrypt", false, "Export encrypted notes as plaintext")
+
+	noteCmd.AddCommand(noteExportCmd)
+	noteCmd.AddCommand(noteImportCmd)
+}
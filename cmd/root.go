@@ -29,6 +29,10 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() {
+	// When symlinked as docker-credential-<name>, behave as a docker credential helper.
+	if isDockerHelperInvocation() {
+		rootCmd.SetArgs(append([]string{"vault", "docker-credential"}, os.Args[1:]...))
+	}
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/crypto"
+	"github.com/nathfavour/kylrix/cli/pkg/secretref"
+)
+
+// resolveSecretRefs substitutes vault:// references in text with decrypted
+// values. The vault is only unlocked when text actually contains a reference.
+func resolveSecretRefs(database *sql.DB, text string, mek *lazyMEK) (string, error) {
+	if len(secretref.Find(text)) == 0 {
+		return text, nil
+	}
+
+	key, err := mek.Get()
+	if err != nil {
+		return "", err
+	}
+
+	secrets := map[string]interface{}{}
+	return secretref.Resolve(text, func(ref secretref.Ref) (string, error) {
+		value, ok := secrets[ref.Name]
+		if !ok {
+			var payload string
+			err := database.QueryRow("SELECT payload FROM vault_secrets WHERE name = ?", ref.Name).Scan(&payload)
+			if err == sql.ErrNoRows {
+				return "", fmt.Errorf("%s: secret '%s' not found", ref, ref.Name)
+			}
+			if err != nil {
+				return "", err
+			}
+			plaintext, err := crypto.Decrypt(payload, key.Bytes())
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", ref, err)
+			}
+			err = plaintext.Unmarshal(&value)
+			plaintext.Destroy()
+			if err != nil {
+				return "", err
+			}
+			secrets[ref.Name] = value
+		}
+		return secretField(ref, value)
+	})
+}
+
+// secretField picks the referenced field out of a decrypted secret. Plain
+// secrets have no fields; structured ones (git/docker credentials) need one.
+func secretField(ref secretref.Ref, value interface{}) (string, error) {
+	fields, structured := value.(map[string]interface{})
+	switch {
+	case !structured && ref.Field == "":
+		return fmt.Sprint(value), nil
+	case !structured:
+		return "", fmt.Errorf("%s: secret '%s' has no fields", ref, ref.Name)
+	case ref.Field == "":
+		names := make([]string, 0, len(fields))
+		for k := range fields {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("%s: pick a field, one of: %s", ref, strings.Join(names, ", "))
+	}
+
+	field, ok := fields[ref.Field]
+	if !ok {
+		return "", fmt.Errorf("%s: secret '%s' has no field '%s'", ref, ref.Name, ref.Field)
+	}
+	return fmt.Sprint(field), nil
+}
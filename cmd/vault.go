@@ -2,22 +2,27 @@ package cmd
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
 	"encoding/base64"
 	"fmt"
 
 	"github.com/nathfavour/kylrix/cli/pkg/config"
 	"github.com/nathfavour/kylrix/cli/pkg/crypto"
 	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/secretref"
 	"github.com/nathfavour/kylrix/cli/pkg/utils"
 	"github.com/spf13/cobra"
 )
 
 var (
 	decryptSecret bool
+	forceDelete   bool
 )
 
-// getMEK handles the multi-layered unlocking logic: Ephemeral PIN -> Master Password
-func getMEK(cfg *config.Config) ([]byte, error) {
+// getMEK handles the multi-layered unlocking logic: Ephemeral PIN -> Master Password.
+// The caller owns the returned key and must Destroy it.
+func getMEK(cfg *config.Config) (*crypto.SecureBuffer, error) {
 	// 1. Try Ephemeral PIN first if available
 	if cfg.EphemeralSession != nil && cfg.PinVerifier != nil {
 		pin, err := utils.PasswordPrompt("Enter 4-digit PIN to unlock")
@@ -26,12 +31,15 @@ func getMEK(cfg *config.Config) ([]byte, error) {
 			salt, _ := base64.StdEncoding.DecodeString(cfg.PinVerifier.Salt)
 			expectedHash, _ := base64.StdEncoding.DecodeString(cfg.PinVerifier.Hash)
 			actualHash := crypto.DerivePinKey(pin, salt)
+			match := subtle.ConstantTimeCompare(actualHash.Bytes(), expectedHash) == 1
+			actualHash.Destroy()
 
-			if string(actualHash) == string(expectedHash) {
+			if match {
 				// PIN correct, unwrap MEK
 				sessionSalt, _ := base64.StdEncoding.DecodeString(cfg.EphemeralSession.SessionSalt)
 				ephemeralKey := crypto.DeriveEphemeralKey(pin, sessionSalt)
-				mek, err := crypto.UnwrapKey(cfg.EphemeralSession.WrappedMek, ephemeralKey)
+				mek, err := crypto.UnwrapKey(cfg.EphemeralSession.WrappedMek, ephemeralKey.Bytes())
+				ephemeralKey.Destroy()
 				if err == nil {
 					utils.Success("Vault unlocked via Ephemeral PIN.")
 					return mek, nil
@@ -47,9 +55,7 @@ func getMEK(cfg *config.Config) ([]byte, error) {
 		return nil, err
 	}
 
-	salt := make([]byte, crypto.SaltSize)
-	copy(salt, []byte("kylrix-ecosystem-default-salt-!!"))
-	mek := crypto.DeriveKey(password, salt)
+	mek := deriveMasterKey(password)
 
 	// 3. If PIN is set, piggyback this session
 	if cfg.PinVerifier != nil {
@@ -59,7 +65,8 @@ func getMEK(cfg *config.Config) ([]byte, error) {
 			rand.Read(sessionSalt)
 
 			ephemeralKey := crypto.DeriveEphemeralKey(pin, sessionSalt)
-			wrappedMek, err := crypto.WrapKey(mek, ephemeralKey)
+			wrappedMek, err := crypto.WrapKey(mek.Bytes(), ephemeralKey.Bytes())
+			ephemeralKey.Destroy()
 			if err == nil {
 				cfg.EphemeralSession = &config.EphemeralSession{
 					WrappedMek:  wrappedMek,
@@ -74,6 +81,39 @@ func getMEK(cfg *config.Config) ([]byte, error) {
 	return mek, nil
 }
 
+// lazyMEK unlocks the vault on first use, so a command that needs the key for
+// several things prompts at most once. Always defer Destroy.
+type lazyMEK struct {
+	key *crypto.SecureBuffer
+}
+
+func (l *lazyMEK) Get() (*crypto.SecureBuffer, error) {
+	if l.key == nil {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return nil, err
+		}
+		key, err := getMEK(cfg)
+		if err != nil {
+			return nil, err
+		}
+		l.key = key
+	}
+	return l.key, nil
+}
+
+func (l *lazyMEK) Destroy() {
+	l.key.Destroy()
+	l.key = nil
+}
+
+// deriveMasterKey turns the master password into the MEK.
+func deriveMasterKey(password string) *crypto.SecureBuffer {
+	salt := make([]byte, crypto.SaltSize)
+	copy(salt, []byte("kylrix-ecosystem-default-salt-!!"))
+	return crypto.DeriveKey(password, salt)
+}
+
 var vaultSetupPinCmd = &cobra.Command{
 	Use:   "setup-pin",
 	Short: "Setup a 4-digit PIN for quick unlocking",
@@ -92,10 +132,11 @@ var vaultSetupPinCmd = &cobra.Command{
 		salt := make([]byte, crypto.PinSaltSize)
 		rand.Read(salt)
 		hash := crypto.DerivePinKey(pin, salt)
+		defer hash.Destroy()
 
 		cfg.PinVerifier = &config.PinVerifier{
 			Salt: base64.StdEncoding.EncodeToString(salt),
-			Hash: base64.StdEncoding.EncodeToString(hash),
+			Hash: base64.StdEncoding.EncodeToString(hash.Bytes()),
 		}
 
 		err = config.SaveConfig(cfg)
@@ -173,13 +214,12 @@ var vaultCreateCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		defer key.Destroy()
 
-		encrypted, err := crypto.Encrypt(value, key)
+		encrypted, err := crypto.Encrypt(value, key.Bytes())
 		if err != nil {
 			return err
 		}
-		// Explicitly zero the MEK after use
-		crypto.ZeroBytes(key)
 
 		database, err := db.InitDB()
 		if err != nil {
@@ -229,14 +269,19 @@ var vaultGetCmd = &cobra.Command{
 			if err != nil {
 				return err
 			}
+			defer key.Destroy()
 
-			decrypted, err := crypto.Decrypt(payload, key)
+			plaintext, err := crypto.Decrypt(payload, key.Bytes())
 			if err != nil {
 				utils.Error("Decryption failed.")
 				return err
 			}
-			// Explicitly zero the MEK after use
-			crypto.ZeroBytes(key)
+			defer plaintext.Destroy()
+
+			var decrypted interface{}
+			if err := plaintext.Unmarshal(&decrypted); err != nil {
+				return err
+			}
 
 			utils.Success(fmt.Sprintf("Secret '%s' decrypted:", name))
 			fmt.Printf("Value: %v\n", decrypted)
@@ -248,12 +293,116 @@ var vaultGetCmd = &cobra.Command{
 	},
 }
 
+// secretReferrers returns the notes and tasks that reference the named
+// secret. Encrypted notes can't be scanned without unlocking, so a warning
+// mentions them.
+func secretReferrers(database *sql.DB, name string) ([][]string, error) {
+	var encrypted int
+	if err := database.QueryRow("SELECT COUNT(*) FROM notes WHERE encrypted = 1").Scan(&encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted > 0 {
+		utils.Warning(fmt.Sprintf("%d encrypted note(s) were not scanned for references.", encrypted))
+	}
+
+	rows, err := database.Query(`SELECT 'note', uid, title, content FROM notes WHERE encrypted = 0 AND content LIKE ?
+		UNION ALL
+		SELECT 'task', uid, title, title FROM tasks WHERE title LIKE ?`,
+		"%"+secretref.Scheme+"%", "%"+secretref.Scheme+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data [][]string
+	for rows.Next() {
+		var kind, uid, title, text string
+		if err := rows.Scan(&kind, &uid, &title, &text); err != nil {
+			return nil, err
+		}
+		if secretref.References(text, name) {
+			data = append(data, []string{kind, uid, title})
+		}
+	}
+	return data, rows.Err()
+}
+
+var vaultRefsCmd = &cobra.Command{
+	Use:   "refs [name]",
+	Short: "List notes and tasks that reference a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		data, err := secretReferrers(database, name)
+		if err != nil {
+			return err
+		}
+
+		utils.Banner("Kylrix Vault - References")
+		if len(data) == 0 {
+			utils.Info(fmt.Sprintf("Nothing references '%s'.", name))
+		} else {
+			utils.Table([]string{"KIND", "ID", "TITLE"}, data)
+		}
+		return nil
+	},
+}
+
+var vaultDeleteCmd = &cobra.Command{
+	Use:   "delete [name]",
+	Short: "Delete a secret",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		data, err := secretReferrers(database, name)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 && !forceDelete {
+			utils.Table([]string{"KIND", "ID", "TITLE"}, data)
+			return fmt.Errorf("secret '%s' is still referenced; use --force to delete it anyway", name)
+		}
+
+		res, err := database.Exec("DELETE FROM vault_secrets WHERE name = ?", name)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			utils.Error(fmt.Sprintf("Secret '%s' not found.", name))
+			return nil
+		}
+
+		utils.Success(fmt.Sprintf("Secret '%s' deleted.", name))
+		if len(data) > 0 {
+			utils.Warning(fmt.Sprintf("%d note(s) or task(s) still reference '%s'.", len(data), name))
+		}
+		return nil
+	},
+}
+
 func init() {
 	vaultGetCmd.Flags().BoolVarP(&decryptSecret, "decrypt", "d", false, "Decrypt the secret value")
+	vaultDeleteCmd.Flags().BoolVar(&forceDelete, "force", false, "Delete even if notes or tasks still reference the secret")
 	
 	vaultCmd.AddCommand(vaultListCmd)
 	vaultCmd.AddCommand(vaultGetCmd)
 	vaultCmd.AddCommand(vaultCreateCmd)
 	vaultCmd.AddCommand(vaultSetupPinCmd)
+	vaultCmd.AddCommand(vaultRefsCmd)
+	vaultCmd.AddCommand(vaultDeleteCmd)
 	rootCmd.AddCommand(vaultCmd)
 }
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/spf13/cobra"
+)
+
+const dockerHelperPrefix = "docker-credential-"
+
+// errDockerCredentialsNotFound must be reported verbatim on stdout; the docker
+// client matches on this exact message.
+var errDockerCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// dockerCredential is the JSON document exchanged with the docker client.
+type dockerCredential struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+func dockerSecretName(serverURL string) string {
+	return "docker:" + serverURL
+}
+
+// isDockerHelperInvocation reports whether the binary was started through a
+// docker-credential-* symlink.
+func isDockerHelperInvocation() bool {
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+	return strings.HasPrefix(name, dockerHelperPrefix)
+}
+
+func readServerURL(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	serverURL := strings.TrimSpace(string(data))
+	if serverURL == "" {
+		return "", errors.New("missing server URL")
+	}
+	return serverURL, nil
+}
+
+var vaultDockerCredentialCmd = &cobra.Command{
+	Use:   "docker-credential [get|store|erase|list]",
+	Short: "Docker credential helper backed by the vault",
+	Long: `Implements the docker credential-helper protocol on stdin/stdout.
+
+Symlink the binary so docker can find it, then set "credsStore":
+  ln -s "$(command -v kylrix)" /usr/local/bin/docker-credential-kylrix
+  echo '{"credsStore": "kylrix"}' > ~/.docker/config.json
+
+The vault is unlocked on the controlling terminal. Without one (CI
+jobs, docker builds), set KYLRIX_VAULT_PASSWORD to the master
+password instead.`,
+	Args:          cobra.ExactArgs(1),
+	ValidArgs:     []string{"get", "store", "erase", "list"},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		switch args[0] {
+		case "get":
+			serverURL, err := readServerURL(os.Stdin)
+			if err != nil {
+				return err
+			}
+			stored, found, err := loadCredential(database, dockerSecretName(serverURL))
+			if err != nil {
+				return err
+			}
+			if !found {
+				fmt.Fprintln(os.Stdout, errDockerCredentialsNotFound)
+				return errDockerCredentialsNotFound
+			}
+			return json.NewEncoder(os.Stdout).Encode(dockerCredential{
+				ServerURL: serverURL,
+				Username:  stored["username"],
+				Secret:    stored["secret"],
+			})
+		case "store":
+			var cred dockerCredential
+			if err := json.NewDecoder(os.Stdin).Decode(&cred); err != nil {
+				return fmt.Errorf("invalid credential payload: %w", err)
+			}
+			if cred.ServerURL == "" {
+				return errors.New("missing server URL")
+			}
+			return storeCredential(database, dockerSecretName(cred.ServerURL), map[string]string{
+				"username": cred.Username,
+				"secret":   cred.Secret,
+			})
+		case "erase":
+			serverURL, err := readServerURL(os.Stdin)
+			if err != nil {
+				return err
+			}
+			erased, err := eraseCredential(database, dockerSecretName(serverURL))
+			if err != nil {
+				return err
+			}
+			if !erased {
+				fmt.Fprintln(os.Stdout, errDockerCredentialsNotFound)
+				return errDockerCredentialsNotFound
+			}
+			return nil
+		case "list":
+			return listDockerCredentials(database)
+		default:
+			return fmt.Errorf("unknown credential action: %s", args[0])
+		}
+	},
+}
+
+// listDockerCredentials prints the server URL -> username map docker expects.
+// Usernames live inside the encrypted payload, so the vault is only unlocked
+// when at least one registry credential exists.
+func listDockerCredentials(database *sql.DB) error {
+	rows, err := database.Query("SELECT name, payload FROM vault_secrets WHERE name LIKE 'docker:%'")
+	if err != nil {
+		return err
+	}
+	payloads := map[string]string{}
+	for rows.Next() {
+		var name, payload string
+		if err := rows.Scan(&name, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads[name] = payload
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	result := map[string]string{}
+	if len(payloads) > 0 {
+		key, err := unlockForHelper(database)
+		if err != nil {
+			return err
+		}
+		defer key.Destroy()
+
+		for name, payload := range payloads {
+			cred, err := decryptCredential(name, payload, key.Bytes())
+			if err != nil {
+				return err
+			}
+			result[strings.TrimPrefix(name, "docker:")] = cred["username"]
+		}
+	}
+	return json.NewEncoder(os.Stdout).Encode(result)
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultDockerCredentialCmd)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/gitcred"
+	"github.com/spf13/cobra"
+)
+
+var vaultGitCredentialCmd = &cobra.Command{
+	Use:   "git-credential [get|store|erase]",
+	Short: "Git credential helper backed by the vault",
+	Long: `Implements the git credential-helper protocol on stdin/stdout.
+
+Enable it with:
+  git config --global credential.helper "kylrix vault git-credential"
+
+The vault is unlocked on the controlling terminal. Without one (CI
+jobs), set KYLRIX_VAULT_PASSWORD to the master password instead.`,
+	Args:          cobra.ExactArgs(1),
+	ValidArgs:     []string{"get", "store", "erase"},
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cred, err := gitcred.Read(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		switch args[0] {
+		case "get":
+			for _, name := range cred.SecretNames() {
+				stored, found, err := loadCredential(database, name)
+				if err != nil {
+					return err
+				}
+				// A request for a named user skips entries saved for another.
+				if !found || !cred.Accepts(stored["username"]) {
+					continue
+				}
+				fmt.Fprintf(os.Stdout, "username=%s\npassword=%s\n", stored["username"], stored["password"])
+				return nil
+			}
+			// Unknown host: print nothing so git falls through to the next helper.
+			return nil
+		case "store":
+			if cred.Username == "" || cred.Password == "" {
+				return nil
+			}
+			return storeCredential(database, cred.SecretNames()[0], map[string]string{
+				"username": cred.Username,
+				"password": cred.Password,
+			})
+		case "erase":
+			for _, name := range cred.SecretNames() {
+				erased, err := eraseCredential(database, name)
+				if err != nil || erased {
+					return err
+				}
+			}
+			return nil
+		default:
+			// Git may add operations in the future; helpers must ignore them.
+			return nil
+		}
+	},
+}
+
+func init() {
+	vaultCmd.AddCommand(vaultGitCredentialCmd)
+}
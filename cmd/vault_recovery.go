@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/nathfavour/kylrix/cli/pkg/crypto"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/nathfavour/kylrix/cli/pkg/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recoveryShares    int
+	recoveryThreshold int
+)
+
+// verifyMEK checks key against an existing secret. The MEK is derived straight
+// from the password, so a typo would otherwise go unnoticed.
+func verifyMEK(database *sql.DB, key []byte) error {
+	var payload string
+	err := database.QueryRow("SELECT payload FROM vault_secrets LIMIT 1").Scan(&payload)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	plaintext, err := crypto.Decrypt(payload, key)
+	if err != nil {
+		return errors.New("master password is incorrect")
+	}
+	plaintext.Destroy()
+	return nil
+}
+
+// rekeyVault re-encrypts everything protected by oldKey under newKey.
+func rekeyVault(tx *sql.Tx, oldKey, newKey []byte) error {
+	rows, err := tx.Query("SELECT id, payload FROM vault_secrets")
+	if err != nil {
+		return err
+	}
+	payloads := map[int64]string{}
+	for rows.Next() {
+		var id int64
+		var payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			rows.Close()
+			return err
+		}
+		payloads[id] = payload
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, payload := range payloads {
+		reencrypted, err := reencrypt(payload, oldKey, newKey)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE vault_secrets SET payload = ? WHERE id = ?", reencrypted, id); err != nil {
+			return err
+		}
+	}
+
+	return notes.Reencrypt(tx, func(payload string) (string, error) {
+		return reencrypt(payload, oldKey, newKey)
+	})
+}
+
+// reencrypt moves a payload from oldKey to newKey without decoding the value.
+func reencrypt(payload string, oldKey, newKey []byte) (string, error) {
+	plaintext, err := crypto.Decrypt(payload, oldKey)
+	if err != nil {
+		return "", err
+	}
+	defer plaintext.Destroy()
+	return crypto.Encrypt(json.RawMessage(plaintext.Bytes()), newKey)
+}
+
+// readRecoveryKey prompts for the recovery key, or for enough shares to rebuild it.
+func readRecoveryKey(kit *config.RecoveryKit) (*crypto.SecureBuffer, error) {
+	if kit.Threshold < 2 {
+		encoded, err := utils.PasswordPrompt("Recovery key")
+		if err != nil {
+			return nil, err
+		}
+		return crypto.DecodeRecoveryKey(encoded)
+	}
+
+	var shares [][]byte
+	defer func() {
+		for _, share := range shares {
+			crypto.ZeroBytes(share)
+		}
+	}()
+	for i := 1; i <= kit.Threshold; i++ {
+		encoded, err := utils.PasswordPrompt(fmt.Sprintf("Recovery share %d of %d", i, kit.Threshold))
+		if err != nil {
+			return nil, err
+		}
+		share, err := crypto.DecodeRecoveryKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+		shares = append(shares, append([]byte{}, share.Bytes()...))
+		share.Destroy()
+	}
+	return crypto.CombineShares(shares)
+}
+
+var vaultRecoveryKitCmd = &cobra.Command{
+	Use:   "recovery-kit",
+	Short: "Generate a recovery key for resetting the master password",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if recoveryShares != 0 || recoveryThreshold != 0 {
+			if recoveryThreshold < 2 || recoveryThreshold > recoveryShares || recoveryShares > 255 {
+				return fmt.Errorf("invalid sharing: need 2 <= --threshold <= --shares <= 255")
+			}
+		}
+
+		utils.Banner("Kylrix Vault - Recovery Kit")
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		mek, err := getMEK(cfg)
+		if err != nil {
+			return err
+		}
+		defer mek.Destroy()
+		if err := verifyMEK(database, mek.Bytes()); err != nil {
+			return err
+		}
+
+		recoveryKey, err := crypto.NewRecoveryKey()
+		if err != nil {
+			return err
+		}
+		defer recoveryKey.Destroy()
+
+		wrapped, err := crypto.WrapKey(mek.Bytes(), recoveryKey.Bytes())
+		if err != nil {
+			return err
+		}
+
+		var shares [][]byte
+		if recoveryThreshold > 0 {
+			shares, err = crypto.SplitSecret(recoveryKey.Bytes(), recoveryShares, recoveryThreshold)
+			if err != nil {
+				return err
+			}
+		}
+
+		if cfg.Recovery != nil {
+			utils.Warning("Replacing the existing recovery kit; old keys and shares stop working.")
+		}
+		cfg.Recovery = &config.RecoveryKit{
+			WrappedMek: wrapped,
+			Shares:     recoveryShares,
+			Threshold:  recoveryThreshold,
+			CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		}
+		if err := config.SaveConfig(cfg); err != nil {
+			return err
+		}
+
+		utils.Warning("Store this offline. It is shown only once and unlocks your whole vault.")
+		if len(shares) == 0 {
+			fmt.Printf("\nRecovery key:\n  %s\n\n", crypto.EncodeRecoveryKey(recoveryKey.Bytes()))
+		} else {
+			fmt.Printf("\nAny %d of these %d shares rebuild the recovery key. Give one to each teammate:\n", recoveryThreshold, recoveryShares)
+			for i, share := range shares {
+				fmt.Printf("  Share %d: %s\n", i+1, crypto.EncodeRecoveryKey(share))
+				crypto.ZeroBytes(share)
+			}
+			fmt.Println()
+		}
+		utils.Success("Recovery kit created. Use 'kylrix vault recover' if you forget your master password.")
+		return nil
+	},
+}
+
+var vaultRecoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Reset the master password using the recovery kit",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		utils.Banner("Kylrix Vault - Recover")
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Recovery == nil {
+			return errors.New("no recovery kit configured; create one with 'kylrix vault recovery-kit'")
+		}
+
+		recoveryKey, err := readRecoveryKey(cfg.Recovery)
+		if err != nil {
+			return err
+		}
+		defer recoveryKey.Destroy()
+
+		oldMEK, err := crypto.UnwrapKey(cfg.Recovery.WrappedMek, recoveryKey.Bytes())
+		if err != nil {
+			return errors.New("recovery key does not match this vault")
+		}
+		defer oldMEK.Destroy()
+		utils.Success("Recovery key accepted.")
+
+		password, err := utils.PasswordPrompt("New Vault Master Password")
+		if err != nil {
+			return err
+		}
+		confirm, err := utils.PasswordPrompt("Confirm New Master Password")
+		if err != nil {
+			return err
+		}
+		if password == "" || password != confirm {
+			return errors.New("passwords are empty or do not match")
+		}
+
+		newMEK := deriveMasterKey(password)
+		defer newMEK.Destroy()
+
+		// Wrap before touching the database so a failure leaves everything as it was.
+		wrapped, err := crypto.WrapKey(newMEK.Bytes(), recoveryKey.Bytes())
+		if err != nil {
+			return err
+		}
+
+		database, err := db.InitDB()
+		if err != nil {
+			return err
+		}
+		defer database.Close()
+
+		tx, err := database.Begin()
+		if err != nil {
+			return err
+		}
+		if err := rekeyVault(tx, oldMEK.Bytes(), newMEK.Bytes()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("re-encrypting vault: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		// The PIN session wraps the old MEK and can no longer unlock anything.
+		cfg.EphemeralSession = nil
+		cfg.Recovery.WrappedMek = wrapped
+		if err := config.SaveConfig(cfg); err != nil {
+			utils.Error("Vault was re-encrypted but the recovery kit could not be updated; create a new one now.")
+			return err
+		}
+
+		utils.Success("Master password reset. Your recovery key remains valid.")
+		return nil
+	},
+}
+
+func init() {
+	vaultRecoveryKitCmd.Flags().IntVar(&recoveryShares, "shares", 0, "Split the recovery key into N Shamir shares")
+	vaultRecoveryKitCmd.Flags().IntVar(&recoveryThreshold, "threshold", 0, "Number of shares (M) needed to recover")
+
+	vaultCmd.AddCommand(vaultRecoveryKitCmd)
+	vaultCmd.AddCommand(vaultRecoverCmd)
+}
@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Mode selects what an Enhancer does to a note.
+type Mode string
+
+const (
+	ModeSummarize Mode = "summarize"
+	ModeGrammar   Mode = "grammar"
+	ModeExpand    Mode = "expand"
+	ModeActions   Mode = "actions"
+)
+
+// instructions are the system prompts for each mode. All of them ask for
+// Markdown back so the result can be stored as note content as-is.
+var instructions = map[Mode]string{
+	ModeSummarize: "Summarize the user's note as concise Markdown. Keep key facts, names, numbers and links.",
+	ModeGrammar:   "Fix spelling, grammar and punctuation in the user's note. Keep its meaning, tone, Markdown structure and code blocks unchanged.",
+	ModeExpand:    "Expand the user's note into clear, well-structured Markdown. Elaborate on terse points without inventing facts.",
+	ModeActions:   "Extract the action items from the user's note as a Markdown task list (- [ ] item), including owners and dates when mentioned.",
+}
+
+// Modes lists the supported modes in a stable order.
+func Modes() []string {
+	var modes []string
+	for m := range instructions {
+		modes = append(modes, string(m))
+	}
+	sort.Strings(modes)
+	return modes
+}
+
+// ParseMode validates a mode name.
+func ParseMode(s string) (Mode, error) {
+	m := Mode(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := instructions[m]; !ok {
+		return "", fmt.Errorf("unknown enhance mode '%s' (one of: %s)", s, strings.Join(Modes(), ", "))
+	}
+	return m, nil
+}
+
+// Enhancer rewrites note content according to a mode.
+type Enhancer interface {
+	Enhance(ctx context.Context, mode Mode, content string) (string, error)
+}
+
+// OpenAIEnhancer talks to any server implementing the OpenAI chat completions
+// API, including self-hosted model servers.
+type OpenAIEnhancer struct {
+	Endpoint   string // base URL, e.g. http://localhost:11434/v1
+	Model      string
+	APIKey     string
+	HTTPClient *http.Client
+}
+
+// NewEnhancer builds the configured Enhancer. The config only refers to the
+// API key, so the caller passes the key itself.
+func NewEnhancer(cfg *config.AIConfig, apiKey string) (Enhancer, error) {
+	if cfg == nil || cfg.Endpoint == "" {
+		return nil, errors.New("AI endpoint not configured; set it with 'kylrix note settings --ai-endpoint URL'")
+	}
+	return &OpenAIEnhancer{
+		Endpoint:   cfg.Endpoint,
+		Model:      cfg.Model,
+		APIKey:     apiKey,
+		HTTPClient: &http.Client{Timeout: 2 * time.Minute},
+	}, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model,omitempty"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+func (e *OpenAIEnhancer) url() string {
+	base := strings.TrimRight(e.Endpoint, "/")
+	if strings.HasSuffix(base, "/chat/completions") {
+		return base
+	}
+	return base + "/chat/completions"
+}
+
+// Enhance sends content to the chat completions endpoint and returns the reply.
+func (e *OpenAIEnhancer) Enhance(ctx context.Context, mode Mode, content string) (string, error) {
+	instruction, ok := instructions[mode]
+	if !ok {
+		return "", fmt.Errorf("unknown enhance mode '%s'", mode)
+	}
+
+	body, err := json.Marshal(chatRequest{
+		Model: e.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: instruction + " Reply with the resulting note only."},
+			{Role: "user", Content: content},
+		},
+		Temperature: 0.2,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal request body")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url(), bytes.NewReader(body))
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	client := e.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "AI request failed")
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read response body")
+	}
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("AI provider error (%d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var parsed chatResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return "", errors.Wrap(err, "failed to unmarshal response")
+	}
+	if len(parsed.Choices) == 0 || strings.TrimSpace(parsed.Choices[0].Message.Content) == "" {
+		return "", errors.New("AI provider returned an empty response")
+	}
+	return parsed.Choices[0].Message.Content, nil
+}
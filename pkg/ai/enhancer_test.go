@@ -0,0 +1,73 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIEnhancer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("bad request body: %v", err)
+		}
+		if req.Model != "local-model" || len(req.Messages) != 2 {
+			t.Fatalf("unexpected request: %+v", req)
+		}
+		if !strings.Contains(req.Messages[0].Content, "action items") {
+			t.Errorf("system prompt does not match mode: %q", req.Messages[0].Content)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]string{"role": "assistant", "content": "- [ ] " + req.Messages[1].Content}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	e := &OpenAIEnhancer{Endpoint: server.URL + "/v1/", Model: "local-model", APIKey: "test-key", HTTPClient: server.Client()}
+	got, err := e.Enhance(context.Background(), ModeActions, "ship the release")
+	if err != nil {
+		t.Fatalf("Enhance failed: %v", err)
+	}
+	if got != "- [ ] ship the release" {
+		t.Errorf("unexpected result %q", got)
+	}
+}
+
+func TestOpenAIEnhancerErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "empty") {
+			w.Write([]byte(`{"choices": []}`))
+			return
+		}
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	e := &OpenAIEnhancer{Endpoint: server.URL, HTTPClient: server.Client()}
+	if _, err := e.Enhance(context.Background(), ModeSummarize, "x"); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected a 503 error, got %v", err)
+	}
+
+	e.Endpoint = server.URL + "/empty"
+	if _, err := e.Enhance(context.Background(), ModeSummarize, "x"); err == nil {
+		t.Error("expected an error for an empty response")
+	}
+
+	if _, err := ParseMode("poetry"); err == nil {
+		t.Error("expected ParseMode to reject unknown modes")
+	}
+}
@@ -0,0 +1,127 @@
+// Package apitest provides an in-memory stand-in for the Kylrix backends, for
+// testing code that syncs with them.
+//
+// Backend holds what the sync APIs have in common: records stored by ID, a
+// change feed over them, creates made idempotent by their Idempotency-Key, a
+// request log and an offline switch. Tests serve their own routes on top.
+package apitest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api"
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+)
+
+// PageSize is the number of changes in a feed page. It is small so clients
+// have to follow has_more.
+const PageSize = 2
+
+// Backend is an in-memory store of records of type T.
+type Backend[T any] struct {
+	Records  map[string]*T
+	Requests []string // "METHOD /path?query" of every request served
+	Offline  bool     // answer every request with 503
+
+	// Serve handles a request with the backend locked.
+	Serve func(w http.ResponseWriter, r *http.Request)
+	// After, if set, runs once a request is served and the lock released,
+	// e.g. to change records between a client's requests.
+	After func(r *http.Request)
+
+	mu      sync.Mutex
+	seq     int
+	changed map[string]int
+	created map[string]string // ID by Idempotency-Key
+}
+
+// NewBackend returns an empty backend serving requests with serve.
+func NewBackend[T any](serve func(w http.ResponseWriter, r *http.Request)) *Backend[T] {
+	return &Backend[T]{
+		Records: make(map[string]*T),
+		Serve:   serve,
+		changed: make(map[string]int),
+		created: make(map[string]string),
+	}
+}
+
+// Lock and Unlock guard the records when tests change them between requests.
+func (b *Backend[T]) Lock()   { b.mu.Lock() }
+func (b *Backend[T]) Unlock() { b.mu.Unlock() }
+
+func (b *Backend[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	after := b.After
+	if b.Offline {
+		b.mu.Unlock()
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	b.Requests = append(b.Requests, r.Method+" "+r.URL.RequestURI())
+	b.Serve(w, r)
+	b.mu.Unlock()
+	if after != nil {
+		after(r)
+	}
+}
+
+// Store saves rec as the latest version of record id and returns the version
+// number. Callers hold the lock.
+func (b *Backend[T]) Store(id string, rec *T) int {
+	b.seq++
+	b.Records[id] = rec
+	b.changed[id] = b.seq
+	return b.seq
+}
+
+// Create stores the record made by newRecord under a new ID, unless key was
+// used before: then the record created with it is returned and created is
+// false. Callers hold the lock.
+func (b *Backend[T]) Create(key string, newRecord func(id string) *T) (rec *T, created bool) {
+	if id, ok := b.created[key]; ok && key != "" {
+		return b.Records[id], false
+	}
+	id := fmt.Sprintf("r%d", len(b.Records)+1)
+	rec = newRecord(id)
+	b.Store(id, rec)
+	b.created[key] = id
+	return rec, true
+}
+
+// Version returns the version number of record id. Callers hold the lock.
+func (b *Backend[T]) Version(id string) int {
+	return b.changed[id]
+}
+
+// Changes returns a page of the latest versions of the records changed after
+// the since cursor, the cursor to continue from and whether more follow.
+// Callers hold the lock.
+func (b *Backend[T]) Changes(since string) (page []T, cursor string, hasMore bool) {
+	after, _ := strconv.Atoi(since)
+	var ids []string
+	for id, seq := range b.changed {
+		if seq > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return b.changed[ids[i]] < b.changed[ids[j]] })
+	page, cursor = []T{}, strconv.Itoa(after)
+	for i, id := range ids {
+		if i == PageSize {
+			return page, cursor, true
+		}
+		page = append(page, *b.Records[id])
+		cursor = strconv.Itoa(b.changed[id])
+	}
+	return page, cursor, false
+}
+
+// Client returns an API client for server.
+func Client(server *httptest.Server) *api.Client {
+	return &api.Client{BaseURL: server.URL, HTTPClient: server.Client(), Config: &config.Config{}}
+}
@@ -44,6 +44,39 @@ func (c *Client) Execute(method, path string, body interface{}, result interface
 }
 
 func (c *Client) Request(method, path string, body interface{}) ([]byte, error) {
+	resp, err := c.Do(method, path, body, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// APIError is returned for responses with an HTTP error status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (%d): %s", e.StatusCode, e.Body)
+}
+
+// IsStatus reports whether err is an APIError with the given status code.
+func IsStatus(err error, code int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == code
+}
+
+// Response is a successful API response.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Do sends a request with extra headers (such as If-Match) and returns the
+// whole response. Error statuses are returned as *APIError.
+func (c *Client) Do(method, path string, body interface{}, header http.Header) (*Response, error) {
 	var bodyReader io.Reader
 	if body != nil {
 		data, err := json.Marshal(body)
@@ -59,6 +92,9 @@ func (c *Client) Request(method, path string, body interface{}) ([]byte, error)
 		return nil, errors.Wrap(err, "failed to create request")
 	}
 
+	for key, values := range header {
+		req.Header[key] = values
+	}
 	req.Header.Set("Content-Type", "application/json")
 	if c.Config.Token != "" {
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Config.Token))
@@ -79,8 +115,8 @@ func (c *Client) Request(method, path string, body interface{}) ([]byte, error)
 	}
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error (%d): %s", resp.StatusCode, string(respBody))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
-	return respBody, nil
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: respBody}, nil
 }
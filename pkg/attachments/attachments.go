@@ -0,0 +1,155 @@
+// Package attachments stores files content-addressed by their SHA-256, so the
+// same screenshot attached to several notes is kept once. Notes refer to a
+// stored file with a kylrix://attach/<hash> URL.
+package attachments
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/nathfavour/kylrix/cli/pkg/config"
+	"github.com/pkg/errors"
+)
+
+// Scheme prefixes the hash in attachment URLs.
+const Scheme = "kylrix://attach/"
+
+var (
+	refRe  = regexp.MustCompile(`kylrix://attach/([0-9a-f]{64})`)
+	hashRe = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// URL returns the URL notes use to refer to the file with the given hash.
+func URL(hash string) string {
+	return Scheme + hash
+}
+
+// Refs returns the hashes referenced in content, in order of appearance.
+func Refs(content string) []string {
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, m := range refRe.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			hashes = append(hashes, m[1])
+		}
+	}
+	return hashes
+}
+
+// Rewrite replaces every attachment URL in content with fn(hash).
+func Rewrite(content string, fn func(hash string) string) string {
+	return refRe.ReplaceAllStringFunc(content, func(s string) string {
+		return fn(refRe.FindStringSubmatch(s)[1])
+	})
+}
+
+// ValidHash reports whether s looks like a SHA-256 hex digest.
+func ValidHash(s string) bool {
+	return hashRe.MatchString(s)
+}
+
+// Store is a folder of files named after their hash, fanned out by the first
+// two hex digits.
+type Store struct {
+	Dir string
+}
+
+// Default returns the store in the Kylrix data dir.
+func Default() (*Store, error) {
+	dataDir, err := config.GetDataDir()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Dir: filepath.Join(dataDir, "attachments")}, nil
+}
+
+// Path returns where the file with the given hash is kept.
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.Dir, hash[:2], hash)
+}
+
+// Has reports whether the file with the given hash is stored.
+func (s *Store) Has(hash string) bool {
+	_, err := os.Stat(s.Path(hash))
+	return err == nil
+}
+
+// Put copies r into the store and returns its hash and size. Storing a file
+// that is already present is a no-op.
+func (s *Store) Put(r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(s.Dir, ".put-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, err
+	}
+
+	hash := hex.EncodeToString(h.Sum(nil))
+	if s.Has(hash) {
+		return hash, size, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path(hash)), 0700); err != nil {
+		return "", 0, err
+	}
+	if err := os.Rename(tmp.Name(), s.Path(hash)); err != nil {
+		return "", 0, err
+	}
+	return hash, size, nil
+}
+
+// Open opens the file with the given hash.
+func (s *Store) Open(hash string) (*os.File, error) {
+	f, err := os.Open(s.Path(hash))
+	if os.IsNotExist(err) {
+		return nil, errors.Errorf("attachment %s is missing from %s", hash[:12], s.Dir)
+	}
+	return f, err
+}
+
+// Remove deletes the file with the given hash, returning its size.
+func (s *Store) Remove(hash string) (int64, error) {
+	info, err := os.Stat(s.Path(hash))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Remove(s.Path(hash))
+}
+
+// List returns the hashes of every stored file.
+func (s *Store) List() ([]string, error) {
+	var hashes []string
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == s.Dir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && ValidHash(d.Name()) {
+			hashes = append(hashes, d.Name())
+		}
+		return nil
+	})
+	return hashes, err
+}
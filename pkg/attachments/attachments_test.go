@@ -0,0 +1,38 @@
+package attachments
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	s := &Store{Dir: t.TempDir()}
+	hash, size, err := s.Put(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" || size != 5 {
+		t.Fatalf("Put = %s, %d", hash, size)
+	}
+	if again, _, _ := s.Put(strings.NewReader("hello")); again != hash {
+		t.Fatalf("second Put = %s", again)
+	}
+	if list, _ := s.List(); len(list) != 1 || list[0] != hash {
+		t.Fatalf("List = %v", list)
+	}
+
+	content := "see ![shot](" + URL(hash) + ") and " + URL(hash)
+	if refs := Refs(content); len(refs) != 1 || refs[0] != hash {
+		t.Fatalf("Refs = %v", refs)
+	}
+	if got := Rewrite(content, func(h string) string { return h[:4] + ".txt" }); got != "see ![shot](2cf2.txt) and 2cf2.txt" {
+		t.Errorf("Rewrite = %q", got)
+	}
+
+	if n, err := s.Remove(hash); err != nil || n != 5 || s.Has(hash) {
+		t.Errorf("Remove = %d, %v", n, err)
+	}
+	if list, err := (&Store{Dir: s.Dir + "/missing"}).List(); err != nil || len(list) != 0 {
+		t.Errorf("List of a missing store = %v, %v", list, err)
+	}
+}
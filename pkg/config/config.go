@@ -12,6 +12,14 @@ type Config struct {
 	Token            string            `json:"token"`
 	PinVerifier      *PinVerifier      `json:"pin_verifier,omitempty"`
 	EphemeralSession *EphemeralSession `json:"ephemeral_session,omitempty"`
+	Recovery         *RecoveryKit      `json:"recovery,omitempty"`
+
+	// AlwaysEncryptNotes makes 'note create' encrypt content unless --encrypt=false.
+	AlwaysEncryptNotes bool      `json:"always_encrypt_notes,omitempty"`
+	AI                 *AIConfig `json:"ai,omitempty"`
+	// NoteRevisionLimit caps the history kept per note: 0 uses the default,
+	// a negative value keeps everything.
+	NoteRevisionLimit int `json:"note_revision_limit,omitempty"`
 }
 
 type PinVerifier struct {
@@ -24,6 +32,23 @@ type EphemeralSession struct {
 	SessionSalt string `json:"session_salt"`
 }
 
+// AIConfig points note enhancement at an OpenAI-compatible chat completions
+// server, hosted or self-hosted.
+type AIConfig struct {
+	Endpoint string `json:"endpoint"`
+	Model    string `json:"model,omitempty"`
+	APIKey   string `json:"api_key,omitempty"` // vault:// reference to the key
+}
+
+// RecoveryKit stores the MEK wrapped with an offline recovery key. When
+// Threshold is set, the recovery key was split into Shares Shamir shares.
+type RecoveryKit struct {
+	WrappedMek string `json:"wrapped_mek"`
+	Shares     int    `json:"shares,omitempty"`
+	Threshold  int    `json:"threshold,omitempty"`
+	CreatedAt  string `json:"created_at"`
+}
+
 func GetAppConfigDir() (string, error) {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
@@ -32,7 +57,7 @@ func GetAppConfigDir() (string, error) {
 	appDir := filepath.Join(configDir, "kylrix")
 	
 	// Create subdirectories
-	subdirs := []string{"configs", "data", "logs", "cache"}
+	subdirs := []string{"configs", "data", "logs", "cache", "templates"}
 	for _, d := range subdirs {
 		path := filepath.Join(appDir, d)
 		// SECURITY: Use 0700 (owner-only) for sensitive config directories (CVE-KYL-2026-004)
@@ -60,6 +85,15 @@ func GetDataDir() (string, error) {
 	return filepath.Join(appDir, "data"), nil
 }
 
+// GetTemplatesDir returns the folder holding note templates (<name>.md).
+func GetTemplatesDir() (string, error) {
+	appDir, err := GetAppConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(appDir, "templates"), nil
+}
+
 func LoadConfig() (*Config, error) {
 	file, err := GetConfigFile()
 	if err != nil {
@@ -25,18 +25,25 @@ const (
 )
 
 // DeriveKey derives a key from a password and salt matching the EcosystemSecurity implementation
-func DeriveKey(password string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(password), salt, PBKDF2Iterations, KeySize, sha256.New)
+func DeriveKey(password string, salt []byte) *SecureBuffer {
+	return deriveKey(password, salt, PBKDF2Iterations)
 }
 
 // DerivePinKey derives a key from a PIN and salt for verifier storage
-func DerivePinKey(pin string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(pin), salt, PinPBKDF2Iterations, KeySize, sha256.New)
+func DerivePinKey(pin string, salt []byte) *SecureBuffer {
+	return deriveKey(pin, salt, PinPBKDF2Iterations)
 }
 
 // DeriveEphemeralKey derives a fast key for session piggybacking
-func DeriveEphemeralKey(pin string, salt []byte) []byte {
-	return pbkdf2.Key([]byte(pin), salt, SessionPBKDF2Iterations, KeySize, sha256.New)
+func DeriveEphemeralKey(pin string, salt []byte) *SecureBuffer {
+	return deriveKey(pin, salt, SessionPBKDF2Iterations)
+}
+
+// deriveKey runs PBKDF2 over secret, wiping the byte copy of it afterwards.
+func deriveKey(secret string, salt []byte, iterations int) *SecureBuffer {
+	b := []byte(secret)
+	defer ZeroBytes(b)
+	return SecureBufferFrom(pbkdf2.Key(b, salt, iterations, KeySize, sha256.New))
 }
 
 // WrapKey wraps the MEK with an ephemeral key using AES-GCM
@@ -63,7 +70,7 @@ func WrapKey(rawKey []byte, ephemeralKey []byte) (string, error) {
 }
 
 // UnwrapKey unwraps the MEK using the ephemeral key
-func UnwrapKey(wrappedKeyBase64 string, ephemeralKey []byte) ([]byte, error) {
+func UnwrapKey(wrappedKeyBase64 string, ephemeralKey []byte) (*SecureBuffer, error) {
 	combined, err := base64.StdEncoding.DecodeString(wrappedKeyBase64)
 	if err != nil {
 		return nil, err
@@ -86,7 +93,21 @@ func UnwrapKey(wrappedKeyBase64 string, ephemeralKey []byte) ([]byte, error) {
 	nonce := combined[:IVSize]
 	ciphertext := combined[IVSize:]
 
-	return gcm.Open(nil, nonce, ciphertext, nil)
+	return openSecure(gcm, nonce, ciphertext)
+}
+
+// openSecure decrypts straight into a SecureBuffer so the plaintext never
+// lives in unmanaged memory.
+func openSecure(gcm cipher.AEAD, nonce, ciphertext []byte) (*SecureBuffer, error) {
+	if len(ciphertext) < gcm.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+	buf := NewSecureBuffer(len(ciphertext) - gcm.Overhead())
+	if _, err := gcm.Open(buf.data[:0], nonce, ciphertext, nil); err != nil {
+		buf.Destroy()
+		return nil, err
+	}
+	return buf, nil
 }
 
 // ZeroBytes explicitly overwrites a byte slice with zeroes for security
@@ -103,6 +124,7 @@ func Encrypt(data interface{}, key []byte) (string, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "failed to marshal data to JSON")
 	}
+	defer ZeroBytes(plaintext)
 
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -130,8 +152,9 @@ func Encrypt(data interface{}, key []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(combined), nil
 }
 
-// Decrypt decrypts data using AES-256-GCM, matching the Kylrix Ecosystem Security Protocol
-func Decrypt(encryptedBase64 string, key []byte) (interface{}, error) {
+// Decrypt decrypts data using AES-256-GCM, matching the Kylrix Ecosystem Security Protocol.
+// The returned buffer holds the JSON plaintext; use Unmarshal to recover the value.
+func Decrypt(encryptedBase64 string, key []byte) (*SecureBuffer, error) {
 	// 1. Base64 decode
 	combined, err := base64.StdEncoding.DecodeString(encryptedBase64)
 	if err != nil {
@@ -157,18 +180,16 @@ func Decrypt(encryptedBase64 string, key []byte) (interface{}, error) {
 	ciphertext := combined[IVSize:]
 
 	// 3. Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := openSecure(gcm, nonce, ciphertext)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to decrypt (likely wrong key or corrupted data)")
 	}
 
-	// 4. JSON Unmarshal (matching TS implementation)
-	var result interface{}
-	if err := json.Unmarshal(plaintext, &result); err != nil {
-		// If it's not valid JSON, it might be a raw string that was stringified
-		// but since we stringified it, it should be valid JSON.
-		return nil, errors.Wrap(err, "failed to unmarshal decrypted JSON")
+	// 4. Validate the JSON envelope (matching TS implementation) without copying it
+	if !json.Valid(plaintext.Bytes()) {
+		plaintext.Destroy()
+		return nil, errors.New("failed to unmarshal decrypted JSON")
 	}
 
-	return result, nil
+	return plaintext, nil
 }
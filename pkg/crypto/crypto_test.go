@@ -10,16 +10,23 @@ func TestEncryptionDecryption(t *testing.T) {
 	data := "this-is-a-secret-message"
 
 	key := DeriveKey(password, salt)
+	defer key.Destroy()
 
-	encrypted, err := Encrypt(data, key)
+	encrypted, err := Encrypt(data, key.Bytes())
 	if err != nil {
 		t.Fatalf("Encryption failed: %v", err)
 	}
 
-	decrypted, err := Decrypt(encrypted, key)
+	plaintext, err := Decrypt(encrypted, key.Bytes())
 	if err != nil {
 		t.Fatalf("Decryption failed: %v", err)
 	}
+	defer plaintext.Destroy()
+
+	var decrypted string
+	if err := plaintext.Unmarshal(&decrypted); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
 
 	if decrypted != data {
 		t.Errorf("Decrypted data mismatch: expected %v, got %v", data, decrypted)
@@ -30,6 +37,7 @@ func TestComplexDataEncryption(t *testing.T) {
 	password := "another-password"
 	salt := []byte("random-salt-12345678901234567890")
 	key := DeriveKey(password, salt)
+	defer key.Destroy()
 
 	data := map[string]interface{}{
 		"id":    123,
@@ -37,18 +45,22 @@ func TestComplexDataEncryption(t *testing.T) {
 		"meta":  []string{"a", "b", "c"},
 	}
 
-	encrypted, err := Encrypt(data, key)
+	encrypted, err := Encrypt(data, key.Bytes())
 	if err != nil {
 		t.Fatalf("Encryption failed: %v", err)
 	}
 
-	decrypted, err := Decrypt(encrypted, key)
+	plaintext, err := Decrypt(encrypted, key.Bytes())
 	if err != nil {
 		t.Fatalf("Decryption failed: %v", err)
 	}
+	defer plaintext.Destroy()
 
 	// Verify unmarshaling worked
-	decMap := decrypted.(map[string]interface{})
+	var decMap map[string]interface{}
+	if err := plaintext.Unmarshal(&decMap); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
 	if decMap["id"].(float64) != 123 { // JSON unmarshals numbers to float64 by default
 		t.Errorf("Decrypted ID mismatch")
 	}
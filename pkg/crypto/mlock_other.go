@@ -0,0 +1,8 @@
+//go:build !unix
+
+package crypto
+
+// Memory locking is not available on this platform; buffers are still wiped.
+func lockMemory(b []byte) bool { return false }
+
+func unlockMemory(b []byte) {}
@@ -0,0 +1,75 @@
+//go:build unix
+
+package crypto
+
+import (
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// mlock works on whole pages, and small buffers share pages with each other
+// (and with anything else on the heap). Locks are therefore counted per page,
+// and a page is only unlocked once no buffer on it is locked any more.
+var (
+	pageSize  = uintptr(os.Getpagesize())
+	pageMu    sync.Mutex
+	pageLocks = make(map[uintptr]*pageLock)
+)
+
+type pageLock struct {
+	count int
+	span  []byte // part of a buffer on the page, to unlock it with
+}
+
+// pageSpans splits b into the parts lying on each page, by page address.
+func pageSpans(b []byte) map[uintptr][]byte {
+	spans := make(map[uintptr][]byte)
+	start := uintptr(unsafe.Pointer(&b[0]))
+	for off := 0; off < len(b); {
+		page := (start + uintptr(off)) &^ (pageSize - 1)
+		end := int(page + pageSize - start)
+		if end > len(b) {
+			end = len(b)
+		}
+		spans[page] = b[off:end]
+		off = end
+	}
+	return spans
+}
+
+// lockMemory keeps b out of swap. Failure (e.g. RLIMIT_MEMLOCK) is not fatal;
+// the buffer is still wiped on Destroy.
+func lockMemory(b []byte) bool {
+	pageMu.Lock()
+	defer pageMu.Unlock()
+	if unix.Mlock(b) != nil {
+		return false
+	}
+	for page, span := range pageSpans(b) {
+		if l := pageLocks[page]; l != nil {
+			l.count++
+		} else {
+			pageLocks[page] = &pageLock{count: 1, span: span}
+		}
+	}
+	return true
+}
+
+// unlockMemory releases the pages of b that no other locked buffer uses.
+func unlockMemory(b []byte) {
+	pageMu.Lock()
+	defer pageMu.Unlock()
+	for page := range pageSpans(b) {
+		l := pageLocks[page]
+		if l == nil {
+			continue
+		}
+		if l.count--; l.count == 0 {
+			unix.Munlock(l.span)
+			delete(pageLocks, page)
+		}
+	}
+}
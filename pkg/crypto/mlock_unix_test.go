@@ -0,0 +1,29 @@
+//go:build unix
+
+package crypto
+
+import "testing"
+
+func TestDestroyKeepsSharedPagesLocked(t *testing.T) {
+	// Small buffers allocated together usually share a page.
+	a, b := NewSecureBuffer(32), NewSecureBuffer(32)
+	defer b.Destroy()
+	if !a.locked || !b.locked {
+		t.Skip("memory locking is not permitted here")
+	}
+	shared := false
+	for page := range pageSpans(a.Bytes()) {
+		if _, ok := pageSpans(b.Bytes())[page]; ok {
+			shared = true
+		}
+	}
+	a.Destroy()
+
+	pageMu.Lock()
+	defer pageMu.Unlock()
+	for page := range pageSpans(b.Bytes()) {
+		if l := pageLocks[page]; l == nil || l.count < 1 {
+			t.Fatalf("page %#x of a live buffer was unlocked (shared with the destroyed one: %v)", page, shared)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RecoveryKeySize      = 32
+	recoveryChecksumSize = 2
+	recoveryGroupSize    = 5
+)
+
+// recoveryEncoding is Crockford's base32 alphabet: upper-case alphanumerics only,
+// so encoded keys fit QR alphanumeric mode and avoid look-alike letters.
+var recoveryEncoding = base32.NewEncoding("0123456789ABCDEFGHJKMNPQRSTVWXYZ").WithPadding(base32.NoPadding)
+
+// NewRecoveryKey generates a random 256-bit recovery key.
+func NewRecoveryKey() (*SecureBuffer, error) {
+	key := NewSecureBuffer(RecoveryKeySize)
+	if _, err := io.ReadFull(rand.Reader, key.Bytes()); err != nil {
+		key.Destroy()
+		return nil, errors.Wrap(err, "failed to generate recovery key")
+	}
+	return key, nil
+}
+
+// EncodeRecoveryKey renders a recovery key or share as dash-separated groups of
+// base32 characters with a trailing checksum, e.g. "7F3QZ-1K9MD-...".
+func EncodeRecoveryKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	raw := append(append([]byte{}, data...), sum[:recoveryChecksumSize]...)
+	encoded := recoveryEncoding.EncodeToString(raw)
+	ZeroBytes(raw)
+
+	var groups []string
+	for len(encoded) > recoveryGroupSize {
+		groups = append(groups, encoded[:recoveryGroupSize])
+		encoded = encoded[recoveryGroupSize:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-")
+}
+
+// DecodeRecoveryKey parses the output of EncodeRecoveryKey. It tolerates
+// lower case, whitespace, missing dashes and the usual O/0, I/L/1 confusions.
+func DecodeRecoveryKey(s string) (*SecureBuffer, error) {
+	normalized := strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t', '\n', '\r':
+			return -1
+		case 'O':
+			return '0'
+		case 'I', 'L':
+			return '1'
+		}
+		return r
+	}, strings.ToUpper(s))
+
+	raw, err := recoveryEncoding.DecodeString(normalized)
+	if err != nil {
+		return nil, errors.New("recovery key contains invalid characters")
+	}
+	if len(raw) <= recoveryChecksumSize {
+		ZeroBytes(raw)
+		return nil, errors.New("recovery key too short")
+	}
+
+	split := len(raw) - recoveryChecksumSize
+	sum := sha256.Sum256(raw[:split])
+	if string(sum[:recoveryChecksumSize]) != string(raw[split:]) {
+		ZeroBytes(raw)
+		return nil, errors.New("recovery key checksum mismatch (check for typos)")
+	}
+	return SecureBufferFrom(raw[:split]), nil
+}
@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecoveryKeyEncoding(t *testing.T) {
+	key, err := NewRecoveryKey()
+	if err != nil {
+		t.Fatalf("NewRecoveryKey failed: %v", err)
+	}
+	defer key.Destroy()
+
+	encoded := EncodeRecoveryKey(key.Bytes())
+	sloppy := strings.ToLower(strings.ReplaceAll(encoded, "-", " "))
+
+	decoded, err := DecodeRecoveryKey(sloppy)
+	if err != nil {
+		t.Fatalf("DecodeRecoveryKey failed: %v", err)
+	}
+	defer decoded.Destroy()
+	if string(decoded.Bytes()) != string(key.Bytes()) {
+		t.Fatal("decoded recovery key does not match")
+	}
+
+	// A single typo must be caught by the checksum.
+	typo := []byte(encoded)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	if _, err := DecodeRecoveryKey(string(typo)); err == nil {
+		t.Error("expected checksum error for mistyped key")
+	}
+}
+
+func TestShamirSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	shares, err := SplitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("SplitSecret failed: %v", err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		var picked [][]byte
+		for _, i := range subset {
+			picked = append(picked, shares[i])
+		}
+		combined, err := CombineShares(picked)
+		if err != nil {
+			t.Fatalf("CombineShares(%v) failed: %v", subset, err)
+		}
+		if string(combined.Bytes()) != string(secret) {
+			t.Errorf("CombineShares(%v) recovered the wrong secret", subset)
+		}
+		combined.Destroy()
+	}
+
+	combined, err := CombineShares([][]byte{shares[0], shares[1]})
+	if err != nil {
+		t.Fatalf("CombineShares with too few shares errored: %v", err)
+	}
+	if string(combined.Bytes()) == string(secret) {
+		t.Error("two shares should not reveal a threshold-3 secret")
+	}
+
+	if _, err := CombineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("expected an error for duplicate shares")
+	}
+}
@@ -0,0 +1,63 @@
+package crypto
+
+import (
+	"encoding/json"
+)
+
+// SecureBuffer holds key material or decrypted plaintext. Its memory is locked
+// against being swapped to disk where the platform allows it, and is wiped by
+// Destroy. Callers should always `defer buf.Destroy()` as soon as they own one.
+type SecureBuffer struct {
+	data   []byte
+	locked bool
+}
+
+// NewSecureBuffer allocates a zeroed, locked buffer of the given size.
+func NewSecureBuffer(size int) *SecureBuffer {
+	b := &SecureBuffer{data: make([]byte, size)}
+	if size > 0 {
+		b.locked = lockMemory(b.data)
+	}
+	return b
+}
+
+// SecureBufferFrom moves src into a new SecureBuffer and zeroes src.
+func SecureBufferFrom(src []byte) *SecureBuffer {
+	b := NewSecureBuffer(len(src))
+	copy(b.data, src)
+	ZeroBytes(src)
+	return b
+}
+
+// Bytes exposes the underlying memory. The slice is only valid until Destroy.
+func (b *SecureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Len returns the number of bytes held.
+func (b *SecureBuffer) Len() int {
+	return len(b.Bytes())
+}
+
+// Unmarshal decodes the buffer as JSON into v. Decrypt returns the JSON
+// plaintext produced by Encrypt, so this recovers the original value.
+func (b *SecureBuffer) Unmarshal(v interface{}) error {
+	return json.Unmarshal(b.Bytes(), v)
+}
+
+// Destroy zeroes and unlocks the buffer. It is safe to call more than once
+// and on a nil buffer.
+func (b *SecureBuffer) Destroy() {
+	if b == nil || b.data == nil {
+		return
+	}
+	ZeroBytes(b.data)
+	if b.locked {
+		unlockMemory(b.data)
+		b.locked = false
+	}
+	b.data = nil
+}
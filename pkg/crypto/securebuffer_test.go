@@ -0,0 +1,86 @@
+package crypto
+
+import (
+	"testing"
+)
+
+func assertZeroed(t *testing.T, label string, b []byte) {
+	t.Helper()
+	for i, v := range b {
+		if v != 0 {
+			t.Fatalf("%s: byte %d not zeroed after Destroy", label, i)
+		}
+	}
+}
+
+func TestSecureBufferDestroyZeroes(t *testing.T) {
+	src := []byte("correct horse battery staple")
+	buf := SecureBufferFrom(src)
+	assertZeroed(t, "source slice", src)
+
+	mem := buf.Bytes()
+	if string(mem) != "correct horse battery staple" {
+		t.Fatalf("unexpected buffer content: %q", mem)
+	}
+
+	buf.Destroy()
+	assertZeroed(t, "buffer", mem)
+	if buf.Bytes() != nil {
+		t.Error("Bytes should be nil after Destroy")
+	}
+
+	// Destroy must be idempotent and nil-safe so it can always be deferred.
+	buf.Destroy()
+	var nilBuf *SecureBuffer
+	nilBuf.Destroy()
+}
+
+func TestDerivedAndDecryptedBuffersAreWiped(t *testing.T) {
+	key := DeriveKey("password", []byte("kylrix-ecosystem-default-salt-!!"))
+	keyMem := key.Bytes()
+
+	encrypted, err := Encrypt("secret", keyMem)
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+
+	wrapped, err := WrapKey(keyMem, keyMem)
+	if err != nil {
+		t.Fatalf("WrapKey failed: %v", err)
+	}
+	unwrapped, err := UnwrapKey(wrapped, keyMem)
+	if err != nil {
+		t.Fatalf("UnwrapKey failed: %v", err)
+	}
+	unwrappedMem := unwrapped.Bytes()
+
+	plaintext, err := Decrypt(encrypted, keyMem)
+	if err != nil {
+		t.Fatalf("Decryption failed: %v", err)
+	}
+	plainMem := plaintext.Bytes()
+
+	plaintext.Destroy()
+	unwrapped.Destroy()
+	key.Destroy()
+
+	assertZeroed(t, "plaintext", plainMem)
+	assertZeroed(t, "unwrapped key", unwrappedMem)
+	assertZeroed(t, "derived key", keyMem)
+}
+
+func TestDecryptWithWrongKeyReturnsNoBuffer(t *testing.T) {
+	key := DeriveKey("password", []byte("kylrix-ecosystem-default-salt-!!"))
+	defer key.Destroy()
+	other := DeriveKey("other", []byte("kylrix-ecosystem-default-salt-!!"))
+	defer other.Destroy()
+
+	encrypted, err := Encrypt("secret", key.Bytes())
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	buf, err := Decrypt(encrypted, other.Bytes())
+	if err == nil || buf != nil {
+		t.Fatal("expected decryption with the wrong key to fail without a buffer")
+	}
+}
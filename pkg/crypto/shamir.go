@@ -0,0 +1,116 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Shamir secret sharing over GF(2^8). A share is one x-coordinate byte followed
+// by one y-byte per secret byte; any threshold of shares recover the secret.
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		// Multiply by the generator 3 modulo the AES polynomial x^8+x^4+x^3+x+1.
+		y := x << 1
+		if y&0x100 != 0 {
+			y ^= 0x11b
+		}
+		x ^= y
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// SplitSecret splits secret into n shares, any threshold of which can
+// reconstruct it.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || threshold > n || n > 255 {
+		return nil, errors.New("invalid share parameters: need 2 <= threshold <= shares <= 255")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	defer ZeroBytes(coeffs)
+	for idx, b := range secret {
+		coeffs[0] = b
+		if _, err := io.ReadFull(rand.Reader, coeffs[1:]); err != nil {
+			return nil, errors.Wrap(err, "failed to generate share coefficients")
+		}
+		for _, share := range shares {
+			// Horner evaluation of the polynomial at x.
+			x := share[0]
+			var y byte
+			for k := threshold - 1; k >= 0; k-- {
+				y = gfMul(y, x) ^ coeffs[k]
+			}
+			share[idx+1] = y
+		}
+	}
+	return shares, nil
+}
+
+// CombineShares reconstructs a secret from at least threshold shares using
+// Lagrange interpolation at x = 0. Too few shares yield a wrong secret, which
+// callers detect when the recovered key fails to unwrap.
+func CombineShares(shares [][]byte) (*SecureBuffer, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least two shares are required")
+	}
+	size := len(shares[0])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if len(share) != size || size < 2 {
+			return nil, errors.New("shares have inconsistent lengths")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("duplicate or invalid share")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := NewSecureBuffer(size - 1)
+	out := secret.Bytes()
+	for i, si := range shares {
+		// Lagrange basis polynomial for share i evaluated at 0.
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(sj[0], sj[0]^si[0]))
+			}
+		}
+		for k := range out {
+			out[k] ^= gfMul(si[k+1], basis)
+		}
+	}
+	return secret, nil
+}
@@ -0,0 +1,357 @@
+// Package dateparse reads the dates people type for due dates: "tomorrow",
+// "next friday 5pm", "in 2 weeks", "mar 10", "2026-03-10 17:00" and the like,
+// relative to a given clock and in its time zone.
+//
+// A weekday ("friday", "next friday", "on fri") is the first such day after
+// today; say "today" for today. "next week", "next month" and "next year" are
+// the first day of that period. A time given alone ("5pm") is today.
+package dateparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Result is a parsed date. HasTime is false for a day without a time of day,
+// in which case Time is midnight.
+type Result struct {
+	Time    time.Time
+	HasTime bool
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "tues": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Weekday looks up a weekday by its English name or abbreviation.
+func Weekday(s string) (time.Weekday, bool) {
+	d, ok := weekdays[strings.ToLower(s)]
+	return d, ok
+}
+
+var months = map[string]time.Month{
+	"january": time.January, "february": time.February, "march": time.March, "april": time.April,
+	"may": time.May, "june": time.June, "july": time.July, "august": time.August,
+	"september": time.September, "october": time.October, "november": time.November, "december": time.December,
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September, "sept": time.September,
+	"oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// Unit is a calendar unit for relative dates and intervals.
+type Unit int
+
+const (
+	Minute Unit = iota
+	Hour
+	Day
+	Week
+	Month
+	Year
+)
+
+var units = map[string]Unit{
+	"min": Minute, "mins": Minute, "minute": Minute, "minutes": Minute,
+	"h": Hour, "hr": Hour, "hrs": Hour, "hour": Hour, "hours": Hour,
+	"d": Day, "day": Day, "days": Day,
+	"w": Week, "wk": Week, "wks": Week, "week": Week, "weeks": Week,
+	"mo": Month, "month": Month, "months": Month,
+	"y": Year, "yr": Year, "yrs": Year, "year": Year, "years": Year,
+}
+
+// ParseUnit looks up a unit by name or abbreviation (d, w, mo, y, ...).
+func ParseUnit(s string) (Unit, bool) {
+	u, ok := units[strings.ToLower(s)]
+	return u, ok
+}
+
+// Add moves t by n units.
+func (u Unit) Add(t time.Time, n int) time.Time {
+	switch u {
+	case Minute:
+		return t.Add(time.Duration(n) * time.Minute)
+	case Hour:
+		return t.Add(time.Duration(n) * time.Hour)
+	case Day:
+		return t.AddDate(0, 0, n)
+	case Week:
+		return t.AddDate(0, 0, 7*n)
+	case Month:
+		return addMonths(t, n)
+	default:
+		return addMonths(t, 12*n)
+	}
+}
+
+// addMonths moves t by n months, keeping the day of the month but clamping it
+// to the last day of a shorter month: Jan 31 plus a month is Feb 28, not
+// Mar 3 as with AddDate.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); t.Day() > last {
+		return first.AddDate(0, 0, last-1)
+	}
+	return first.AddDate(0, 0, t.Day()-1)
+}
+
+var (
+	// compactRe matches "3d", "+2w", "90min" and "6mo".
+	compactRe = regexp.MustCompile(`^\+?(\d+)([a-z]+)$`)
+	// clockRe matches "5pm", "5:30pm", "17:00" and "9am".
+	clockRe   = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)?$`)
+	ordinalRe = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?$`)
+	yearRe    = regexp.MustCompile(`^\d{4}$`)
+)
+
+var absoluteLayouts = []struct {
+	layout  string
+	hasTime bool
+}{
+	{"2006-01-02", false},
+	{"2006-01-02 15:04", true},
+	{"2006-01-02T15:04", true},
+	{"2006-01-02 15:04:05", true},
+	{"2006-01-02T15:04:05", true},
+	{"2006/01/02", false},
+}
+
+// Parse reads s relative to now, in now's location.
+func Parse(s string, now time.Time) (Result, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Result{}, errors.New("empty date")
+	}
+	loc := now.Location()
+	for _, l := range absoluteLayouts {
+		if t, err := time.ParseInLocation(l.layout, s, loc); err == nil {
+			return Result{t, l.hasTime}, nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return Result{t.In(loc), true}, nil
+	}
+
+	tokens := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ' ' || r == ',' || r == '\t' })
+	tokens, clock, hasClock, err := takeClock(tokens)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "cannot parse date %q", s)
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	day, exact, err := parseDay(tokens, now, today)
+	if err != nil {
+		return Result{}, errors.Wrapf(err, "cannot parse date %q", s)
+	}
+	if exact {
+		if hasClock {
+			return Result{}, errors.Errorf("cannot parse date %q: a relative time cannot take a time of day", s)
+		}
+		return Result{day, true}, nil
+	}
+	if hasClock {
+		// Set the wall time rather than adding to midnight, which is off by
+		// an hour on days the clocks change.
+		h, m := int(clock/time.Hour), int(clock%time.Hour/time.Minute)
+		return Result{time.Date(day.Year(), day.Month(), day.Day(), h, m, 0, 0, loc), true}, nil
+	}
+	return Result{day, false}, nil
+}
+
+// takeClock removes a time of day ("5pm", "at 17:30", "5 pm", "noon") from
+// tokens and returns it as an offset from midnight.
+func takeClock(tokens []string) ([]string, time.Duration, bool, error) {
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		var clock string
+		n := 1
+		switch {
+		case tok == "noon" || tok == "midday":
+			clock = "12:00"
+		case tok == "midnight":
+			clock = "0:00"
+		case i+1 < len(tokens) && (tokens[i+1] == "am" || tokens[i+1] == "pm") && clockRe.MatchString(tok):
+			clock, n = tok+tokens[i+1], 2
+		case clockRe.MatchString(tok) && (strings.Contains(tok, ":") || strings.HasSuffix(tok, "m")):
+			clock = tok
+		case i > 0 && tokens[i-1] == "at" && clockRe.MatchString(tok):
+			clock = tok
+		default:
+			continue
+		}
+
+		d, err := parseClock(clock)
+		if err != nil {
+			return nil, 0, false, err
+		}
+		start := i
+		if start > 0 && tokens[start-1] == "at" {
+			start--
+		}
+		rest := append(append([]string{}, tokens[:start]...), tokens[i+n:]...)
+		return rest, d, true, nil
+	}
+	return tokens, 0, false, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	if s == "0:00" {
+		return 0, nil
+	}
+	m := clockRe.FindStringSubmatch(s)
+	hour, _ := strconv.Atoi(m[1])
+	minute := 0
+	if m[2] != "" {
+		minute, _ = strconv.Atoi(m[2])
+	}
+	switch m[3] {
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, errors.Errorf("invalid time %q", s)
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return 0, errors.Errorf("invalid time %q", s)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// parseDay reads the date part. exact is set for relative times in minutes or
+// hours, which give a moment rather than a day.
+func parseDay(tokens []string, now, today time.Time) (time.Time, bool, error) {
+	// Filler words: "due friday", "on the 3rd", "by tomorrow".
+	var words []string
+	for _, tok := range tokens {
+		switch tok {
+		case "on", "by", "due", "the", "of", "this":
+		default:
+			words = append(words, tok)
+		}
+	}
+
+	switch strings.Join(words, " ") {
+	case "", "today", "tonight":
+		return today, false, nil
+	case "tomorrow", "tmrw", "tmr":
+		return today.AddDate(0, 0, 1), false, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), false, nil
+	case "next week":
+		offset := (int(time.Monday) - int(today.Weekday()) + 7) % 7
+		if offset == 0 {
+			offset = 7
+		}
+		return today.AddDate(0, 0, offset), false, nil
+	case "next month":
+		return time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), false, nil
+	case "next year":
+		return time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, today.Location()), false, nil
+	case "end month", "eom":
+		return time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location()), false, nil
+	}
+
+	if words[0] == "next" && len(words) == 2 {
+		words = words[1:]
+	}
+	if len(words) == 1 {
+		if wd, ok := weekdays[words[0]]; ok {
+			offset := (int(wd) - int(today.Weekday()) + 7) % 7
+			if offset == 0 {
+				offset = 7
+			}
+			return today.AddDate(0, 0, offset), false, nil
+		}
+	}
+
+	// "in 3 days", "3 days", "3d", "+2w", "2 weeks from now".
+	rel := words
+	if rel[0] == "in" {
+		rel = rel[1:]
+	}
+	if len(rel) >= 2 && rel[len(rel)-2] == "from" && rel[len(rel)-1] == "now" {
+		rel = rel[:len(rel)-2]
+	}
+	var num, unit string
+	switch {
+	case len(rel) == 1 && compactRe.MatchString(rel[0]):
+		m := compactRe.FindStringSubmatch(rel[0])
+		num, unit = m[1], m[2]
+	case len(rel) == 2:
+		num, unit = strings.TrimPrefix(rel[0], "+"), rel[1]
+		if num == "a" || num == "an" {
+			num = "1"
+		}
+	}
+	if n, err := strconv.Atoi(num); err == nil {
+		if u, ok := units[unit]; ok {
+			if u == Minute || u == Hour {
+				return u.Add(now, n).Truncate(time.Minute), true, nil
+			}
+			return u.Add(today, n), false, nil
+		}
+	}
+
+	return monthDay(words, today)
+}
+
+// monthDay reads "mar 10", "10 march", "march 10th 2027" and "10th". Without
+// a year the next such day on or after today is meant.
+func monthDay(words []string, today time.Time) (time.Time, bool, error) {
+	var month time.Month
+	day, year := 0, 0
+	for _, w := range words {
+		if m, ok := months[w]; ok && month == 0 {
+			month = m
+			continue
+		}
+		if yearRe.MatchString(w) && year == 0 {
+			year, _ = strconv.Atoi(w)
+			continue
+		}
+		if m := ordinalRe.FindStringSubmatch(w); m != nil && day == 0 {
+			day, _ = strconv.Atoi(m[1])
+			continue
+		}
+		return time.Time{}, false, errors.Errorf("unexpected %q", w)
+	}
+	if day == 0 {
+		return time.Time{}, false, errors.New("no day given")
+	}
+
+	if month == 0 {
+		if year != 0 {
+			return time.Time{}, false, errors.New("no month given")
+		}
+		// "the 31st": the next month that has one.
+		for i := 0; i < 12; i++ {
+			t := time.Date(today.Year(), today.Month()+time.Month(i), day, 0, 0, 0, 0, today.Location())
+			if t.Day() == day && !t.Before(today) {
+				return t, false, nil
+			}
+		}
+		return time.Time{}, false, errors.Errorf("no month has day %d", day)
+	}
+
+	y := year
+	if y == 0 {
+		y = today.Year()
+	}
+	t := time.Date(y, month, day, 0, 0, 0, 0, today.Location())
+	if year == 0 && t.Before(today) {
+		t = time.Date(y+1, month, day, 0, 0, 0, 0, today.Location())
+	}
+	if t.Day() != day {
+		return time.Time{}, false, errors.Errorf("%s has no day %d", month, day)
+	}
+	return t, false, nil
+}
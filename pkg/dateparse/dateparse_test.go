@@ -0,0 +1,144 @@
+package dateparse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Tuesday, in a zone away from UTC so local-day handling is exercised.
+	zone := time.FixedZone("UTC-5", -5*60*60)
+	now := time.Date(2026, 3, 10, 15, 4, 30, 0, zone)
+
+	tests := []struct {
+		in      string
+		now     time.Time // the clock, if not now
+		want    string    // "2006-01-02" or "2006-01-02 15:04"
+		wantErr bool
+	}{
+		{in: "today", want: "2026-03-10"},
+		{in: "Today", want: "2026-03-10"},
+		{in: "tonight", want: "2026-03-10"},
+		{in: "tomorrow", want: "2026-03-11"},
+		{in: "tmrw", want: "2026-03-11"},
+		{in: "yesterday", want: "2026-03-09"},
+		{in: "by tomorrow", want: "2026-03-11"},
+
+		{in: "friday", want: "2026-03-13"},
+		{in: "fri", want: "2026-03-13"},
+		{in: "next friday", want: "2026-03-13"},
+		{in: "on Friday", want: "2026-03-13"},
+		{in: "tuesday", want: "2026-03-17"},
+		{in: "monday", want: "2026-03-16"},
+		{in: "next friday 5pm", want: "2026-03-13 17:00"},
+		{in: "friday at 9:30am", want: "2026-03-13 09:30"},
+		{in: "thu noon", want: "2026-03-12 12:00"},
+
+		{in: "5pm", want: "2026-03-10 17:00"},
+		{in: "5 pm", want: "2026-03-10 17:00"},
+		{in: "at 17:45", want: "2026-03-10 17:45"},
+		{in: "at 9", want: "2026-03-10 09:00"},
+		{in: "12am", want: "2026-03-10 00:00"},
+		{in: "12pm", want: "2026-03-10 12:00"},
+		{in: "tomorrow midnight", want: "2026-03-11 00:00"},
+		{in: "tomorrow at 8am", want: "2026-03-11 08:00"},
+
+		{in: "in 3 days", want: "2026-03-13"},
+		{in: "3 days", want: "2026-03-13"},
+		{in: "3d", want: "2026-03-13"},
+		{in: "+2w", want: "2026-03-24"},
+		{in: "in a week", want: "2026-03-17"},
+		{in: "2 weeks from now", want: "2026-03-24"},
+		{in: "in 1 month", want: "2026-04-10"},
+		{in: "6mo", want: "2026-09-10"},
+		{in: "in 2 years", want: "2028-03-10"},
+		{in: "in 1 month", now: time.Date(2026, 1, 31, 9, 0, 0, 0, zone), want: "2026-02-28"},
+		{in: "in 1 month", now: time.Date(2028, 1, 31, 9, 0, 0, 0, zone), want: "2028-02-29"},
+		{in: "6mo", now: time.Date(2026, 8, 31, 9, 0, 0, 0, zone), want: "2027-02-28"},
+		{in: "in 1 year", now: time.Date(2028, 2, 29, 9, 0, 0, 0, zone), want: "2029-02-28"},
+		{in: "in 4 years", now: time.Date(2028, 2, 29, 9, 0, 0, 0, zone), want: "2032-02-29"},
+		{in: "in 2 hours", want: "2026-03-10 17:04"},
+		{in: "in 90 minutes", want: "2026-03-10 16:34"},
+		{in: "30min", want: "2026-03-10 15:34"},
+
+		{in: "next week", want: "2026-03-16"},
+		{in: "next month", want: "2026-04-01"},
+		{in: "next year", want: "2027-01-01"},
+		{in: "end of month", want: "2026-03-31"},
+		{in: "eom", want: "2026-03-31"},
+
+		{in: "2026-04-01", want: "2026-04-01"},
+		{in: "2026/04/01", want: "2026-04-01"},
+		{in: "2026-04-01 09:15", want: "2026-04-01 09:15"},
+		{in: "2026-04-01T09:15", want: "2026-04-01 09:15"},
+		{in: "2026-04-01T14:15:00Z", want: "2026-04-01 09:15"},
+		{in: "mar 20", want: "2026-03-20"},
+		{in: "March 20th", want: "2026-03-20"},
+		{in: "20 march", want: "2026-03-20"},
+		{in: "the 20th of march", want: "2026-03-20"},
+		{in: "mar 1", want: "2027-03-01"},
+		{in: "jan 5 2028", want: "2028-01-05"},
+		{in: "dec 25, 2026 6pm", want: "2026-12-25 18:00"},
+		{in: "the 15th", want: "2026-03-15"},
+		{in: "the 5th", want: "2026-04-05"},
+		{in: "31st", want: "2026-03-31"},
+
+		{in: "", wantErr: true},
+		{in: "someday", wantErr: true},
+		{in: "feb 30", wantErr: true},
+		{in: "25pm", wantErr: true},
+		{in: "13:75", wantErr: true},
+		{in: "in 2 hours at 5pm", wantErr: true},
+		{in: "next fortnight", wantErr: true},
+	}
+	for _, tt := range tests {
+		clock := now
+		if !tt.now.IsZero() {
+			clock = tt.now
+		}
+		got, err := Parse(tt.in, clock)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q) = %v, want an error", tt.in, got.Time)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got.Time.Location() != zone {
+			t.Errorf("Parse(%q) is in %v, want the clock's zone", tt.in, got.Time.Location())
+		}
+		layout := "2006-01-02"
+		if got.HasTime {
+			layout = "2006-01-02 15:04"
+		}
+		if s := got.Time.Format(layout); s != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, s, tt.want)
+		}
+	}
+}
+
+func TestParseDST(t *testing.T) {
+	zone, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zone data: %v", err)
+	}
+	// The clocks go forward on Sunday 2026-03-08.
+	now := time.Date(2026, 3, 7, 10, 0, 0, 0, zone)
+	for in, want := range map[string]string{
+		"tomorrow 5pm":      "2026-03-08 17:00 EDT",
+		"tomorrow midnight": "2026-03-08 00:00 EST",
+		"sunday at 9:30am":  "2026-03-08 09:30 EDT",
+	} {
+		got, err := Parse(in, now)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", in, err)
+			continue
+		}
+		if s := got.Time.Format("2006-01-02 15:04 MST"); s != want {
+			t.Errorf("Parse(%q) = %s, want %s", in, s, want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+// Package dbtest opens throwaway databases for tests.
+package dbtest
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+)
+
+// Open returns a migrated database in a temporary directory, closed when the
+// test ends.
+func Open(t testing.TB) *sql.DB {
+	t.Helper()
+	database, err := db.Open(filepath.Join(t.TempDir(), "kylrix.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
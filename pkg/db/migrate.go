@@ -0,0 +1,618 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/nathfavour/kylrix/cli/pkg/markdown"
+	"github.com/pkg/errors"
+)
+
+// migration is one step of the schema history. Migrations run in order, each
+// in its own transaction; the number applied is stored in PRAGMA user_version.
+// Never edit a released migration: append a new one instead.
+type migration struct {
+	name string
+	up   func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{"baseline schema", migrateBaseline},
+	{"tags, notebooks and pinned notes", migrateNoteOrganization},
+	{"encrypted notes", migrateEncryptedNotes},
+	{"note revisions", migrateNoteRevisions},
+	{"record note revisions on update", migrateRevisionTrigger},
+	{"note links", migrateNoteLinks},
+	{"note sync state", migrateNoteSync},
+	{"note attachments", migrateNoteAttachments},
+	{"flow tasks", migrateFlowTasks},
+	{"recurring tasks", migrateRecurringTasks},
+	{"subtasks and task dependencies", migrateTaskGraph},
+	{"time tracking", migrateTimeEntries},
+	{"calendar events", migrateEvents},
+	{"flow sync state", migrateFlowSync},
+	{"note push keys", migrateNotePushKeys},
+	{"flow push keys", migrateFlowPushKeys},
+}
+
+// Migrate applies every migration the database has not seen yet.
+func Migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return errors.Wrapf(err, "migration %d (%s)", i+1, m.name)
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func execAll(tx *sql.Tx, queries ...string) error {
+	for _, q := range queries {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column unless the table already has it.
+func addColumn(q Querier, table, column, definition string) error {
+	rows, err := q.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = q.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// migrateBaseline creates the schema that predates versioned migrations. It is
+// idempotent because databases created by older releases already have some or
+// all of it.
+func migrateBaseline(tx *sql.Tx) error {
+	err := execAll(tx,
+		`CREATE TABLE IF NOT EXISTS vault_secrets (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE,
+			payload TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			title TEXT,
+			content TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := addColumn(tx, "notes", "uid", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "notes", "updated_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	return execAll(tx,
+		// Short stable IDs: 8 hex chars, assigned on insert and backfilled once.
+		`UPDATE notes SET uid = lower(hex(randomblob(4))) WHERE uid IS NULL;`,
+		`UPDATE notes SET updated_at = created_at WHERE updated_at IS NULL;`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_notes_uid ON notes(uid);`,
+		`CREATE TRIGGER IF NOT EXISTS notes_after_insert AFTER INSERT ON notes
+		BEGIN
+			UPDATE notes SET
+				uid = COALESCE(NEW.uid, lower(hex(randomblob(4)))),
+				updated_at = COALESCE(NEW.updated_at, NEW.created_at)
+			WHERE id = NEW.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_touch AFTER UPDATE OF title, content ON notes
+		BEGIN
+			UPDATE notes SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+		END;`,
+		// Full-text index over notes, kept in sync by triggers. rowid = notes.id.
+		`CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(title, content, tokenize = 'porter unicode61');`,
+		`CREATE TRIGGER IF NOT EXISTS notes_fts_insert AFTER INSERT ON notes
+		BEGIN
+			INSERT INTO notes_fts(rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_fts_update AFTER UPDATE OF title, content ON notes
+		BEGIN
+			DELETE FROM notes_fts WHERE rowid = OLD.id;
+			INSERT INTO notes_fts(rowid, title, content) VALUES (NEW.id, NEW.title, NEW.content);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_fts_delete AFTER DELETE ON notes
+		BEGIN
+			DELETE FROM notes_fts WHERE rowid = OLD.id;
+		END;`,
+		// Index notes written before the FTS table existed.
+		`INSERT INTO notes_fts(rowid, title, content)
+			SELECT id, title, content FROM notes WHERE id NOT IN (SELECT rowid FROM notes_fts);`,
+	)
+}
+
+func migrateNoteOrganization(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE notebooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`ALTER TABLE notes ADD COLUMN notebook_id INTEGER REFERENCES notebooks(id) ON DELETE SET NULL;`,
+		`ALTER TABLE notes ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;`,
+		`CREATE INDEX idx_notes_notebook ON notes(notebook_id);`,
+		`CREATE TABLE tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE
+		);`,
+		`CREATE TABLE note_tags (
+			note_id INTEGER NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (note_id, tag_id)
+		);`,
+		`CREATE INDEX idx_note_tags_tag ON note_tags(tag_id);`,
+	)
+}
+
+// migrateEncryptedNotes flags notes whose content is ciphertext. Their titles
+// stay searchable, but their content is kept out of the plaintext FTS index.
+func migrateEncryptedNotes(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE notes ADD COLUMN encrypted INTEGER NOT NULL DEFAULT 0;`,
+		`DROP TRIGGER notes_fts_insert;`,
+		`DROP TRIGGER notes_fts_update;`,
+		`CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes
+		BEGIN
+			INSERT INTO notes_fts(rowid, title, content)
+			VALUES (NEW.id, NEW.title, CASE WHEN NEW.encrypted THEN '' ELSE NEW.content END);
+		END;`,
+		`CREATE TRIGGER notes_fts_update AFTER UPDATE OF title, content, encrypted ON notes
+		BEGIN
+			DELETE FROM notes_fts WHERE rowid = OLD.id;
+			INSERT INTO notes_fts(rowid, title, content)
+			VALUES (NEW.id, NEW.title, CASE WHEN NEW.encrypted THEN '' ELSE NEW.content END);
+		END;`,
+	)
+}
+
+// migrateNoteRevisions keeps earlier versions of notes. Revisions copy the
+// encryption flag so encrypted content stays encrypted in history.
+func migrateNoteRevisions(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE note_revisions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			note_id INTEGER NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			rev INTEGER NOT NULL,
+			title TEXT,
+			content TEXT,
+			encrypted INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (note_id, rev)
+		);`,
+	)
+}
+
+// migrateRevisionTrigger snapshots the previous version of a note whenever its
+// title or content changes, whichever code path made the change. The revision
+// is dated when that version was written.
+func migrateRevisionTrigger(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TRIGGER notes_revision AFTER UPDATE OF title, content ON notes
+		WHEN OLD.title IS NOT NEW.title OR OLD.content IS NOT NEW.content
+		BEGIN
+			INSERT INTO note_revisions (note_id, rev, title, content, encrypted, created_at)
+			SELECT OLD.id, COALESCE(MAX(rev), 0) + 1, OLD.title, OLD.content, OLD.encrypted, OLD.updated_at
+			FROM note_revisions WHERE note_id = OLD.id;
+		END;`,
+	)
+}
+
+// migrateNoteLinks stores the [[wikilinks]] of each note. Targets are kept as
+// written (a title or note ID) and resolved when queried, so a link starts
+// working as soon as its target note exists. Existing notes are backfilled.
+func migrateNoteLinks(tx *sql.Tx) error {
+	err := execAll(tx,
+		`CREATE TABLE note_links (
+			source_id INTEGER NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			target TEXT NOT NULL COLLATE NOCASE,
+			PRIMARY KEY (source_id, target)
+		);`,
+		`CREATE INDEX idx_note_links_target ON note_links(target);`,
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, content FROM notes WHERE encrypted = 0")
+	if err != nil {
+		return err
+	}
+	links := make(map[int64][]string)
+	for rows.Next() {
+		var id int64
+		var content sql.NullString
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		links[id] = markdown.WikiLinks(content.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, targets := range links {
+		for _, target := range targets {
+			if _, err := tx.Exec("INSERT OR IGNORE INTO note_links (source_id, target) VALUES (?, ?)", id, target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateNoteSync tracks notes against the Kylrix Note backend. local_rev is
+// bumped on every local change and synced_rev records the revision last sent,
+// so a note needs pushing when local_rev > synced_rev (or it has no remote_id).
+// base_title/base_content hold the last synced text for three-way merges, and
+// deleting a synced note leaves a tombstone to push.
+func migrateNoteSync(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE notes ADD COLUMN remote_id TEXT;`,
+		`ALTER TABLE notes ADD COLUMN etag TEXT;`,
+		`ALTER TABLE notes ADD COLUMN local_rev INTEGER NOT NULL DEFAULT 1;`,
+		`ALTER TABLE notes ADD COLUMN synced_rev INTEGER NOT NULL DEFAULT 0;`,
+		`ALTER TABLE notes ADD COLUMN base_title TEXT;`,
+		`ALTER TABLE notes ADD COLUMN base_content TEXT;`,
+		`CREATE UNIQUE INDEX idx_notes_remote ON notes(remote_id) WHERE remote_id IS NOT NULL;`,
+		`CREATE TRIGGER notes_sync_dirty AFTER UPDATE OF title, content, encrypted, pinned, notebook_id ON notes
+		WHEN OLD.title IS NOT NEW.title OR OLD.content IS NOT NEW.content OR OLD.encrypted IS NOT NEW.encrypted
+			OR OLD.pinned IS NOT NEW.pinned OR OLD.notebook_id IS NOT NEW.notebook_id
+		BEGIN
+			UPDATE notes SET local_rev = local_rev + 1 WHERE id = NEW.id;
+		END;`,
+		`CREATE TRIGGER note_tags_sync_insert AFTER INSERT ON note_tags
+		BEGIN
+			UPDATE notes SET local_rev = local_rev + 1 WHERE id = NEW.note_id;
+		END;`,
+		`CREATE TRIGGER note_tags_sync_delete AFTER DELETE ON note_tags
+		BEGIN
+			UPDATE notes SET local_rev = local_rev + 1 WHERE id = OLD.note_id;
+		END;`,
+		`CREATE TABLE note_tombstones (
+			remote_id TEXT PRIMARY KEY,
+			etag TEXT,
+			deleted_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TRIGGER notes_tombstone AFTER DELETE ON notes WHEN OLD.remote_id IS NOT NULL
+		BEGIN
+			INSERT OR REPLACE INTO note_tombstones (remote_id, etag) VALUES (OLD.remote_id, OLD.etag);
+		END;`,
+		// Sync cursors and other per-database sync bookkeeping.
+		`CREATE TABLE sync_state (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);`,
+	)
+}
+
+func migrateNoteAttachments(tx *sql.Tx) error {
+	return execAll(tx,
+		// One row per stored file, keyed by the SHA-256 of its content; the
+		// file itself lives in the attachments folder of the data dir.
+		`CREATE TABLE attachments (
+			hash TEXT PRIMARY KEY,
+			size INTEGER NOT NULL,
+			mime TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE note_attachments (
+			note_id INTEGER NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			hash TEXT NOT NULL REFERENCES attachments(hash),
+			name TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (note_id, hash)
+		);`,
+		`CREATE INDEX idx_note_attachments_hash ON note_attachments(hash);`,
+	)
+}
+
+func migrateFlowTasks(tx *sql.Tx) error {
+	return execAll(tx,
+		`CREATE TABLE projects (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		// due is local wall time, "2006-01-02" or "2006-01-02 15:04", so a
+		// task due on a day stays due that day wherever it is viewed.
+		`CREATE TABLE tasks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uid TEXT UNIQUE,
+			title TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'todo' CHECK (status IN ('todo', 'doing', 'blocked', 'done')),
+			priority INTEGER NOT NULL DEFAULT 0,
+			due TEXT,
+			project_id INTEGER REFERENCES projects(id) ON DELETE SET NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			completed_at DATETIME
+		);`,
+		`CREATE INDEX idx_tasks_status ON tasks(status);`,
+		`CREATE INDEX idx_tasks_project ON tasks(project_id);`,
+		`CREATE TABLE task_tags (
+			task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			tag TEXT NOT NULL COLLATE NOCASE,
+			PRIMARY KEY (task_id, tag)
+		);`,
+		`CREATE TRIGGER tasks_after_insert AFTER INSERT ON tasks
+		BEGIN
+			UPDATE tasks SET
+				uid = COALESCE(NEW.uid, lower(hex(randomblob(4)))),
+				completed_at = CASE WHEN NEW.status = 'done' THEN COALESCE(NEW.completed_at, CURRENT_TIMESTAMP) END
+			WHERE id = NEW.id;
+		END;`,
+		// completed_at follows the status: set when a task is done, cleared
+		// when it is reopened.
+		`CREATE TRIGGER tasks_touch AFTER UPDATE OF title, status, priority, due, project_id ON tasks
+		BEGIN
+			UPDATE tasks SET
+				updated_at = CURRENT_TIMESTAMP,
+				completed_at = CASE WHEN NEW.status = 'done' THEN COALESCE(NEW.completed_at, CURRENT_TIMESTAMP) END
+			WHERE id = NEW.id;
+		END;`,
+	)
+}
+
+func migrateRecurringTasks(tx *sql.Tx) error {
+	if err := addColumn(tx, "tasks", "recur", "TEXT"); err != nil {
+		return err
+	}
+	return execAll(tx,
+		`DROP TRIGGER tasks_touch;`,
+		`CREATE TRIGGER tasks_touch AFTER UPDATE OF title, status, priority, due, project_id, recur ON tasks
+		BEGIN
+			UPDATE tasks SET
+				updated_at = CURRENT_TIMESTAMP,
+				completed_at = CASE WHEN NEW.status = 'done' THEN COALESCE(NEW.completed_at, CURRENT_TIMESTAMP) END
+			WHERE id = NEW.id;
+		END;`,
+	)
+}
+
+func migrateTaskGraph(tx *sql.Tx) error {
+	if err := addColumn(tx, "tasks", "parent_id", "INTEGER REFERENCES tasks(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+	return execAll(tx,
+		`CREATE INDEX idx_tasks_parent ON tasks(parent_id);`,
+		// task_id cannot start until blocked_by is done.
+		`CREATE TABLE task_deps (
+			task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			blocked_by INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			PRIMARY KEY (task_id, blocked_by),
+			CHECK (task_id != blocked_by)
+		);`,
+		`CREATE INDEX idx_task_deps_blocked_by ON task_deps(blocked_by);`,
+		`DROP TRIGGER tasks_touch;`,
+		`CREATE TRIGGER tasks_touch AFTER UPDATE OF title, status, priority, due, project_id, recur, parent_id ON tasks
+		BEGIN
+			UPDATE tasks SET
+				updated_at = CURRENT_TIMESTAMP,
+				completed_at = CASE WHEN NEW.status = 'done' THEN COALESCE(NEW.completed_at, CURRENT_TIMESTAMP) END
+			WHERE id = NEW.id;
+		END;`,
+	)
+}
+
+func migrateTimeEntries(tx *sql.Tx) error {
+	return execAll(tx,
+		// Times are UTC text in CURRENT_TIMESTAMP form (TEXT, so the driver
+		// hands them back unchanged); ended_at is NULL while the timer runs.
+		`CREATE TABLE time_entries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+			started_at TEXT NOT NULL,
+			ended_at TEXT,
+			CHECK (ended_at IS NULL OR ended_at >= started_at)
+		);`,
+		`CREATE INDEX idx_time_entries_task ON time_entries(task_id);`,
+		`CREATE INDEX idx_time_entries_started ON time_entries(started_at);`,
+		// Only one timer can run at a time.
+		`CREATE UNIQUE INDEX idx_time_entries_running ON time_entries((ended_at IS NULL)) WHERE ended_at IS NULL;`,
+	)
+}
+
+func migrateEvents(tx *sql.Tx) error {
+	if err := addColumn(tx, "tasks", "ical_uid", "TEXT"); err != nil {
+		return err
+	}
+	return execAll(tx,
+		// ical_uid is the UID of an imported VTODO or VEVENT, so importing the
+		// same calendar again updates rather than duplicates.
+		`CREATE UNIQUE INDEX idx_tasks_ical_uid ON tasks(ical_uid);`,
+		// starts_at and ends_at are wall times in tz, "2006-01-02" for all-day
+		// events or "2006-01-02 15:04"; tz is an IANA zone name, or empty for
+		// times that follow the local zone. ends_at is exclusive.
+		`CREATE TABLE events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			uid TEXT UNIQUE,
+			ical_uid TEXT UNIQUE,
+			title TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			location TEXT NOT NULL DEFAULT '',
+			starts_at TEXT NOT NULL,
+			ends_at TEXT NOT NULL,
+			tz TEXT NOT NULL DEFAULT '',
+			recur TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE INDEX idx_events_starts_at ON events(starts_at);`,
+		`CREATE TRIGGER events_after_insert AFTER INSERT ON events
+		BEGIN
+			UPDATE events SET uid = COALESCE(NEW.uid, lower(hex(randomblob(4)))) WHERE id = NEW.id;
+		END;`,
+		`CREATE TRIGGER events_touch AFTER UPDATE OF title, description, location, starts_at, ends_at, tz, recur ON events
+		BEGIN
+			UPDATE events SET updated_at = CURRENT_TIMESTAMP WHERE id = NEW.id;
+		END;`,
+	)
+}
+
+// syncNow is the time a change is queued for Flow sync: UTC with
+// milliseconds, so last-writer-wins can tell close edits apart.
+const syncNow = `strftime('%Y-%m-%dT%H:%M:%fZ', 'now')`
+
+// migrateFlowSync tracks tasks and events against the Kylrix Flow backend.
+// Once a row has a remote_id, every change to a synced field queues that field
+// in flow_pending with the time it changed; the queue survives offline use and
+// is replayed on the next sync. An event's start, end and zone always travel
+// together. Deleting a synced row leaves a tombstone, and conflicts resolved
+// by last-writer-wins are kept in flow_conflicts.
+func migrateFlowSync(tx *sql.Tx) error {
+	if err := addColumn(tx, "tasks", "remote_id", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumn(tx, "events", "remote_id", "TEXT"); err != nil {
+		return err
+	}
+	pending := func(kind, id, field, when string) string {
+		return `INSERT OR REPLACE INTO flow_pending (kind, row_id, field, changed_at)
+			SELECT '` + kind + `', ` + id + `, '` + field + `', ` + syncNow + ` WHERE ` + when + `;`
+	}
+	synced := func(id string) string {
+		return "EXISTS (SELECT 1 FROM tasks WHERE id = " + id + " AND remote_id IS NOT NULL)"
+	}
+	return execAll(tx,
+		`CREATE UNIQUE INDEX idx_tasks_remote ON tasks(remote_id) WHERE remote_id IS NOT NULL;`,
+		`CREATE UNIQUE INDEX idx_events_remote ON events(remote_id) WHERE remote_id IS NOT NULL;`,
+		`CREATE TABLE flow_pending (
+			kind TEXT NOT NULL CHECK (kind IN ('task', 'event')),
+			row_id INTEGER NOT NULL,
+			field TEXT NOT NULL,
+			changed_at TEXT NOT NULL,
+			PRIMARY KEY (kind, row_id, field)
+		);`,
+		`CREATE TABLE flow_tombstones (
+			kind TEXT NOT NULL CHECK (kind IN ('task', 'event')),
+			remote_id TEXT NOT NULL,
+			title TEXT NOT NULL DEFAULT '',
+			deleted_at TEXT NOT NULL,
+			PRIMARY KEY (kind, remote_id)
+		);`,
+		`CREATE TABLE flow_conflicts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			title TEXT NOT NULL,
+			field TEXT NOT NULL,
+			local_value TEXT NOT NULL,
+			remote_value TEXT NOT NULL,
+			winner TEXT NOT NULL CHECK (winner IN ('local', 'remote')),
+			resolved_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TRIGGER tasks_sync_pending AFTER UPDATE OF title, status, priority, due, recur, project_id, parent_id ON tasks
+		WHEN NEW.remote_id IS NOT NULL
+		BEGIN
+			`+pending("task", "NEW.id", "title", "OLD.title IS NOT NEW.title")+`
+			`+pending("task", "NEW.id", "status", "OLD.status IS NOT NEW.status")+`
+			`+pending("task", "NEW.id", "priority", "OLD.priority IS NOT NEW.priority")+`
+			`+pending("task", "NEW.id", "due", "OLD.due IS NOT NEW.due")+`
+			`+pending("task", "NEW.id", "recur", "OLD.recur IS NOT NEW.recur")+`
+			`+pending("task", "NEW.id", "project", "OLD.project_id IS NOT NEW.project_id")+`
+			`+pending("task", "NEW.id", "parent", "OLD.parent_id IS NOT NEW.parent_id")+`
+		END;`,
+		`CREATE TRIGGER task_tags_sync_insert AFTER INSERT ON task_tags WHEN `+synced("NEW.task_id")+`
+		BEGIN
+			`+pending("task", "NEW.task_id", "tags", "1")+`
+		END;`,
+		`CREATE TRIGGER task_tags_sync_delete AFTER DELETE ON task_tags WHEN `+synced("OLD.task_id")+`
+		BEGIN
+			`+pending("task", "OLD.task_id", "tags", "1")+`
+		END;`,
+		`CREATE TRIGGER task_deps_sync_insert AFTER INSERT ON task_deps WHEN `+synced("NEW.task_id")+`
+		BEGIN
+			`+pending("task", "NEW.task_id", "blocked_by", "1")+`
+		END;`,
+		`CREATE TRIGGER task_deps_sync_delete AFTER DELETE ON task_deps WHEN `+synced("OLD.task_id")+`
+		BEGIN
+			`+pending("task", "OLD.task_id", "blocked_by", "1")+`
+		END;`,
+		`CREATE TRIGGER tasks_sync_delete AFTER DELETE ON tasks
+		BEGIN
+			DELETE FROM flow_pending WHERE kind = 'task' AND row_id = OLD.id;
+			INSERT OR REPLACE INTO flow_tombstones (kind, remote_id, title, deleted_at)
+			SELECT 'task', OLD.remote_id, OLD.title, `+syncNow+` WHERE OLD.remote_id IS NOT NULL;
+		END;`,
+		`CREATE TRIGGER events_sync_pending AFTER UPDATE OF title, description, location, starts_at, ends_at, tz, recur ON events
+		WHEN NEW.remote_id IS NOT NULL
+		BEGIN
+			`+pending("event", "NEW.id", "title", "OLD.title IS NOT NEW.title")+`
+			`+pending("event", "NEW.id", "description", "OLD.description IS NOT NEW.description")+`
+			`+pending("event", "NEW.id", "location", "OLD.location IS NOT NEW.location")+`
+			`+pending("event", "NEW.id", "recur", "OLD.recur IS NOT NEW.recur")+`
+			`+pending("event", "NEW.id", "start", "OLD.starts_at IS NOT NEW.starts_at OR OLD.ends_at IS NOT NEW.ends_at OR OLD.tz IS NOT NEW.tz")+`
+			`+pending("event", "NEW.id", "end", "OLD.starts_at IS NOT NEW.starts_at OR OLD.ends_at IS NOT NEW.ends_at OR OLD.tz IS NOT NEW.tz")+`
+			`+pending("event", "NEW.id", "tz", "OLD.starts_at IS NOT NEW.starts_at OR OLD.ends_at IS NOT NEW.ends_at OR OLD.tz IS NOT NEW.tz")+`
+		END;`,
+		`CREATE TRIGGER events_sync_delete AFTER DELETE ON events
+		BEGIN
+			DELETE FROM flow_pending WHERE kind = 'event' AND row_id = OLD.id;
+			INSERT OR REPLACE INTO flow_tombstones (kind, remote_id, title, deleted_at)
+			SELECT 'event', OLD.remote_id, OLD.title, `+syncNow+` WHERE OLD.remote_id IS NOT NULL;
+		END;`,
+	)
+}
+
+// migrateNotePushKeys gives a note about to be created on the backend a key
+// that is sent as the Idempotency-Key of the POST. It is kept until the remote
+// ID is recorded, so a create whose reply was lost is retried, not repeated.
+func migrateNotePushKeys(tx *sql.Tx) error {
+	return execAll(tx, `ALTER TABLE notes ADD COLUMN push_key TEXT;`)
+}
+
+// migrateFlowPushKeys does the same for tasks and events created on the Kylrix
+// Flow backend.
+func migrateFlowPushKeys(tx *sql.Tx) error {
+	return execAll(tx,
+		`ALTER TABLE tasks ADD COLUMN push_key TEXT;`,
+		`ALTER TABLE events ADD COLUMN push_key TEXT;`,
+	)
+}
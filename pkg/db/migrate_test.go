@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateUpgradesLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kylrix.db")
+
+	// Schema as written by releases before versioned migrations.
+	legacy, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open legacy db: %v", err)
+	}
+	_, err = legacy.Exec(`CREATE TABLE notes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		title TEXT,
+		content TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO notes (title, content) VALUES ('old', 'legacy content');`)
+	if err != nil {
+		t.Fatalf("seed legacy db: %v", err)
+	}
+	legacy.Close()
+
+	database, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer database.Close()
+
+	var version int
+	if err := database.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Errorf("expected user_version %d, got %d", len(migrations), version)
+	}
+
+	var uid string
+	var pinned bool
+	if err := database.QueryRow("SELECT uid, pinned FROM notes WHERE title = 'old'").Scan(&uid, &pinned); err != nil {
+		t.Fatalf("legacy note not upgraded: %v", err)
+	}
+	if len(uid) != 8 || pinned {
+		t.Errorf("unexpected upgraded values: uid=%q pinned=%v", uid, pinned)
+	}
+
+	var hits int
+	if err := database.QueryRow("SELECT COUNT(*) FROM notes_fts WHERE notes_fts MATCH 'legacy'").Scan(&hits); err != nil {
+		t.Fatal(err)
+	}
+	if hits != 1 {
+		t.Errorf("legacy note should be indexed, got %d hits", hits)
+	}
+
+	// Re-opening must be a no-op.
+	database.Close()
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("second Open failed: %v", err)
+	}
+	reopened.Close()
+}
@@ -8,39 +8,49 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Querier is satisfied by both *sql.DB and *sql.Tx so store functions can run
+// inside or outside a transaction.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func InitDB() (*sql.DB, error) {
 	dataDir, err := config.GetDataDir()
 	if err != nil {
 		return nil, err
 	}
 
-	dbPath := filepath.Join(dataDir, "kylrix.db")
-	db, err := sql.Open("sqlite", dbPath)
+	return Open(filepath.Join(dataDir, "kylrix.db"))
+}
+
+// Open opens the SQLite database at path and brings its schema up to date.
+func Open(path string) (*sql.DB, error) {
+	// Foreign keys are off by default in SQLite and are a per-connection
+	// setting, so enable them for every connection in the pool.
+	db, err := sql.Open("sqlite", path+"?_pragma=foreign_keys(1)")
 	if err != nil {
 		return nil, err
 	}
 
-	// Create tables if they don't exist
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS vault_secrets (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT UNIQUE,
-			payload TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-		`CREATE TABLE IF NOT EXISTS notes (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			title TEXT,
-			content TEXT,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);`,
-	}
-
-	for _, q := range queries {
-		if _, err := db.Exec(q); err != nil {
-			return nil, err
-		}
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
 	}
 
 	return db, nil
 }
+
+// InTx runs fn in a transaction on database and commits it if fn succeeds.
+func InTx(database *sql.DB, fn func(q Querier) error) error {
+	tx, err := database.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
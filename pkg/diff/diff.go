@@ -0,0 +1,176 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpKind says how a line moves from the old text to the new one.
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Insert
+	Delete
+)
+
+// Op is one line of an edit script.
+type Op struct {
+	Kind OpKind
+	Line string // includes its trailing "\n", except possibly the last line
+}
+
+// SplitLines splits s into lines that keep their "\n", so joining them gives s back.
+func SplitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines computes a shortest edit script from a to b (Myers' algorithm).
+func Lines(a, b []string) []Op {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b, offset)
+			}
+		}
+	}
+	return nil
+}
+
+// backtrack walks the saved frontiers from the end back to the start.
+func backtrack(trace [][]int, a, b []string, offset int) []Op {
+	var ops []Op
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, Op{Equal, a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, Op{Insert, b[y-1]})
+			} else {
+				ops = append(ops, Op{Delete, a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// Unified renders the changes from a to b as a unified diff with the given
+// number of context lines. It returns "" when the texts are identical.
+func Unified(a, b, fromLabel, toLabel string, context int) string {
+	ops := Lines(SplitLines(a), SplitLines(b))
+
+	var changes []int
+	for i, op := range ops {
+		if op.Kind != Equal {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	// Line numbers (1-based) in a and b at the start of each op.
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	aLine[0], bLine[0] = 1, 1
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.Kind != Insert {
+			aLine[i+1]++
+		}
+		if op.Kind != Delete {
+			bLine[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+
+	for i := 0; i < len(changes); {
+		start := changes[i] - context
+		if start < 0 {
+			start = 0
+		}
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*context+1 {
+			j++
+		}
+		end := changes[j] + context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aCount, bCount := aLine[end]-aLine[start], bLine[end]-bLine[start]
+		aStart, bStart := aLine[start], bLine[start]
+		// Empty ranges point at the line before, as diff(1) does.
+		if aCount == 0 {
+			aStart--
+		}
+		if bCount == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aCount, bStart, bCount)
+
+		for _, op := range ops[start:end] {
+			prefix := " "
+			switch op.Kind {
+			case Insert:
+				prefix = "+"
+			case Delete:
+				prefix = "-"
+			}
+			out.WriteString(prefix + strings.TrimSuffix(op.Line, "\n") + "\n")
+			if !strings.HasSuffix(op.Line, "\n") {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		i = j + 1
+	}
+	return out.String()
+}
@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func apply(ops []Op) (string, string) {
+	var a, b strings.Builder
+	for _, op := range ops {
+		if op.Kind != Insert {
+			a.WriteString(op.Line)
+		}
+		if op.Kind != Delete {
+			b.WriteString(op.Line)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestLinesReconstructsBothSides(t *testing.T) {
+	cases := [][2]string{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb\nc\n", "a\nc\nd"},
+		{"one\ntwo\nthree\nfour\n", "zero\none\nthree\nfour\nfive\n"},
+	}
+	for _, c := range cases {
+		ops := Lines(SplitLines(c[0]), SplitLines(c[1]))
+		a, b := apply(ops)
+		if a != c[0] || b != c[1] {
+			t.Errorf("edit script for %q -> %q rebuilt %q -> %q", c[0], c[1], a, b)
+		}
+	}
+}
+
+func TestUnified(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11"
+
+	got := Unified(a, b, "rev 1", "current", 1)
+	want := `--- rev 1
++++ current
+@@ -2,3 +2,3 @@
+ 2
+-3
++three
+ 4
+@@ -10,1 +10,2 @@
+ 10
++11
+\ No newline at end of file
+`
+	if got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if Unified(a, a, "x", "y", 3) != "" {
+		t.Error("identical texts should produce an empty diff")
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\nfive\n"
+	tests := []struct {
+		name, local, remote, want string
+		ok                        bool
+	}{
+		{"only local", "one\nTWO\nthree\nfour\nfive\n", base, "one\nTWO\nthree\nfour\nfive\n", true},
+		{"separate edits", "one\nTWO\nthree\nfour\nfive\n", "one\ntwo\nthree\nfour\nFIVE\n", "one\nTWO\nthree\nfour\nFIVE\n", true},
+		{"both append", base + "six\n", "zero\n" + base, "zero\n" + base + "six\n", true},
+		{"same edit", "one\nTWO\nthree\nfour\nfive\n", "one\nTWO\nthree\nfour\nfive\nsix\n", "one\nTWO\nthree\nfour\nfive\nsix\n", true},
+		{"conflict", "one\nTWO\nthree\nfour\nfive\n", "one\n2\nthree\nfour\nfive\n", "", false},
+		{"insert at same place", "one\ntwo\nA\nthree\nfour\nfive\n", "one\ntwo\nB\nthree\nfour\nfive\n", "", false},
+		{"no final newline", "one\ntwo\nthree\nfour\nfive\nsix", "ONE\ntwo\nthree\nfour\nfive\n", "ONE\ntwo\nthree\nfour\nfive\nsix", true},
+	}
+	for _, tt := range tests {
+		got, ok := Merge3(base, tt.local, tt.remote)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: Merge3 = %q, %v; want %q, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
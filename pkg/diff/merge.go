@@ -0,0 +1,156 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+)
+
+// hunk replaces base[start:end] with lines.
+type hunk struct {
+	start, end int
+	lines      []string
+	remote     bool
+}
+
+// hunks groups an edit script from base into replacements of base ranges.
+func hunks(base, other []string, remote bool) []hunk {
+	var result []hunk
+	var cur *hunk
+	i := 0
+	for _, op := range Lines(base, other) {
+		if op.Kind == Equal {
+			if cur != nil {
+				result = append(result, *cur)
+				cur = nil
+			}
+			i++
+			continue
+		}
+		if cur == nil {
+			cur = &hunk{start: i, end: i, remote: remote}
+		}
+		if op.Kind == Delete {
+			cur.end++
+			i++
+		} else {
+			cur.lines = append(cur.lines, op.Line)
+		}
+	}
+	if cur != nil {
+		result = append(result, *cur)
+	}
+	return result
+}
+
+// region returns base[lo:hi] with the given hunks (all inside it) applied.
+func region(base []string, lo, hi int, hs []hunk) []string {
+	var out []string
+	pos := lo
+	for _, h := range hs {
+		out = append(out, base[pos:h.start]...)
+		out = append(out, h.lines...)
+		pos = h.end
+	}
+	return append(out, base[pos:hi]...)
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge3 merges the changes local and remote each made to base, line by line.
+// Changes to different parts of the text are combined; overlapping changes
+// merge only when they are identical. ok is false on a conflict, in which case
+// merged is empty.
+func Merge3(base, local, remote string) (merged string, ok bool) {
+	switch {
+	case local == remote || base == remote:
+		return local, true
+	case base == local:
+		return remote, true
+	}
+
+	// Compare whole lines: a missing final newline would otherwise turn an
+	// append on one side into a change of the last line.
+	nl, ok := Merge3Value(strings.HasSuffix(base, "\n"), strings.HasSuffix(local, "\n"), strings.HasSuffix(remote, "\n"))
+	if !ok {
+		nl = strings.HasSuffix(local, "\n")
+	}
+	b, l, r := SplitLines(withNewline(base)), SplitLines(withNewline(local)), SplitLines(withNewline(remote))
+
+	all := append(hunks(b, l, false), hunks(b, r, true)...)
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end < all[j].end
+	})
+
+	var out []string
+	pos := 0
+	for i := 0; i < len(all); {
+		lo, hi := all[i].start, all[i].end
+		var mine, theirs []hunk
+		j := i
+		for ; j < len(all) && (j == i || all[j].start < hi || all[j].start == lo); j++ {
+			if all[j].end > hi {
+				hi = all[j].end
+			}
+			if all[j].remote {
+				theirs = append(theirs, all[j])
+			} else {
+				mine = append(mine, all[j])
+			}
+		}
+		i = j
+
+		out = append(out, b[pos:lo]...)
+		switch {
+		case len(theirs) == 0:
+			out = append(out, region(b, lo, hi, mine)...)
+		case len(mine) == 0:
+			out = append(out, region(b, lo, hi, theirs)...)
+		default:
+			ours, other := region(b, lo, hi, mine), region(b, lo, hi, theirs)
+			if !equalLines(ours, other) {
+				return "", false
+			}
+			out = append(out, ours...)
+		}
+		pos = hi
+	}
+	out = append(out, b[pos:]...)
+
+	merged = strings.Join(out, "")
+	if !nl {
+		merged = strings.TrimSuffix(merged, "\n")
+	}
+	return merged, true
+}
+
+// Merge3Value merges a single value: a side that left it unchanged takes the
+// other side's change. ok is false when both changed it differently.
+func Merge3Value[T comparable](base, local, remote T) (T, bool) {
+	switch {
+	case local == remote || base == remote:
+		return local, true
+	case base == local:
+		return remote, true
+	}
+	return local, false
+}
+
+func withNewline(s string) string {
+	if s == "" || strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -0,0 +1,77 @@
+package flow
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+)
+
+// Board is the tasks of one project laid out in a column per status, in
+// Statuses order. Project is empty for tasks outside any project.
+type Board struct {
+	Project string
+	Columns [][]Task
+}
+
+// Column returns the index of a status in Statuses, or -1.
+func Column(status string) int {
+	for i, s := range Statuses {
+		if s == status {
+			return i
+		}
+	}
+	return -1
+}
+
+// Boards lays out every task, one board per project by name and the tasks
+// without a project last. Columns keep the list order; done tasks come most
+// recently completed first.
+func Boards(q db.Querier) ([]Board, error) {
+	tasks, err := List(q, Filter{AllStatus: true})
+	if err != nil {
+		return nil, err
+	}
+	byProject := make(map[string]*Board)
+	var names []string
+	for _, t := range tasks {
+		b, ok := byProject[t.Project]
+		if !ok {
+			b = &Board{Project: t.Project, Columns: make([][]Task, len(Statuses))}
+			byProject[t.Project] = b
+			names = append(names, t.Project)
+		}
+		if c := Column(t.Status); c >= 0 {
+			b.Columns[c] = append(b.Columns[c], t)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if (names[i] == "") != (names[j] == "") {
+			return names[j] == ""
+		}
+		return strings.ToLower(names[i]) < strings.ToLower(names[j])
+	})
+
+	boards := make([]Board, len(names))
+	for i, name := range names {
+		b := byProject[name]
+		done := b.Columns[Column(Done)]
+		sort.SliceStable(done, func(i, j int) bool {
+			return done[i].CompletedAt > done[j].CompletedAt
+		})
+		boards[i] = *b
+	}
+	return boards, nil
+}
+
+// Move puts t in another status column. Moving a task to done completes it
+// (see Complete, without force) and returns the next instance of a recurring
+// task.
+func Move(q db.Querier, t *Task, status string, now time.Time) (*Task, error) {
+	if status == Done {
+		return Complete(q, t, now, false)
+	}
+	t.Status = status
+	return nil, Update(q, t)
+}
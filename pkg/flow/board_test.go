@@ -0,0 +1,51 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestBoards(t *testing.T) {
+	q := dbtest.Open(t)
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+
+	Create(q, Task{Title: "Loose end"})
+	Create(q, Task{Title: "Deploy", Project: "site", Status: Doing})
+	Create(q, Task{Title: "Fix header", Project: "site"})
+	water, _ := Create(q, Task{Title: "Water plants", Project: "Home", Due: "2026-03-10", Recur: "FREQ=WEEKLY"})
+	parent, _ := Create(q, Task{Title: "Redesign", Project: "site"})
+	Create(q, Task{Title: "Mockups", Project: "site", ParentID: parent.ID})
+
+	boards, err := Boards(q)
+	if err != nil {
+		t.Fatalf("Boards failed: %v", err)
+	}
+	if len(boards) != 3 || boards[0].Project != "Home" || boards[1].Project != "site" || boards[2].Project != "" {
+		t.Fatalf("boards = %+v", boards)
+	}
+	site := boards[1]
+	if len(site.Columns[Column(Todo)]) != 3 || len(site.Columns[Column(Doing)]) != 1 {
+		t.Fatalf("site columns = %+v", site.Columns)
+	}
+
+	next, err := Move(q, water, Done, now)
+	if err != nil || next == nil || next.Due != "2026-03-17" {
+		t.Fatalf("Move to done = %+v, %v", next, err)
+	}
+	if _, err := Move(q, parent, Done, now); err == nil {
+		t.Error("moved a task with open subtasks to done")
+	}
+	if _, err := Move(q, parent, Blocked, now); err != nil {
+		t.Fatal(err)
+	}
+	boards, _ = Boards(q)
+	home := boards[0]
+	if len(home.Columns[Column(Done)]) != 1 || len(home.Columns[Column(Todo)]) != 1 {
+		t.Errorf("home columns after move = %+v", home.Columns)
+	}
+	if got := boards[1].Columns[Column(Blocked)]; len(got) != 1 || got[0].Title != "Redesign" {
+		t.Errorf("blocked column = %+v", got)
+	}
+}
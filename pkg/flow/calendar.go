@@ -0,0 +1,335 @@
+package flow
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/ical"
+	"github.com/nathfavour/kylrix/cli/pkg/recur"
+)
+
+// uidDomain marks the iCalendar UIDs of events and tasks created here, so a
+// calendar exported and imported again updates them.
+const uidDomain = "@kylrix"
+
+func icalUID(uid, imported string) string {
+	if imported != "" {
+		return imported
+	}
+	return uid + uidDomain
+}
+
+// VTODO priorities are 1 (highest) to 9; 0 means none.
+var todoPriorities = map[int]string{3: "1", 2: "5", 1: "9"}
+
+func parseTodoPriority(s string) int {
+	p, _ := strconv.Atoi(strings.TrimSpace(s))
+	switch {
+	case p >= 1 && p <= 4:
+		return 3
+	case p == 5:
+		return 2
+	case p >= 6 && p <= 9:
+		return 1
+	}
+	return 0
+}
+
+var todoStatuses = map[string]string{Todo: "NEEDS-ACTION", Doing: "IN-PROCESS", Blocked: "NEEDS-ACTION", Done: "COMPLETED"}
+
+// Calendar builds a VCALENDAR of every event and, with withTasks, the tasks
+// that have a due date as VTODOs. now stamps the entries and picks the year
+// the VTIMEZONE rules are written for.
+func Calendar(q db.Querier, withTasks bool, now time.Time) (*ical.Component, error) {
+	cal := ical.New("VCALENDAR")
+	cal.Add("VERSION", "2.0")
+	cal.Add("PRODID", "-//Kylrix//Flow//EN")
+	cal.Add("CALSCALE", "GREGORIAN")
+	stamp := now.UTC().Format(ical.UTCLayout)
+
+	events, err := Events(q)
+	if err != nil {
+		return nil, err
+	}
+	zones := make(map[string]bool)
+	var items []*ical.Component
+	for i := range events {
+		e := &events[i]
+		if e.TZ != "" && e.TZ != "UTC" && !zones[e.TZ] {
+			zones[e.TZ] = true
+			cal.Components = append(cal.Components, ical.VTimezone(e.Start.Location(), now.Year()))
+		}
+		v := ical.New("VEVENT")
+		v.Add("UID", icalUID(e.UID, e.ICalUID))
+		v.Add("DTSTAMP", stamp)
+		v.AddText("SUMMARY", e.Title)
+		v.AddText("DESCRIPTION", e.Description)
+		v.AddText("LOCATION", e.Location)
+		v.AddDateTime("DTSTART", ical.DateTime{Time: e.Start, AllDay: e.AllDay, TZID: e.TZ})
+		v.AddDateTime("DTEND", ical.DateTime{Time: e.End, AllDay: e.AllDay, TZID: e.TZ})
+		if e.Recur != "" {
+			v.Add("RRULE", e.Recur)
+		}
+		items = append(items, v)
+	}
+
+	if withTasks {
+		tasks, err := List(q, Filter{AllStatus: true})
+		if err != nil {
+			return nil, err
+		}
+		imported, err := importedTaskUIDs(q)
+		if err != nil {
+			return nil, err
+		}
+		for i := range tasks {
+			t := &tasks[i]
+			due, ok := DueTime(t.Due, time.Local)
+			if !ok {
+				continue
+			}
+			v := ical.New("VTODO")
+			v.Add("UID", icalUID(t.UID, imported[t.ID]))
+			v.Add("DTSTAMP", stamp)
+			v.AddText("SUMMARY", t.Title)
+			allDay := len(t.Due) == len(DateLayout)
+			if allDay {
+				due, _ = time.ParseInLocation(DateLayout, t.Due, time.Local)
+			}
+			// Due dates are local wall times, which iCalendar calls floating.
+			v.AddDateTime("DUE", ical.DateTime{Time: due, AllDay: allDay})
+			v.Add("STATUS", todoStatuses[t.Status])
+			if p, ok := todoPriorities[t.Priority]; ok {
+				v.Add("PRIORITY", p)
+			}
+			if len(t.Tags) > 0 {
+				tags := make([]string, len(t.Tags))
+				for i, tag := range t.Tags {
+					tags[i] = ical.Escape(tag)
+				}
+				v.Add("CATEGORIES", strings.Join(tags, ","))
+			}
+			if t.Recur != "" {
+				v.Add("RRULE", t.Recur)
+			}
+			items = append(items, v)
+		}
+	}
+	cal.Components = append(cal.Components, items...)
+	return cal, nil
+}
+
+func importedTaskUIDs(q db.Querier) (map[int64]string, error) {
+	rows, err := q.Query("SELECT id, ical_uid FROM tasks WHERE ical_uid IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	uids := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var uid string
+		if err := rows.Scan(&id, &uid); err != nil {
+			return nil, err
+		}
+		uids[id] = uid
+	}
+	return uids, rows.Err()
+}
+
+// CalendarImport counts what ImportCalendar did. Warnings name the entries,
+// or the parts of them, that were left out.
+type CalendarImport struct {
+	EventsCreated int
+	EventsUpdated int
+	TasksCreated  int
+	TasksUpdated  int
+	Warnings      []string
+}
+
+// ImportCalendar stores the VEVENTs of cal as events and its VTODOs as tasks.
+// Entries whose UID was imported or exported before update the matching event
+// or task instead of adding another.
+func ImportCalendar(q db.Querier, cal *ical.Component) (*CalendarImport, error) {
+	result := &CalendarImport{}
+	zones := ical.ZonesOf(cal)
+	for _, v := range cal.Children("VEVENT") {
+		if err := importEvent(q, v, zones, result); err != nil {
+			return nil, err
+		}
+	}
+	for _, v := range cal.Children("VTODO") {
+		if err := importTodo(q, v, zones, result); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// entryName names a calendar entry in warnings.
+func entryName(v *ical.Component) string {
+	if s := v.Text("SUMMARY"); s != "" {
+		return fmt.Sprintf("%q", s)
+	}
+	return v.Text("UID")
+}
+
+// importRule checks an RRULE against what package recur supports.
+func importRule(v *ical.Component, loc *time.Location, result *CalendarImport) string {
+	p := v.Prop("RRULE")
+	if p == nil {
+		return ""
+	}
+	rule, err := recur.ParseRRule(p.Value, loc)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s: %v; only the first occurrence was kept", entryName(v), err))
+		return ""
+	}
+	if v.Prop("EXDATE") != nil || v.Prop("RDATE") != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s: added and excluded dates (RDATE, EXDATE) were ignored", entryName(v)))
+	}
+	return rule.String()
+}
+
+func importEvent(q db.Querier, v *ical.Component, zones ical.Zones, result *CalendarImport) error {
+	if v.Prop("RECURRENCE-ID") != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s: changes to single occurrences were skipped", entryName(v)))
+		return nil
+	}
+	if strings.EqualFold(v.Text("STATUS"), "CANCELLED") {
+		return nil
+	}
+	p := v.Prop("DTSTART")
+	if p == nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s: skipped, no start time", entryName(v)))
+		return nil
+	}
+	start, err := p.DateTime(zones)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s: skipped, %v", entryName(v), err))
+		return nil
+	}
+
+	e := Event{
+		ICalUID:     v.Text("UID"),
+		Title:       v.Text("SUMMARY"),
+		Description: v.Text("DESCRIPTION"),
+		Location:    v.Text("LOCATION"),
+		Start:       start.Time,
+		AllDay:      start.AllDay,
+		TZ:          start.TZID,
+	}
+	if e.Title == "" {
+		e.Title = "(no title)"
+	}
+	if p := v.Prop("DTEND"); p != nil {
+		end, err := p.DateTime(zones)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entryName(v), err)
+		}
+		e.End = end.Time.In(e.Start.Location())
+	} else if p := v.Prop("DURATION"); p != nil {
+		if e.End, err = ical.AddDuration(e.Start, p.Value); err != nil {
+			return fmt.Errorf("%s: %w", entryName(v), err)
+		}
+	}
+	e.Recur = importRule(v, e.Start.Location(), result)
+
+	existing, err := findImported(q, "events", e.ICalUID)
+	if err != nil {
+		return err
+	}
+	if existing == 0 {
+		if _, err := CreateEvent(q, e); err != nil {
+			return fmt.Errorf("%s: %w", entryName(v), err)
+		}
+		result.EventsCreated++
+		return nil
+	}
+	e.ID = existing
+	if err := UpdateEvent(q, &e); err != nil {
+		return fmt.Errorf("%s: %w", entryName(v), err)
+	}
+	result.EventsUpdated++
+	return nil
+}
+
+var todoStatusesIn = map[string]string{"NEEDS-ACTION": Todo, "IN-PROCESS": Doing, "COMPLETED": Done}
+
+func importTodo(q db.Querier, v *ical.Component, zones ical.Zones, result *CalendarImport) error {
+	state := strings.ToUpper(v.Text("STATUS"))
+	if state == "CANCELLED" {
+		return nil
+	}
+	status, ok := todoStatusesIn[state]
+	if !ok {
+		status = Todo
+	}
+	t := Task{
+		Title:    v.Text("SUMMARY"),
+		Status:   status,
+		Priority: parseTodoPriority(v.Text("PRIORITY")),
+		Tags:     v.TextList("CATEGORIES"),
+	}
+	if t.Title == "" {
+		t.Title = "(no title)"
+	}
+	if p := v.Prop("DUE"); p != nil {
+		due, err := p.DateTime(zones)
+		if err != nil {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s: due date dropped, %v", entryName(v), err))
+		} else {
+			t.Due = FormatDue(due.Time.In(time.Local), !due.AllDay)
+		}
+	}
+	t.Recur = importRule(v, time.Local, result)
+
+	uid := v.Text("UID")
+	existing, err := findImported(q, "tasks", uid)
+	if err != nil {
+		return err
+	}
+	if existing == 0 {
+		created, err := Create(q, t)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entryName(v), err)
+		}
+		if uid != "" {
+			if _, err := q.Exec("UPDATE tasks SET ical_uid = ? WHERE id = ?", uid, created.ID); err != nil {
+				return err
+			}
+		}
+		result.TasksCreated++
+		return nil
+	}
+
+	current, err := GetByID(q, existing)
+	if err != nil {
+		return err
+	}
+	current.Title, current.Status, current.Priority, current.Due, current.Recur = t.Title, t.Status, t.Priority, t.Due, t.Recur
+	if err := Update(q, current); err != nil {
+		return fmt.Errorf("%s: %w", entryName(v), err)
+	}
+	if err := AddTags(q, current.ID, t.Tags...); err != nil {
+		return err
+	}
+	result.TasksUpdated++
+	return nil
+}
+
+// findImported returns the row ID of the event or task (table) an iCalendar
+// UID refers to: one imported with it, or one of ours by its Kylrix ID. It is 0
+// when there is none.
+func findImported(q db.Querier, table, uid string) (int64, error) {
+	if uid == "" {
+		return 0, nil
+	}
+	var id int64
+	err := q.QueryRow("SELECT COALESCE((SELECT id FROM "+table+" WHERE ical_uid = ? OR (ical_uid IS NULL AND uid || ? = ?)), 0)",
+		uid, uidDomain, uid).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,180 @@
+package flow
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+	"github.com/nathfavour/kylrix/cli/pkg/ical"
+)
+
+const calendarFile = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:standup@example.com
+SUMMARY:Standup
+DTSTART;TZID=America/New_York:20260302T090000
+DURATION:PT15M
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=6
+END:VEVENT
+BEGIN:VEVENT
+UID:offsite@example.com
+SUMMARY:Offsite
+LOCATION:Lisbon
+DTSTART;VALUE=DATE:20260311
+DTEND;VALUE=DATE:20260313
+END:VEVENT
+BEGIN:VEVENT
+UID:yearly@example.com
+SUMMARY:Review
+DTSTART:20260310T150000Z
+RRULE:FREQ=YEARLY;BYMONTH=3
+END:VEVENT
+BEGIN:VTODO
+UID:todo-1@example.com
+SUMMARY:File taxes
+DUE;VALUE=DATE:20260415
+PRIORITY:1
+STATUS:NEEDS-ACTION
+CATEGORIES:money,admin
+END:VTODO
+END:VCALENDAR
+`
+
+func decodeCalendar(t *testing.T, src string) *ical.Component {
+	t.Helper()
+	roots, err := ical.Decode(strings.NewReader(src))
+	if err != nil || len(roots) != 1 {
+		t.Fatalf("Decode = %v, %v", roots, err)
+	}
+	return roots[0]
+}
+
+func TestImportCalendar(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	q := dbtest.Open(t)
+
+	result, err := ImportCalendar(q, decodeCalendar(t, calendarFile))
+	if err != nil {
+		t.Fatalf("ImportCalendar failed: %v", err)
+	}
+	if result.EventsCreated != 3 || result.TasksCreated != 1 || len(result.Warnings) != 1 {
+		t.Fatalf("import result = %+v", result)
+	}
+
+	task, err := Get(q, "file taxes")
+	if err != nil || task.Due != "2026-04-15" || task.Priority != 3 || len(task.Tags) != 2 {
+		t.Fatalf("imported task = %+v, %v", task, err)
+	}
+
+	// The standup keeps 09:00 New York time across the change to daylight
+	// saving time on March 8, and stops after six occurrences.
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, newYork)
+	occurrences, err := Occurrences(q, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var standups []time.Time
+	for _, o := range occurrences {
+		if o.Event.Title == "Standup" {
+			standups = append(standups, o.Start)
+			if o.End.Sub(o.Start) != 15*time.Minute {
+				t.Errorf("standup lasts %v", o.End.Sub(o.Start))
+			}
+		}
+	}
+	if len(standups) != 6 {
+		t.Fatalf("got %d standups: %v", len(standups), standups)
+	}
+	for _, s := range standups {
+		if local := s.In(newYork); local.Hour() != 9 {
+			t.Errorf("standup at %v", local)
+		}
+	}
+	offsite, _ := GetEvent(q, "offsite")
+	if !offsite.AllDay || offsite.End.Sub(offsite.Start) < 47*time.Hour || offsite.Location != "Lisbon" {
+		t.Errorf("offsite = %+v", offsite)
+	}
+
+	// Exporting and importing again updates instead of duplicating.
+	cal, err := Calendar(q, true, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Children("VTIMEZONE")) != 1 || len(cal.Children("VEVENT")) != 3 || len(cal.Children("VTODO")) != 1 {
+		t.Fatalf("exported calendar = %+v", cal)
+	}
+	var buf bytes.Buffer
+	if err := ical.Encode(&buf, cal); err != nil {
+		t.Fatal(err)
+	}
+	result, err = ImportCalendar(q, decodeCalendar(t, buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.EventsCreated != 0 || result.EventsUpdated != 3 || result.TasksCreated != 0 || result.TasksUpdated != 1 {
+		t.Errorf("reimport result = %+v", result)
+	}
+
+	// Tasks of our own come back by their ID.
+	mine, _ := Create(q, Task{Title: "Book venue", Due: "2026-03-20 17:00"})
+	cal, _ = Calendar(q, true, time.Now())
+	buf.Reset()
+	ical.Encode(&buf, cal)
+	mine.Title = "Renamed here"
+	Update(q, mine)
+	if _, err := ImportCalendar(q, decodeCalendar(t, buf.String())); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetByID(q, mine.ID); got.Title != "Book venue" || got.Due != "2026-03-20 17:00" {
+		t.Errorf("own task after import = %+v", got)
+	}
+}
+
+// Rules that never produce another occurrence must not stall the agenda.
+const neverCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+BEGIN:VEVENT
+UID:sixth@example.com
+SUMMARY:Sixth Monday
+DTSTART:20260302T090000Z
+RRULE:FREQ=MONTHLY;BYDAY=6MO
+END:VEVENT
+BEGIN:VEVENT
+UID:feb30@example.com
+SUMMARY:February 30th
+DTSTART:20260210T090000Z
+RRULE:FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestImportCalendarUnmatchedRules(t *testing.T) {
+	q := dbtest.Open(t)
+	result, err := ImportCalendar(q, decodeCalendar(t, neverCalendar))
+	if err != nil {
+		t.Fatalf("ImportCalendar failed: %v", err)
+	}
+	// The sixth Monday is rejected; the 30th of February is a valid rule
+	// that simply never comes.
+	if result.EventsCreated != 2 || len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "6MO") {
+		t.Fatalf("import result = %+v", result)
+	}
+	if e, err := GetEvent(q, "Sixth Monday"); err != nil || e.Recur != "" {
+		t.Errorf("event with a rejected rule = %+v, %v", e, err)
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	occurrences, err := Occurrences(q, from, from.AddDate(2, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(occurrences) != 2 {
+		t.Errorf("got %d occurrences, want only the first of each", len(occurrences))
+	}
+}
@@ -0,0 +1,267 @@
+package flow
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/recur"
+	"github.com/pkg/errors"
+)
+
+// ErrEventNotFound is returned when no event matches a reference.
+var ErrEventNotFound = errors.New("event not found")
+
+// Event is a row of the events table. Start and End are in the event's zone,
+// time.Local when TZ is empty; End is exclusive, so a one-day event ends at
+// midnight of the next day.
+type Event struct {
+	ID          int64
+	UID         string
+	ICalUID     string
+	Title       string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	TZ          string // IANA zone name; "" follows the local zone
+	Recur       string // RRULE value; see package recur
+	CreatedAt   string
+	UpdatedAt   string
+}
+
+// Zone loads the event's time zone.
+func (e *Event) Zone() (*time.Location, error) {
+	if e.TZ == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(e.TZ)
+	return loc, errors.Wrapf(err, "event %s", e.UID)
+}
+
+const eventColumns = `e.id, e.uid, COALESCE(e.ical_uid, ''), e.title, e.description, e.location,
+	e.starts_at, e.ends_at, e.tz, COALESCE(e.recur, ''), e.created_at, e.updated_at`
+
+const eventOrder = ` ORDER BY e.starts_at, e.id`
+
+func scanEvents(rows *sql.Rows) ([]Event, error) {
+	defer rows.Close()
+	var result []Event
+	for rows.Next() {
+		var e Event
+		var start, end string
+		err := rows.Scan(&e.ID, &e.UID, &e.ICalUID, &e.Title, &e.Description, &e.Location,
+			&start, &end, &e.TZ, &e.Recur, &e.CreatedAt, &e.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := e.Zone()
+		if err != nil {
+			return nil, err
+		}
+		if e.Start, err = parseWall(start, loc); err != nil {
+			return nil, err
+		}
+		if e.End, err = parseWall(end, loc); err != nil {
+			return nil, err
+		}
+		e.AllDay = len(start) == len(DateLayout)
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// parseWall reads a stored wall time, with or without a time of day.
+func parseWall(s string, loc *time.Location) (time.Time, error) {
+	layout := DateTimeLayout
+	if len(s) == len(DateLayout) {
+		layout = DateLayout
+	}
+	t, err := time.ParseInLocation(layout, s, loc)
+	return t, errors.Wrapf(err, "invalid event time %q", s)
+}
+
+// Events lists all events by start.
+func Events(q db.Querier) ([]Event, error) {
+	rows, err := q.Query("SELECT " + eventColumns + " FROM events e" + eventOrder)
+	if err != nil {
+		return nil, err
+	}
+	return scanEvents(rows)
+}
+
+// GetEvent resolves ref as an exact ID, then an ID prefix, then a title
+// (ignoring case).
+func GetEvent(q db.Querier, ref string) (*Event, error) {
+	type lookup struct {
+		where string
+		args  []interface{}
+	}
+	id := strings.ToLower(ref)
+	lookups := []lookup{{"e.uid = ?", []interface{}{id}}}
+	if len(ref) >= minPrefix {
+		lookups = append(lookups, lookup{"substr(e.uid, 1, ?) = ?", []interface{}{len(id), id}})
+	}
+	lookups = append(lookups, lookup{"e.title = ? COLLATE NOCASE", []interface{}{ref}})
+
+	for _, l := range lookups {
+		rows, err := q.Query("SELECT "+eventColumns+" FROM events e WHERE "+l.where+eventOrder, l.args...)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := scanEvents(rows)
+		if err != nil {
+			return nil, err
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return &matches[0], nil
+		default:
+			ids := make([]string, len(matches))
+			for i, e := range matches {
+				ids[i] = e.UID
+			}
+			return nil, fmt.Errorf("'%s' matches %d events (%s); use an ID", ref, len(matches), strings.Join(ids, ", "))
+		}
+	}
+	return nil, errors.Wrapf(ErrEventNotFound, "'%s'", ref)
+}
+
+func getEventWhere(q db.Querier, where string, args ...interface{}) (*Event, error) {
+	rows, err := q.Query("SELECT "+eventColumns+" FROM events e WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrEventNotFound
+	}
+	return &matches[0], nil
+}
+
+// GetEventByID loads an event by its row ID.
+func GetEventByID(q db.Querier, id int64) (*Event, error) {
+	return getEventWhere(q, "e.id = ?", id)
+}
+
+// eventTimes renders the start and end of e for storage.
+func eventTimes(e *Event) (string, string, error) {
+	if !e.End.IsZero() && e.End.Before(e.Start) {
+		return "", "", errors.New("an event cannot end before it starts")
+	}
+	end := e.End
+	if end.IsZero() {
+		end = e.Start
+		if e.AllDay {
+			end = e.Start.AddDate(0, 0, 1)
+		}
+	}
+	return FormatDue(e.Start, !e.AllDay), FormatDue(end, !e.AllDay), nil
+}
+
+// CreateEvent inserts e and returns the stored event. A zero End means a
+// one-day event for all-day events and a moment otherwise.
+func CreateEvent(q db.Querier, e Event) (*Event, error) {
+	start, end, err := eventTimes(&e)
+	if err != nil {
+		return nil, err
+	}
+	res, err := q.Exec(`INSERT INTO events (ical_uid, title, description, location, starts_at, ends_at, tz, recur)
+		VALUES (NULLIF(?, ''), ?, ?, ?, ?, ?, ?, NULLIF(?, ''))`,
+		e.ICalUID, e.Title, e.Description, e.Location, start, end, e.TZ, e.Recur)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetEventByID(q, id)
+}
+
+// UpdateEvent saves every field of e but its IDs.
+func UpdateEvent(q db.Querier, e *Event) error {
+	start, end, err := eventTimes(e)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`UPDATE events SET title = ?, description = ?, location = ?, starts_at = ?, ends_at = ?,
+		tz = ?, recur = NULLIF(?, '') WHERE id = ?`,
+		e.Title, e.Description, e.Location, start, end, e.TZ, e.Recur, e.ID)
+	return err
+}
+
+// DeleteEvent removes an event.
+func DeleteEvent(q db.Querier, id int64) error {
+	_, err := q.Exec("DELETE FROM events WHERE id = ?", id)
+	return err
+}
+
+// Occurrence is one instance of an event, the only one unless it recurs.
+type Occurrence struct {
+	Event *Event
+	Start time.Time
+	End   time.Time
+}
+
+// maxOccurrences bounds the expansion of one recurring event.
+const maxOccurrences = 10000
+
+// Occurrences lists the event instances overlapping [from, to), by start.
+// Recurring events are expanded in their own zone, so they keep their wall
+// time across daylight saving changes. A rule that cannot be read yields only
+// the first instance.
+func Occurrences(q db.Querier, from, to time.Time) ([]Occurrence, error) {
+	rows, err := q.Query("SELECT "+eventColumns+" FROM events e WHERE e.starts_at < ? OR e.recur IS NOT NULL"+eventOrder,
+		// Stored times are wall times in various zones; a day of margin
+		// covers every offset.
+		to.AddDate(0, 0, 1).Format(DateTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Occurrence
+	for i := range events {
+		e := &events[i]
+		length := e.End.Sub(e.Start)
+		start := e.Start
+		var rule *recur.Rule
+		if e.Recur != "" {
+			rule, _ = recur.ParseRRule(e.Recur, start.Location())
+		}
+		for n := 0; n < maxOccurrences && start.Before(to); n++ {
+			end := start.Add(length)
+			if e.AllDay {
+				// Whole days, whatever the daylight saving changes in between.
+				end = start.AddDate(0, 0, int(length.Hours()+12)/24)
+			}
+			if end.After(from) || (length == 0 && !start.Before(from)) {
+				result = append(result, Occurrence{Event: e, Start: start, End: end})
+			}
+			if rule == nil {
+				break
+			}
+			var ok bool
+			if start, rule, ok = rule.Next(start); !ok {
+				break
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result, nil
+}
@@ -0,0 +1,183 @@
+package flow
+
+import (
+	"fmt"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/pkg/errors"
+)
+
+// Tasks form two graphs: subtasks hang off a parent (tasks.parent_id), and a
+// task can be blocked by others until they are done (task_deps).
+
+// OpenSubtasksError is returned when completing a task whose subtasks are not
+// all done.
+type OpenSubtasksError struct {
+	Task *Task
+	Open int
+}
+
+func (e *OpenSubtasksError) Error() string {
+	return fmt.Sprintf("task %s has %d open subtasks", e.Task.UID, e.Open)
+}
+
+// reaches reports whether a path leads from one task to another by the given
+// edge query, which selects the next task ids for "?". It guards against
+// cycles when linking tasks.
+func reaches(q db.Querier, edge string, from, to int64) (bool, error) {
+	var found bool
+	err := q.QueryRow(`WITH RECURSIVE walk(id) AS (
+			SELECT ?
+			UNION
+			SELECT e.next FROM walk JOIN (`+edge+`) e ON e.id = walk.id
+		)
+		SELECT EXISTS (SELECT 1 FROM walk WHERE id = ?)`, from, to).Scan(&found)
+	return found, err
+}
+
+const (
+	parentEdge = `SELECT id, parent_id AS next FROM tasks WHERE parent_id IS NOT NULL`
+	blockEdge  = `SELECT task_id AS id, blocked_by AS next FROM task_deps`
+)
+
+// SetParent makes taskID a subtask of parentID, or a top-level task when
+// parentID is 0.
+func SetParent(q db.Querier, taskID, parentID int64) error {
+	if parentID != 0 {
+		// parentID must not already be below taskID.
+		cycle, err := reaches(q, parentEdge, parentID, taskID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errors.New("a task cannot be placed under itself or one of its subtasks")
+		}
+	}
+	_, err := q.Exec("UPDATE tasks SET parent_id = NULLIF(?, 0) WHERE id = ? AND parent_id IS NOT NULLIF(?, 0)", parentID, taskID, parentID)
+	return err
+}
+
+// Subtasks lists the direct subtasks of a task, in list order.
+func Subtasks(q db.Querier, parentID int64) ([]Task, error) {
+	rows, err := q.Query("SELECT "+columns+" FROM tasks t WHERE t.parent_id = ?"+order, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return scan(rows)
+}
+
+// OpenSubtasks counts the subtasks, at any depth, of a task that are not done.
+func OpenSubtasks(q db.Querier, taskID int64) (int, error) {
+	var n int
+	err := q.QueryRow(`WITH RECURSIVE below(id) AS (
+			SELECT id FROM tasks WHERE parent_id = ?
+			UNION
+			SELECT t.id FROM tasks t JOIN below ON t.parent_id = below.id
+		)
+		SELECT COUNT(*) FROM tasks WHERE id IN below AND status != 'done'`, taskID).Scan(&n)
+	return n, err
+}
+
+// completeSubtasks marks every open subtask of a task, at any depth, done.
+func completeSubtasks(q db.Querier, taskID int64) error {
+	_, err := q.Exec(`WITH RECURSIVE below(id) AS (
+			SELECT id FROM tasks WHERE parent_id = ?
+			UNION
+			SELECT t.id FROM tasks t JOIN below ON t.parent_id = below.id
+		)
+		UPDATE tasks SET status = 'done' WHERE id IN below AND status != 'done'`, taskID)
+	return err
+}
+
+// AddBlocker records that taskID cannot start before blockerID is done.
+func AddBlocker(q db.Querier, taskID, blockerID int64) error {
+	if taskID == blockerID {
+		return errors.New("a task cannot block itself")
+	}
+	cycle, err := reaches(q, blockEdge, blockerID, taskID)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return errors.New("that dependency would make the tasks wait on each other")
+	}
+	_, err = q.Exec("INSERT OR IGNORE INTO task_deps (task_id, blocked_by) VALUES (?, ?)", taskID, blockerID)
+	return err
+}
+
+// RemoveBlocker drops a dependency. Unknown dependencies are ignored.
+func RemoveBlocker(q db.Querier, taskID, blockerID int64) error {
+	_, err := q.Exec("DELETE FROM task_deps WHERE task_id = ? AND blocked_by = ?", taskID, blockerID)
+	return err
+}
+
+// Blockers lists the tasks a task is blocked by, done or not.
+func Blockers(q db.Querier, taskID int64) ([]Task, error) {
+	rows, err := q.Query("SELECT "+columns+" FROM tasks t WHERE t.id IN (SELECT blocked_by FROM task_deps WHERE task_id = ?)"+order, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return scan(rows)
+}
+
+// Next returns the tasks that can be worked on now, highest priority first:
+// open, not marked blocked, not waiting on other tasks, and without open
+// subtasks (whose subtasks are listed instead).
+func Next(q db.Querier, limit int) ([]Task, error) {
+	rows, err := q.Query(`SELECT `+columns+` FROM tasks t
+		WHERE t.status IN ('todo', 'doing')
+		AND NOT EXISTS (SELECT 1 FROM task_deps d JOIN tasks b ON b.id = d.blocked_by
+			WHERE d.task_id = t.id AND b.status != 'done')
+		AND NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = t.id AND c.status != 'done')
+		ORDER BY t.priority DESC, t.status = 'doing' DESC, t.due IS NULL, t.due, t.id
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scan(rows)
+}
+
+// Node is a task placed in a tree, with the prefix that draws its branch.
+type Node struct {
+	Task   *Task
+	Depth  int
+	Prefix string
+}
+
+// Tree orders tasks depth first under their parents, keeping the order of
+// tasks among siblings. A task whose parent is not in tasks is a root.
+func Tree(tasks []Task) []Node {
+	present := make(map[int64]bool)
+	for _, t := range tasks {
+		present[t.ID] = true
+	}
+	children := make(map[int64][]*Task)
+	var roots []*Task
+	for i := range tasks {
+		t := &tasks[i]
+		if t.ParentID != 0 && present[t.ParentID] {
+			children[t.ParentID] = append(children[t.ParentID], t)
+		} else {
+			roots = append(roots, t)
+		}
+	}
+
+	var nodes []Node
+	var walk func(list []*Task, depth int, indent string)
+	walk = func(list []*Task, depth int, indent string) {
+		for i, t := range list {
+			last := i == len(list)-1
+			prefix, next := "", ""
+			if depth > 0 {
+				prefix, next = indent+"├─ ", indent+"│  "
+				if last {
+					prefix, next = indent+"└─ ", indent+"   "
+				}
+			}
+			nodes = append(nodes, Node{Task: t, Depth: depth, Prefix: prefix})
+			walk(children[t.ID], depth+1, next)
+		}
+	}
+	walk(roots, 0, "")
+	return nodes
+}
@@ -0,0 +1,72 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestTaskGraph(t *testing.T) {
+	q := dbtest.Open(t)
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+
+	launch, _ := Create(q, Task{Title: "Launch", Priority: 3})
+	design, _ := Create(q, Task{Title: "Design", Priority: 2, ParentID: launch.ID})
+	build, _ := Create(q, Task{Title: "Build", Priority: 3, ParentID: launch.ID})
+	mockups, _ := Create(q, Task{Title: "Mockups", Priority: 1, ParentID: design.ID})
+	Create(q, Task{Title: "Email", Priority: 1, Status: Blocked})
+	Create(q, Task{Title: "Tidy desk"})
+
+	if err := SetParent(q, launch.ID, mockups.ID); err == nil {
+		t.Error("SetParent allowed a task under its own subtask")
+	}
+	if err := AddBlocker(q, build.ID, design.ID); err != nil {
+		t.Fatalf("AddBlocker failed: %v", err)
+	}
+	if err := AddBlocker(q, design.ID, build.ID); err == nil {
+		t.Error("AddBlocker allowed a cycle")
+	}
+	if got, _ := GetByID(q, build.ID); got.Waiting != 1 {
+		t.Errorf("build waits on %d tasks, want 1", got.Waiting)
+	}
+
+	// Launch and Design have open subtasks, Build waits on Design and Email
+	// is blocked.
+	next, _ := Next(q, 10)
+	if len(next) != 2 || next[0].Title != "Mockups" || next[1].Title != "Tidy desk" {
+		t.Fatalf("Next = %+v", next)
+	}
+
+	list, _ := List(q, Filter{})
+	var tree []string
+	for _, n := range Tree(list) {
+		if n.Task.ParentID != 0 || n.Task.Title == "Launch" {
+			tree = append(tree, n.Prefix+n.Task.Title)
+		}
+	}
+	want := []string{"Launch", "├─ Build", "└─ Design", "   └─ Mockups"}
+	if len(tree) != len(want) {
+		t.Fatalf("Tree = %q", tree)
+	}
+	for i := range want {
+		if tree[i] != want[i] {
+			t.Errorf("Tree[%d] = %q, want %q", i, tree[i], want[i])
+		}
+	}
+
+	_, err := Complete(q, launch, now, false)
+	if e, ok := err.(*OpenSubtasksError); !ok || e.Open != 3 {
+		t.Fatalf("Complete with open subtasks = %v", err)
+	}
+	if _, err := Complete(q, design, now, true); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetByID(q, mockups.ID); got.Status != Done {
+		t.Errorf("forced completion left subtask %s", got.Status)
+	}
+	next, _ = Next(q, 1)
+	if len(next) != 1 || next[0].Title != "Build" {
+		t.Errorf("Next after design = %+v", next)
+	}
+}
@@ -0,0 +1,76 @@
+package flow
+
+import (
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/recur"
+)
+
+// Complete marks t as done. For a recurring task it also creates the next
+// instance, due at the first occurrence after the completed one that is not
+// already in the past, and returns it.
+//
+// A task with open subtasks is refused with an *OpenSubtasksError unless
+// force is set, in which case the subtasks are completed with it. Run it in a
+// transaction so the task, its subtasks and the next instance change together.
+func Complete(q db.Querier, t *Task, now time.Time, force bool) (*Task, error) {
+	open, err := OpenSubtasks(q, t.ID)
+	if err != nil {
+		return nil, err
+	}
+	if open > 0 {
+		if !force {
+			return nil, &OpenSubtasksError{Task: t, Open: open}
+		}
+		if err := completeSubtasks(q, t.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	t.Status = Done
+	if err := Update(q, t); err != nil {
+		return nil, err
+	}
+	if t.Recur == "" {
+		return nil, nil
+	}
+
+	rule, err := recur.ParseRRule(t.Recur, now.Location())
+	if err != nil {
+		return nil, err
+	}
+	// Without a due date the rule counts from today.
+	from, hasTime := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()), false
+	if t.Due != "" {
+		hasTime = strings.Contains(t.Due, " ")
+		layout := DateLayout
+		if hasTime {
+			layout = DateTimeLayout
+		}
+		if from, err = time.ParseInLocation(layout, t.Due, now.Location()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Occurrences missed while the task was overdue are skipped.
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next, rule, ok := rule.Next(from)
+	for ok && next.Before(today) {
+		next, rule, ok = rule.Next(next)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	return Create(q, Task{
+		Title:    t.Title,
+		Priority: t.Priority,
+		Due:      FormatDue(next, hasTime),
+		Project:  t.Project,
+		Tags:     t.Tags,
+		Recur:    rule.String(),
+		ParentID: t.ParentID,
+	})
+}
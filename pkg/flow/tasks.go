@@ -0,0 +1,412 @@
+// Package flow stores Kylrix Flow tasks in the local database.
+package flow
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/dateparse"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when no task matches a reference.
+var ErrNotFound = errors.New("task not found")
+
+// minPrefix is the shortest ID prefix accepted when looking a task up.
+const minPrefix = 4
+
+// Task statuses, in board order.
+const (
+	Todo    = "todo"
+	Doing   = "doing"
+	Blocked = "blocked"
+	Done    = "done"
+)
+
+// Statuses lists the valid statuses in board order.
+var Statuses = []string{Todo, Doing, Blocked, Done}
+
+// ParseStatus checks a status name.
+func ParseStatus(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, status := range Statuses {
+		if s == status {
+			return s, nil
+		}
+	}
+	return "", errors.Errorf("unknown status %q (use %s)", s, strings.Join(Statuses, ", "))
+}
+
+// Priorities names the priority levels, lowest first.
+var Priorities = []string{"none", "low", "medium", "high"}
+
+// ParsePriority accepts a priority name, its first letter, or its number.
+func ParsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range Priorities {
+		if s == name || s == name[:1] || s == strconv.Itoa(i) {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("unknown priority %q (use %s)", s, strings.Join(Priorities, ", "))
+}
+
+// PriorityName returns the name of priority p.
+func PriorityName(p int) string {
+	if p < 0 || p >= len(Priorities) {
+		return strconv.Itoa(p)
+	}
+	return Priorities[p]
+}
+
+// Due layouts. Due dates are local wall time; a date without a time is due by
+// the end of that day.
+const (
+	DateLayout     = "2006-01-02"
+	DateTimeLayout = "2006-01-02 15:04"
+)
+
+// ParseDue reads a due date such as "tomorrow", "next friday 5pm", "in 2
+// weeks" or "2026-03-10" (see dateparse) and returns it in due form.
+func ParseDue(s string, now time.Time) (string, error) {
+	r, err := dateparse.Parse(s, now)
+	if err != nil {
+		return "", err
+	}
+	return FormatDue(r.Time, r.HasTime), nil
+}
+
+// FormatDue renders t as a due value, with or without its time of day.
+func FormatDue(t time.Time, hasTime bool) string {
+	if hasTime {
+		return t.Format(DateTimeLayout)
+	}
+	return t.Format(DateLayout)
+}
+
+// DueTime returns the moment a due string expires in loc.
+func DueTime(due string, loc *time.Location) (time.Time, bool) {
+	if t, err := time.ParseInLocation(DateTimeLayout, due, loc); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation(DateLayout, due, loc); err == nil {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond), true
+	}
+	return time.Time{}, false
+}
+
+// Task is a row of the tasks table.
+type Task struct {
+	ID          int64
+	UID         string
+	Title       string
+	Status      string
+	Priority    int
+	Due         string // local wall time; see DateLayout and DateTimeLayout
+	Project     string
+	Tags        []string
+	Recur       string // RRULE value; see package recur
+	ParentID    int64  // 0 for a top-level task
+	Waiting     int    // open tasks this one is blocked by
+	CreatedAt   string
+	UpdatedAt   string
+	CompletedAt string
+}
+
+// Overdue reports whether t is open and past its due date at now.
+func (t *Task) Overdue(now time.Time) bool {
+	due, ok := DueTime(t.Due, now.Location())
+	return ok && t.Status != Done && due.Before(now)
+}
+
+// AmbiguousError lists the tasks matching a reference that is not unique.
+type AmbiguousError struct {
+	Ref     string
+	Matches []Task
+}
+
+func (e *AmbiguousError) Error() string {
+	ids := make([]string, len(e.Matches))
+	for i, t := range e.Matches {
+		ids[i] = t.UID
+	}
+	return fmt.Sprintf("'%s' matches %d tasks (%s); use an ID", e.Ref, len(e.Matches), strings.Join(ids, ", "))
+}
+
+// columns selects a Task from "tasks t", including its project name and tags.
+const columns = `t.id, t.uid, t.title, t.status, t.priority, COALESCE(t.due, ''),
+	COALESCE((SELECT name FROM projects WHERE id = t.project_id), ''),
+	COALESCE((SELECT group_concat(tag, ',') FROM task_tags WHERE task_id = t.id), ''),
+	COALESCE(t.recur, ''), COALESCE(t.parent_id, 0),
+	(SELECT COUNT(*) FROM task_deps d JOIN tasks b ON b.id = d.blocked_by WHERE d.task_id = t.id AND b.status != 'done'),
+	t.created_at, t.updated_at, COALESCE(t.completed_at, '')`
+
+func scan(rows *sql.Rows) ([]Task, error) {
+	defer rows.Close()
+	var result []Task
+	for rows.Next() {
+		var t Task
+		var tags string
+		err := rows.Scan(&t.ID, &t.UID, &t.Title, &t.Status, &t.Priority, &t.Due, &t.Project, &tags,
+			&t.Recur, &t.ParentID, &t.Waiting, &t.CreatedAt, &t.UpdatedAt, &t.CompletedAt)
+		if err != nil {
+			return nil, err
+		}
+		if tags != "" {
+			t.Tags = strings.Split(tags, ",")
+			sort.Strings(t.Tags)
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+// order lists open work first: doing, todo, blocked, then done; within a
+// status, earliest due (undated last), then highest priority.
+const order = ` ORDER BY CASE t.status WHEN 'doing' THEN 0 WHEN 'todo' THEN 1 WHEN 'blocked' THEN 2 ELSE 3 END,
+	t.due IS NULL, t.due, t.priority DESC, t.id`
+
+// Filter narrows List. Empty fields match everything.
+type Filter struct {
+	Statuses  []string // any of these; none means every status but done
+	AllStatus bool     // include done tasks when Statuses is empty
+	Project   string
+	Tags      []string  // all must be present
+	DueBy     time.Time // only tasks due by this time (zero: no limit)
+}
+
+// List returns the tasks matching f.
+func List(q db.Querier, f Filter) ([]Task, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if len(f.Statuses) > 0 {
+		where = append(where, "t.status IN (?"+strings.Repeat(", ?", len(f.Statuses)-1)+")")
+		for _, s := range f.Statuses {
+			args = append(args, s)
+		}
+	} else if !f.AllStatus {
+		where = append(where, "t.status != 'done'")
+	}
+	if f.Project != "" {
+		where = append(where, "t.project_id = (SELECT id FROM projects WHERE name = ?)")
+		args = append(args, f.Project)
+	}
+	for _, tag := range f.Tags {
+		where = append(where, "EXISTS (SELECT 1 FROM task_tags WHERE task_id = t.id AND tag = ?)")
+		args = append(args, normalizeTag(tag))
+	}
+	if !f.DueBy.IsZero() {
+		where = append(where, "t.due IS NOT NULL")
+	}
+
+	rows, err := q.Query("SELECT "+columns+" FROM tasks t WHERE "+strings.Join(where, " AND ")+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scan(rows)
+	if err != nil || f.DueBy.IsZero() {
+		return tasks, err
+	}
+
+	// Date-only due values end at midnight local time, which SQL can't see.
+	var due []Task
+	for _, t := range tasks {
+		if at, ok := DueTime(t.Due, f.DueBy.Location()); ok && !at.After(endOfMinute(f.DueBy)) {
+			due = append(due, t)
+		}
+	}
+	return due, nil
+}
+
+// endOfMinute makes "due by 17:00" include a task due at 17:00.
+func endOfMinute(t time.Time) time.Time {
+	return t.Truncate(time.Minute).Add(time.Minute - time.Nanosecond)
+}
+
+// Get resolves ref as an exact ID, then an ID prefix, then a title (ignoring
+// case). When several tasks match but only one is open, that one is meant.
+func Get(q db.Querier, ref string) (*Task, error) {
+	type lookup struct {
+		where string
+		args  []interface{}
+	}
+	id := strings.ToLower(ref)
+	lookups := []lookup{{"t.uid = ?", []interface{}{id}}}
+	if len(ref) >= minPrefix {
+		lookups = append(lookups, lookup{"substr(t.uid, 1, ?) = ?", []interface{}{len(id), id}})
+	}
+	lookups = append(lookups, lookup{"t.title = ? COLLATE NOCASE", []interface{}{ref}})
+
+	for _, l := range lookups {
+		rows, err := q.Query("SELECT "+columns+" FROM tasks t WHERE "+l.where+" ORDER BY t.id", l.args...)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) > 1 {
+			// Done instances of a recurring task share its title.
+			var open []Task
+			for _, t := range matches {
+				if t.Status != Done {
+					open = append(open, t)
+				}
+			}
+			if len(open) == 1 {
+				matches = open
+			}
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return &matches[0], nil
+		default:
+			return nil, &AmbiguousError{Ref: ref, Matches: matches}
+		}
+	}
+	return nil, errors.Wrapf(ErrNotFound, "'%s'", ref)
+}
+
+// GetByID loads a task by its row ID.
+func GetByID(q db.Querier, id int64) (*Task, error) {
+	rows, err := q.Query("SELECT "+columns+" FROM tasks t WHERE t.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+	return &matches[0], nil
+}
+
+// Create inserts t with its project, tags and parent and returns the stored
+// task.
+func Create(q db.Querier, t Task) (*Task, error) {
+	if t.Status == "" {
+		t.Status = Todo
+	}
+	res, err := q.Exec(`INSERT INTO tasks (title, status, priority, due, recur, parent_id)
+		VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, 0))`,
+		t.Title, t.Status, t.Priority, t.Due, t.Recur, t.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := SetProject(q, id, t.Project); err != nil {
+		return nil, err
+	}
+	if err := AddTags(q, id, t.Tags...); err != nil {
+		return nil, err
+	}
+	return GetByID(q, id)
+}
+
+// Update saves the title, status, priority, due date, recurrence and project
+// of t. Tags are changed with AddTags and RemoveTags; use Complete to finish a
+// recurring task.
+func Update(q db.Querier, t *Task) error {
+	_, err := q.Exec("UPDATE tasks SET title = ?, status = ?, priority = ?, due = NULLIF(?, ''), recur = NULLIF(?, '') WHERE id = ?",
+		t.Title, t.Status, t.Priority, t.Due, t.Recur, t.ID)
+	if err != nil {
+		return err
+	}
+	return SetProject(q, t.ID, t.Project)
+}
+
+// Delete removes a task.
+func Delete(q db.Querier, id int64) error {
+	_, err := q.Exec("DELETE FROM tasks WHERE id = ?", id)
+	return err
+}
+
+// SetProject moves a task into the named project, creating it if needed. An
+// empty name takes the task out of any project.
+func SetProject(q db.Querier, taskID int64, project string) error {
+	project = strings.TrimSpace(project)
+	if project == "" {
+		_, err := q.Exec("UPDATE tasks SET project_id = NULL WHERE id = ? AND project_id IS NOT NULL", taskID)
+		return err
+	}
+	if _, err := q.Exec("INSERT OR IGNORE INTO projects (name) VALUES (?)", project); err != nil {
+		return err
+	}
+	_, err := q.Exec(`UPDATE tasks SET project_id = (SELECT id FROM projects WHERE name = ?)
+		WHERE id = ? AND project_id IS NOT (SELECT id FROM projects WHERE name = ?)`, project, taskID, project)
+	return err
+}
+
+// Project is a project with the number of open and done tasks in it and the
+// earliest due date among the open ones.
+type Project struct {
+	Name    string
+	Open    int
+	Done    int
+	NextDue string
+}
+
+// Projects lists all projects by name.
+func Projects(q db.Querier) ([]Project, error) {
+	rows, err := q.Query(`SELECT p.name,
+		COUNT(CASE WHEN t.status != 'done' THEN 1 END),
+		COUNT(CASE WHEN t.status = 'done' THEN 1 END),
+		COALESCE(MIN(CASE WHEN t.status != 'done' THEN t.due END), '')
+		FROM projects p LEFT JOIN tasks t ON t.project_id = p.id
+		GROUP BY p.id ORDER BY p.name COLLATE NOCASE`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []Project
+	for rows.Next() {
+		var p Project
+		if err := rows.Scan(&p.Name, &p.Open, &p.Done, &p.NextDue); err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// normalizeTag strips a leading '#' and surrounding space; tags match
+// case-insensitively.
+func normalizeTag(tag string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// AddTags tags a task.
+func AddTags(q db.Querier, taskID int64, tags ...string) error {
+	for _, tag := range tags {
+		if tag = normalizeTag(tag); tag == "" {
+			continue
+		}
+		if _, err := q.Exec("INSERT OR IGNORE INTO task_tags (task_id, tag) VALUES (?, ?)", taskID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveTags untags a task. Unknown tags are ignored.
+func RemoveTags(q db.Querier, taskID int64, tags ...string) error {
+	for _, tag := range tags {
+		if _, err := q.Exec("DELETE FROM task_tags WHERE task_id = ? AND tag = ?", taskID, normalizeTag(tag)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
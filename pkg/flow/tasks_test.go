@@ -0,0 +1,114 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestTasks(t *testing.T) {
+	q := dbtest.Open(t)
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+
+	invoice, err := Create(q, Task{Title: "Pay invoice", Priority: 3, Due: "2026-03-10", Project: "Admin", Tags: []string{"#money"}})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if invoice.UID == "" || invoice.Status != Todo || invoice.Project != "Admin" || len(invoice.Tags) != 1 || invoice.Tags[0] != "money" {
+		t.Fatalf("created task mismatch: %+v", invoice)
+	}
+	Create(q, Task{Title: "Write report", Due: "2026-03-10 12:00", Project: "admin"})
+	Create(q, Task{Title: "Plan sprint", Status: Doing})
+	Create(q, Task{Title: "Fix login", Due: "2026-03-12"})
+
+	list, _ := List(q, Filter{})
+	if len(list) != 4 || list[0].Title != "Plan sprint" || list[1].Title != "Pay invoice" {
+		t.Fatalf("List order: %+v", list)
+	}
+	if list, _ := List(q, Filter{Project: "ADMIN"}); len(list) != 2 {
+		t.Errorf("project filter matched %d tasks, want 2", len(list))
+	}
+	if list, _ := List(q, Filter{DueBy: now}); len(list) != 1 {
+		t.Errorf("due by now matched %d tasks, want 1", len(list))
+	}
+	endOfDay, _ := DueTime("2026-03-10", time.Local)
+	if list, _ := List(q, Filter{DueBy: endOfDay}); len(list) != 2 {
+		t.Errorf("due today matched %d tasks, want 2", len(list))
+	}
+	if !list[2].Overdue(now) || list[1].Overdue(now) {
+		t.Errorf("only the 12:00 task should be overdue at 15:00")
+	}
+
+	got, err := Get(q, invoice.UID[:4])
+	if err != nil || got.ID != invoice.ID {
+		t.Fatalf("Get by prefix = %+v, %v", got, err)
+	}
+	got.Status = Done
+	if err := Update(q, got); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = Get(q, "pay INVOICE")
+	if got.CompletedAt == "" {
+		t.Fatal("completed_at not set")
+	}
+	if list, _ := List(q, Filter{}); len(list) != 3 {
+		t.Errorf("done tasks should be hidden by default, got %d", len(list))
+	}
+	got.Status = Todo
+	Update(q, got)
+	if got, _ = GetByID(q, got.ID); got.CompletedAt != "" {
+		t.Errorf("completed_at kept after reopening: %q", got.CompletedAt)
+	}
+}
+
+func TestParseDue(t *testing.T) {
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+	for in, want := range map[string]string{
+		"today":            "2026-03-10",
+		"Tomorrow":         "2026-03-11",
+		"2026-04-01":       "2026-04-01",
+		"2026-04-01 09:30": "2026-04-01 09:30",
+	} {
+		if got, err := ParseDue(in, now); err != nil || got != want {
+			t.Errorf("ParseDue(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseDue("someday", now); err == nil {
+		t.Error("ParseDue accepted garbage")
+	}
+}
+
+func TestCompleteRecurring(t *testing.T) {
+	q := dbtest.Open(t)
+	now := time.Date(2026, 3, 10, 15, 0, 0, 0, time.Local)
+
+	// Due last Friday at 17:00 every Friday: the missed Friday is skipped.
+	weekly, _ := Create(q, Task{Title: "Timesheet", Due: "2026-03-06 17:00", Recur: "FREQ=WEEKLY;BYDAY=FR", Project: "Admin", Tags: []string{"hr"}})
+	next, err := Complete(q, weekly, now, false)
+	if err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+	if next == nil || next.Due != "2026-03-13 17:00" || next.Status != Todo || next.Project != "Admin" || len(next.Tags) != 1 {
+		t.Fatalf("next instance = %+v", next)
+	}
+
+	// COUNT runs down and stops.
+	twice, _ := Create(q, Task{Title: "Backup", Due: "2026-03-10", Recur: "FREQ=DAILY;COUNT=2"})
+	next, _ = Complete(q, twice, now, false)
+	if next == nil || next.Due != "2026-03-11" || next.Recur != "FREQ=DAILY;COUNT=1" {
+		t.Fatalf("next of COUNT=2 = %+v", next)
+	}
+	if last, _ := Complete(q, next, now, false); last != nil {
+		t.Errorf("COUNT=1 task recurred: %+v", last)
+	}
+
+	// Without a due date, the rule counts from today.
+	undated, _ := Create(q, Task{Title: "Water plants", Recur: "FREQ=DAILY;INTERVAL=3"})
+	if next, _ = Complete(q, undated, now, false); next == nil || next.Due != "2026-03-13" {
+		t.Errorf("undated next = %+v", next)
+	}
+	if got, err := Get(q, "water plants"); err != nil || got.ID != next.ID {
+		t.Errorf("Get by title = %+v, %v; want the open instance", got, err)
+	}
+}
@@ -0,0 +1,212 @@
+package flow
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/pkg/errors"
+)
+
+// ErrNoTimer is returned when stopping while no timer runs.
+var ErrNoTimer = errors.New("no timer is running")
+
+// timeLayout is the UTC form time entries are stored in, the same as
+// CURRENT_TIMESTAMP.
+const timeLayout = "2006-01-02 15:04:05"
+
+// Entry is a span of time spent on a task. End is zero while it runs.
+type Entry struct {
+	ID      int64
+	TaskID  int64
+	TaskUID string
+	Title   string
+	Project string
+	Start   time.Time
+	End     time.Time
+}
+
+// Running reports whether the entry's timer is still going.
+func (e *Entry) Running() bool {
+	return e.End.IsZero()
+}
+
+// Duration is the time spent so far, counting a running timer up to now.
+func (e *Entry) Duration(now time.Time) time.Duration {
+	end := e.End
+	if e.Running() {
+		end = now
+	}
+	return end.Sub(e.Start)
+}
+
+// RunningError is returned when starting a timer while another runs.
+type RunningError struct {
+	Entry *Entry
+}
+
+func (e *RunningError) Error() string {
+	return fmt.Sprintf("a timer is already running for task %s (%s)", e.Entry.TaskUID, e.Entry.Title)
+}
+
+const entryColumns = `e.id, e.task_id, t.uid, t.title,
+	COALESCE((SELECT name FROM projects WHERE id = t.project_id), ''),
+	e.started_at, COALESCE(e.ended_at, '')`
+
+func scanEntries(rows *sql.Rows) ([]Entry, error) {
+	defer rows.Close()
+	var result []Entry
+	for rows.Next() {
+		var e Entry
+		var start, end string
+		if err := rows.Scan(&e.ID, &e.TaskID, &e.TaskUID, &e.Title, &e.Project, &start, &end); err != nil {
+			return nil, err
+		}
+		var err error
+		if e.Start, err = parseTime(start); err != nil {
+			return nil, err
+		}
+		if end != "" {
+			if e.End, err = parseTime(end); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+func parseTime(s string) (time.Time, error) {
+	t, err := time.ParseInLocation(timeLayout, s, time.UTC)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid time entry %q", s)
+	}
+	return t.Local(), nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeLayout)
+}
+
+// Running returns the running timer, or nil when none runs.
+func Running(q db.Querier) (*Entry, error) {
+	rows, err := q.Query("SELECT " + entryColumns + " FROM time_entries e JOIN tasks t ON t.id = e.task_id WHERE e.ended_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanEntries(rows)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// Start begins timing a task at now. It fails with a *RunningError if a timer
+// is already running.
+func Start(q db.Querier, taskID int64, now time.Time) (*Entry, error) {
+	running, err := Running(q)
+	if err != nil {
+		return nil, err
+	}
+	if running != nil {
+		return nil, &RunningError{Entry: running}
+	}
+	if _, err := q.Exec("INSERT INTO time_entries (task_id, started_at) VALUES (?, ?)", taskID, formatTime(now)); err != nil {
+		return nil, err
+	}
+	return Running(q)
+}
+
+// Stop ends the running timer at now and returns its entry.
+func Stop(q db.Querier, now time.Time) (*Entry, error) {
+	running, err := Running(q)
+	if err != nil {
+		return nil, err
+	}
+	if running == nil {
+		return nil, ErrNoTimer
+	}
+	// Entries are stored to the second; never end one before it started.
+	if now.Before(running.Start) {
+		now = running.Start
+	}
+	if _, err := q.Exec("UPDATE time_entries SET ended_at = ? WHERE id = ?", formatTime(now), running.ID); err != nil {
+		return nil, err
+	}
+	running.End = now.Truncate(time.Second)
+	return running, nil
+}
+
+// Session times work. start begins the timer (e.g. with Start) and Stop ends
+// it once work returns, each in a short transaction of its own: nothing is held
+// open while work runs, so other connections can write meanwhile and the start
+// survives a crash. It returns the stopped entry.
+func Session(database *sql.DB, start func(q db.Querier) error, work func(), now func() time.Time) (*Entry, error) {
+	if err := db.InTx(database, start); err != nil {
+		return nil, err
+	}
+	work()
+	var entry *Entry
+	err := db.InTx(database, func(q db.Querier) error {
+		var err error
+		entry, err = Stop(q, now())
+		return err
+	})
+	return entry, err
+}
+
+// Entries lists the entries started in [from, to), oldest first.
+func Entries(q db.Querier, from, to time.Time) ([]Entry, error) {
+	rows, err := q.Query(`SELECT `+entryColumns+` FROM time_entries e JOIN tasks t ON t.id = e.task_id
+		WHERE e.started_at >= ? AND e.started_at < ? ORDER BY e.started_at, e.id`, formatTime(from), formatTime(to))
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// Total is the time spent on one task or project.
+type Total struct {
+	Name     string
+	UID      string // the task ID; empty for project totals
+	Duration time.Duration
+}
+
+// Summarize adds up entries per task and per project, longest first. Tasks
+// outside any project are counted under project "".
+func Summarize(entries []Entry, now time.Time) (tasks, projects []Total) {
+	byTask := make(map[int64]*Total)
+	byProject := make(map[string]*Total)
+	for i := range entries {
+		e := &entries[i]
+		d := e.Duration(now)
+		if byTask[e.TaskID] == nil {
+			byTask[e.TaskID] = &Total{Name: e.Title, UID: e.TaskUID}
+		}
+		byTask[e.TaskID].Duration += d
+		if byProject[e.Project] == nil {
+			byProject[e.Project] = &Total{Name: e.Project}
+		}
+		byProject[e.Project].Duration += d
+	}
+	for _, t := range byTask {
+		tasks = append(tasks, *t)
+	}
+	for _, t := range byProject {
+		projects = append(projects, *t)
+	}
+	sortTotals(tasks)
+	sortTotals(projects)
+	return tasks, projects
+}
+
+func sortTotals(totals []Total) {
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Duration != totals[j].Duration {
+			return totals[i].Duration > totals[j].Duration
+		}
+		return totals[i].Name < totals[j].Name
+	})
+}
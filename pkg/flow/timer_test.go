@@ -0,0 +1,88 @@
+package flow
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestTimer(t *testing.T) {
+	q := dbtest.Open(t)
+	day := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+
+	report, _ := Create(q, Task{Title: "Write report", Project: "Admin"})
+	mail, _ := Create(q, Task{Title: "Answer mail"})
+
+	if _, err := Start(q, report.ID, at(9, 0)); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if _, err := Start(q, mail.ID, at(9, 30)); err == nil {
+		t.Fatal("started a second timer")
+	} else if e, ok := err.(*RunningError); !ok || e.Entry.TaskID != report.ID {
+		t.Fatalf("Start error = %v", err)
+	}
+	if _, err := q.Exec("INSERT INTO time_entries (task_id, started_at) VALUES (?, '2026-03-10 10:00:00')", mail.ID); err == nil {
+		t.Fatal("schema allowed two running timers")
+	}
+	entry, err := Stop(q, at(10, 30))
+	if err != nil || entry.Duration(entry.End) != 90*time.Minute {
+		t.Fatalf("Stop = %+v, %v", entry, err)
+	}
+	if _, err := Stop(q, at(10, 31)); err != ErrNoTimer {
+		t.Errorf("Stop without a timer = %v", err)
+	}
+
+	Start(q, mail.ID, at(11, 0))
+	Stop(q, at(11, 15))
+	Start(q, report.ID, at(13, 0))
+
+	entries, err := Entries(q, day, day.AddDate(0, 0, 1))
+	if err != nil || len(entries) != 3 || !entries[2].Running() {
+		t.Fatalf("Entries = %+v, %v", entries, err)
+	}
+	if before, _ := Entries(q, day.AddDate(0, 0, -1), day); len(before) != 0 {
+		t.Errorf("entries from the day before: %+v", before)
+	}
+
+	tasks, projects := Summarize(entries, at(13, 30))
+	if len(tasks) != 2 || tasks[0].UID != report.UID || tasks[0].Duration != 2*time.Hour || tasks[1].Duration != 15*time.Minute {
+		t.Errorf("task totals = %+v", tasks)
+	}
+	if len(projects) != 2 || projects[0].Name != "Admin" || projects[1].Name != "" {
+		t.Errorf("project totals = %+v", projects)
+	}
+}
+
+func TestSession(t *testing.T) {
+	database := dbtest.Open(t)
+	day := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+	task, _ := Create(database, Task{Title: "Write report"})
+
+	start := func(q db.Querier) error {
+		_, err := Start(q, task.ID, day)
+		return err
+	}
+	entry, err := Session(database, start, func() {
+		// The pool hands these statements to a second connection if the
+		// session still holds the first one in a transaction.
+		if running, err := Running(database); err != nil || running == nil || running.TaskID != task.ID {
+			t.Errorf("running timer during the session = %+v, %v", running, err)
+		}
+		if _, err := Create(database, Task{Title: "Answer mail"}); err != nil {
+			t.Errorf("database not writable during the session: %v", err)
+		}
+	}, func() time.Time { return day.Add(25 * time.Minute) })
+	if err != nil || entry.Duration(entry.End) != 25*time.Minute {
+		t.Fatalf("Session = %+v, %v", entry, err)
+	}
+
+	// A failed start leaves no timer to stop and skips the work.
+	Start(database, task.ID, day.Add(time.Hour))
+	worked := false
+	if _, err := Session(database, start, func() { worked = true }, time.Now); err == nil || worked {
+		t.Errorf("Session with a running timer = %v, worked %v", err, worked)
+	}
+}
@@ -0,0 +1,1104 @@
+// Package flowsync synchronises Flow tasks and calendar events with the Kylrix
+// Flow backend.
+//
+// Records travel as flat maps of field values with the time each field last
+// changed. Database triggers queue every local change to a synced record in
+// flow_pending, field by field, so edits made offline are replayed on the
+// next sync. A sync pulls the change feed since the stored cursor, then pushes
+// deletions (tombstones), new records and the queued fields.
+//
+// When a field changed on both sides since the last sync the later change
+// wins (last-writer-wins, per field) and the losing value is logged in
+// flow_conflicts. A deletion competes with edits the same way.
+//
+// No transaction is open while a request is out. New records are created with
+// an Idempotency-Key stored beforehand, so a create whose reply never arrives
+// is retried on the next sync instead of repeated.
+package flowsync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/flow"
+	"github.com/pkg/errors"
+)
+
+// cursorKey is the sync_state key of the Flow change-feed cursor.
+const cursorKey = "flow.cursor"
+
+// Record kinds.
+const (
+	Task  = "task"
+	Event = "event"
+)
+
+// Fields lists the synced fields of each kind. Task priority is a number,
+// tags and blocked_by are comma-separated, and parent and blocked_by hold
+// remote IDs. Event start and end are wall times in tz, as stored locally;
+// the three always change together.
+var Fields = map[string][]string{
+	Task:  {"title", "status", "priority", "due", "recur", "project", "tags", "parent", "blocked_by"},
+	Event: {"title", "description", "location", "start", "end", "tz", "recur"},
+}
+
+// stampLayout matches the change times the database triggers record.
+const stampLayout = "2006-01-02T15:04:05.000Z"
+
+// Record is a task or event as exchanged with the backend. Modified holds the
+// RFC 3339 time each field last changed.
+type Record struct {
+	Type      string            `json:"type"`
+	ID        string            `json:"id,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	Modified  map[string]string `json:"modified,omitempty"`
+	Deleted   bool              `json:"deleted,omitempty"`
+	DeletedAt string            `json:"deleted_at,omitempty"`
+}
+
+// changes is a page of the change feed.
+type changes struct {
+	Changes []Record `json:"changes"`
+	Cursor  string   `json:"cursor"`
+	HasMore bool     `json:"has_more"`
+}
+
+// Change is a change a sync made, or would make in a dry run.
+type Change struct {
+	Push   bool   // sent to the backend rather than applied locally
+	Action string // "create", "update" or "delete"
+	Kind   string
+	Title  string
+	Fields []string // the fields updated
+}
+
+// Conflict is a field changed on both sides since the last sync. Field is
+// "deleted" when a deletion competed with edits.
+type Conflict struct {
+	Kind   string
+	Title  string
+	Field  string
+	Local  string
+	Remote string
+	Winner string // "local" or "remote"
+}
+
+// Report summarises a sync.
+type Report struct {
+	Changes   []Change
+	Conflicts []Conflict
+	Warnings  []string // remote values that could not be applied
+}
+
+func (r *Report) add(c Change) {
+	r.Changes = append(r.Changes, c)
+}
+
+// Count returns the number of changes made in one direction.
+func (r *Report) Count(push bool) int {
+	n := 0
+	for _, c := range r.Changes {
+		if c.Push == push {
+			n++
+		}
+	}
+	return n
+}
+
+// Syncer syncs the tasks and events in DB through Client.
+type Syncer struct {
+	Client *api.Client
+	DB     *sql.DB
+	Now    func() time.Time
+}
+
+// New returns a Syncer using the current time to stamp new records.
+func New(client *api.Client, database *sql.DB) *Syncer {
+	return &Syncer{Client: client, DB: database, Now: time.Now}
+}
+
+func table(kind string) string {
+	return kind + "s"
+}
+
+func recordPath(kind, id string) string {
+	return "/v1/flow/" + table(kind) + "/" + url.PathEscape(id)
+}
+
+// later reports whether RFC 3339 time a is after b. Unreadable or missing
+// times count as the zero time.
+func later(a, b string) bool {
+	ta, _ := time.Parse(time.RFC3339, a)
+	tb, _ := time.Parse(time.RFC3339, b)
+	return ta.After(tb)
+}
+
+// latest returns the most recent of the modification times.
+func latest(modified map[string]string) string {
+	var last string
+	for _, m := range modified {
+		if last == "" || later(m, last) {
+			last = m
+		}
+	}
+	return last
+}
+
+// sortedList normalises a comma-separated list.
+func sortedList(s string) string {
+	if s == "" {
+		return ""
+	}
+	items := strings.Split(s, ",")
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// readFields returns the synced field values of a row, or nil if it is gone.
+func readFields(q db.Querier, kind string, id int64) (map[string]string, error) {
+	if kind == Event {
+		var title, description, location, start, end, tz, recur string
+		err := q.QueryRow(`SELECT title, description, location, starts_at, ends_at, tz, COALESCE(recur, '')
+			FROM events WHERE id = ?`, id).Scan(&title, &description, &location, &start, &end, &tz, &recur)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return map[string]string{"title": title, "description": description, "location": location,
+			"start": start, "end": end, "tz": tz, "recur": recur}, nil
+	}
+
+	var title, status, due, recur, project, tags, parent, blockedBy string
+	var priority int
+	err := q.QueryRow(`SELECT t.title, t.status, t.priority, COALESCE(t.due, ''), COALESCE(t.recur, ''),
+		COALESCE((SELECT name FROM projects WHERE id = t.project_id), ''),
+		COALESCE((SELECT group_concat(tag, ',') FROM task_tags WHERE task_id = t.id), ''),
+		COALESCE((SELECT remote_id FROM tasks WHERE id = t.parent_id), ''),
+		COALESCE((SELECT group_concat(b.remote_id, ',') FROM task_deps d JOIN tasks b ON b.id = d.blocked_by
+			WHERE d.task_id = t.id AND b.remote_id IS NOT NULL), '')
+		FROM tasks t WHERE t.id = ?`, id).Scan(&title, &status, &priority, &due, &recur, &project, &tags, &parent, &blockedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{"title": title, "status": status, "priority": strconv.Itoa(priority),
+		"due": due, "recur": recur, "project": project, "tags": sortedList(tags),
+		"parent": parent, "blocked_by": sortedList(blockedBy)}, nil
+}
+
+// invalidValue is a remote value that cannot be stored. It is reported as a
+// warning and the local value is kept.
+type invalidValue string
+
+func (e invalidValue) Error() string {
+	return string(e)
+}
+
+func invalid(format string, args ...interface{}) error {
+	return invalidValue(fmt.Sprintf(format, args...))
+}
+
+func isInvalid(err error) bool {
+	var v invalidValue
+	return errors.As(err, &v)
+}
+
+// localID finds the row synced with a remote ID, or 0.
+func localID(q db.Querier, kind, remoteID string) (int64, error) {
+	var id int64
+	err := q.QueryRow("SELECT COALESCE((SELECT id FROM "+table(kind)+" WHERE remote_id = ?), 0)", remoteID).Scan(&id)
+	return id, err
+}
+
+// writeField stores one remote field value in a row.
+func writeField(q db.Querier, kind string, id int64, field, value string) error {
+	var err error
+	if kind == Event {
+		switch field {
+		case "title", "description", "location", "tz":
+			if field == "tz" && value != "" {
+				if _, err := time.LoadLocation(value); err != nil {
+					return invalid("unknown time zone %q", value)
+				}
+			}
+			_, err = q.Exec("UPDATE events SET "+field+" = ? WHERE id = ?", value, id)
+		case "start", "end":
+			if !validWall(value) {
+				return invalid("invalid %s %q", field, value)
+			}
+			_, err = q.Exec("UPDATE events SET "+field+"s_at = ? WHERE id = ?", value, id)
+		case "recur":
+			_, err = q.Exec("UPDATE events SET recur = NULLIF(?, '') WHERE id = ?", value, id)
+		}
+		return err
+	}
+
+	switch field {
+	case "title":
+		_, err = q.Exec("UPDATE tasks SET title = ? WHERE id = ?", value, id)
+	case "status":
+		status, perr := flow.ParseStatus(value)
+		if perr != nil {
+			return invalid("%v", perr)
+		}
+		_, err = q.Exec("UPDATE tasks SET status = ? WHERE id = ?", status, id)
+	case "priority":
+		p, perr := strconv.Atoi(value)
+		if perr != nil || p < 0 || p >= len(flow.Priorities) {
+			return invalid("invalid priority %q", value)
+		}
+		_, err = q.Exec("UPDATE tasks SET priority = ? WHERE id = ?", p, id)
+	case "due", "recur":
+		_, err = q.Exec("UPDATE tasks SET "+field+" = NULLIF(?, '') WHERE id = ?", value, id)
+	case "project":
+		err = flow.SetProject(q, id, value)
+	case "tags":
+		current, rerr := readFields(q, Task, id)
+		if rerr != nil {
+			return rerr
+		}
+		if err = flow.RemoveTags(q, id, splitList(current["tags"])...); err == nil {
+			err = flow.AddTags(q, id, splitList(value)...)
+		}
+	case "parent":
+		var parentID int64
+		if value != "" {
+			if parentID, err = localID(q, Task, value); err != nil {
+				return err
+			}
+			if parentID == 0 {
+				return invalid("unknown parent %s", value)
+			}
+		}
+		if err = flow.SetParent(q, id, parentID); err != nil {
+			return invalid("%v", err)
+		}
+	case "blocked_by":
+		err = writeBlockers(q, id, splitList(value))
+	}
+	return err
+}
+
+// validWall checks an event time as stored: a date or a date and time.
+func validWall(s string) bool {
+	_, dateErr := time.Parse(flow.DateLayout, s)
+	_, timeErr := time.Parse(flow.DateTimeLayout, s)
+	return dateErr == nil || timeErr == nil
+}
+
+// writeBlockers makes a task wait on exactly the tasks with the given remote
+// IDs. Blockers that are not synced stay.
+func writeBlockers(q db.Querier, id int64, remoteIDs []string) error {
+	want := make(map[int64]bool)
+	for _, rid := range remoteIDs {
+		blocker, err := localID(q, Task, rid)
+		if err != nil {
+			return err
+		}
+		if blocker == 0 {
+			return invalid("unknown blocker %s", rid)
+		}
+		want[blocker] = true
+	}
+	blockers, err := flow.Blockers(q, id)
+	if err != nil {
+		return err
+	}
+	for _, b := range blockers {
+		if want[b.ID] {
+			delete(want, b.ID)
+			continue
+		}
+		var synced bool
+		if err := q.QueryRow("SELECT remote_id IS NOT NULL FROM tasks WHERE id = ?", b.ID).Scan(&synced); err != nil {
+			return err
+		}
+		if synced {
+			if err := flow.RemoveBlocker(q, id, b.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for blocker := range want {
+		if err := flow.AddBlocker(q, id, blocker); err != nil {
+			return invalid("%v", err)
+		}
+	}
+	return nil
+}
+
+// pendingFields returns the queued fields of a row and when they changed.
+func pendingFields(q db.Querier, kind string, id int64) (map[string]string, error) {
+	rows, err := q.Query("SELECT field, changed_at FROM flow_pending WHERE kind = ? AND row_id = ?", kind, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pending := make(map[string]string)
+	for rows.Next() {
+		var field, at string
+		if err := rows.Scan(&field, &at); err != nil {
+			return nil, err
+		}
+		pending[field] = at
+	}
+	return pending, rows.Err()
+}
+
+func dropPending(q db.Querier, kind string, id int64, fields ...string) error {
+	for _, f := range fields {
+		if _, err := q.Exec("DELETE FROM flow_pending WHERE kind = ? AND row_id = ? AND field = ?", kind, id, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// detach forgets the remote copy of a row without leaving a tombstone, so it
+// is pushed as a new record or deleted quietly.
+func detach(q db.Querier, kind string, id int64) error {
+	if _, err := q.Exec("UPDATE "+table(kind)+" SET remote_id = NULL WHERE id = ?", id); err != nil {
+		return err
+	}
+	_, err := q.Exec("DELETE FROM flow_pending WHERE kind = ? AND row_id = ?", kind, id)
+	return err
+}
+
+func logConflict(q db.Querier, report *Report, c Conflict) error {
+	report.Conflicts = append(report.Conflicts, c)
+	_, err := q.Exec(`INSERT INTO flow_conflicts (kind, title, field, local_value, remote_value, winner)
+		VALUES (?, ?, ?, ?, ?, ?)`, c.Kind, c.Title, c.Field, c.Local, c.Remote, c.Winner)
+	return err
+}
+
+// withTx runs fn in a transaction.
+func (s *Syncer) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Sync pulls remote changes and pushes local ones. With dryRun nothing is
+// sent or stored; the report lists what a sync would do.
+func (s *Syncer) Sync(dryRun bool) (*Report, error) {
+	report := &Report{}
+	if !dryRun {
+		// Finish creates whose reply was lost first, so the change feed
+		// echoing them is recognised instead of pulled as more records.
+		if err := s.pushNew(report, true); err != nil {
+			return report, errors.Wrap(err, "push")
+		}
+	}
+	records, cursor, err := s.fetchChanges()
+	if err != nil {
+		return report, errors.Wrap(err, "pull")
+	}
+
+	if dryRun {
+		tx, err := s.DB.Begin()
+		if err != nil {
+			return report, err
+		}
+		defer tx.Rollback()
+		if err := apply(tx, records, report); err != nil {
+			return report, errors.Wrap(err, "pull")
+		}
+		return report, plan(tx, report)
+	}
+
+	err = s.withTx(func(tx *sql.Tx) error {
+		if err := apply(tx, records, report); err != nil {
+			return err
+		}
+		_, err := tx.Exec("INSERT OR REPLACE INTO sync_state (key, value) VALUES (?, ?)", cursorKey, cursor)
+		return err
+	})
+	if err != nil {
+		return report, errors.Wrap(err, "pull")
+	}
+	if err := s.pushDeletes(report); err != nil {
+		return report, errors.Wrap(err, "push deletions")
+	}
+	if err := s.pushNew(report, false); err != nil {
+		return report, errors.Wrap(err, "push")
+	}
+	if err := s.pushUpdates(report); err != nil {
+		return report, errors.Wrap(err, "push")
+	}
+	// Records deleted remotely while we were pushing edits go up again.
+	if err := s.pushNew(report, false); err != nil {
+		return report, errors.Wrap(err, "push")
+	}
+	return report, nil
+}
+
+// fetchChanges reads the whole change feed since the stored cursor. It is
+// applied at once because tasks can arrive before the parents and blockers
+// they refer to.
+func (s *Syncer) fetchChanges() ([]Record, string, error) {
+	var cursor string
+	err := s.DB.QueryRow("SELECT value FROM sync_state WHERE key = ?", cursorKey).Scan(&cursor)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, "", err
+	}
+	var records []Record
+	for {
+		var page changes
+		if err := s.Client.Execute("GET", "/v1/flow/changes?since="+url.QueryEscape(cursor), nil, &page); err != nil {
+			return nil, "", err
+		}
+		records = append(records, page.Changes...)
+		cursor = page.Cursor
+		if !page.HasMore {
+			return records, cursor, nil
+		}
+	}
+}
+
+// reference is a parent or blocked_by value written once every record of a
+// batch exists.
+type reference struct {
+	kind  string
+	id    int64
+	field string
+	value string
+	title string
+}
+
+// apply stores remote records.
+func apply(q db.Querier, records []Record, report *Report) error {
+	var refs []reference
+	for _, r := range records {
+		if _, ok := Fields[r.Type]; !ok {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("skipped %s %s of unknown type", r.Type, r.ID))
+			continue
+		}
+		if err := applyOne(q, r, report, &refs); err != nil {
+			return errors.Wrapf(err, "%s %s", r.Type, r.ID)
+		}
+	}
+	for _, ref := range refs {
+		if err := writeField(q, ref.kind, ref.id, ref.field, ref.value); err != nil {
+			if !isInvalid(err) {
+				return err
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %q: %v", ref.kind, ref.title, err))
+		}
+		if err := dropPending(q, ref.kind, ref.id, ref.field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyOne(q db.Querier, r Record, report *Report, refs *[]reference) error {
+	title := r.Fields["title"]
+	var deletedAt string
+	err := q.QueryRow("SELECT deleted_at FROM flow_tombstones WHERE kind = ? AND remote_id = ?", r.Type, r.ID).Scan(&deletedAt)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case !r.Deleted && !later(latest(r.Modified), deletedAt):
+		return nil // the local delete is pushed later
+	default:
+		// Deleted on both sides, or edited remotely after the local delete:
+		// then the edit wins and the record comes back.
+		if _, err := q.Exec("DELETE FROM flow_tombstones WHERE kind = ? AND remote_id = ?", r.Type, r.ID); err != nil {
+			return err
+		}
+		if !r.Deleted {
+			err := logConflict(q, report, Conflict{Kind: r.Type, Title: title, Field: "deleted",
+				Local: "deleted", Remote: "edited", Winner: "remote"})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	id, err := localID(q, r.Type, r.ID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case r.Deleted:
+		return applyDelete(q, r, id, report)
+	case id == 0:
+		return create(q, r, report, refs)
+	}
+
+	current, err := readFields(q, r.Type, id)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingFields(q, r.Type, id)
+	if err != nil {
+		return err
+	}
+	var changed, settled []string
+	for _, field := range Fields[r.Type] {
+		value, ok := r.Fields[field]
+		if !ok {
+			continue
+		}
+		if value == current[field] {
+			settled = append(settled, field)
+			continue
+		}
+		if at, ok := pending[field]; ok {
+			winner := "remote"
+			if later(at, r.Modified[field]) {
+				winner = "local"
+			}
+			err := logConflict(q, report, Conflict{Kind: r.Type, Title: current["title"], Field: field,
+				Local: current[field], Remote: value, Winner: winner})
+			if err != nil {
+				return err
+			}
+			if winner == "local" {
+				continue // pushed later
+			}
+		}
+		changed = append(changed, field)
+		if field == "parent" || field == "blocked_by" {
+			*refs = append(*refs, reference{r.Type, id, field, value, current["title"]})
+			continue
+		}
+		if err := writeField(q, r.Type, id, field, value); err != nil {
+			if !isInvalid(err) {
+				return err
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s %q: %v", r.Type, current["title"], err))
+		}
+		settled = append(settled, field)
+	}
+	if len(changed) > 0 {
+		report.add(Change{Action: "update", Kind: r.Type, Title: current["title"], Fields: changed})
+	}
+	// Applying remote values queued them as local changes; they are not.
+	return dropPending(q, r.Type, id, settled...)
+}
+
+func applyDelete(q db.Querier, r Record, id int64, report *Report) error {
+	if id == 0 {
+		return nil
+	}
+	current, err := readFields(q, r.Type, id)
+	if err != nil {
+		return err
+	}
+	pending, err := pendingFields(q, r.Type, id)
+	if err != nil {
+		return err
+	}
+	if at := latest(pending); at != "" && later(at, r.DeletedAt) {
+		// Edited here after the remote delete: keep it as a new record.
+		err := logConflict(q, report, Conflict{Kind: r.Type, Title: current["title"], Field: "deleted",
+			Local: "edited", Remote: "deleted", Winner: "local"})
+		if err != nil {
+			return err
+		}
+		return detach(q, r.Type, id)
+	}
+	if err := detach(q, r.Type, id); err != nil {
+		return err
+	}
+	report.add(Change{Action: "delete", Kind: r.Type, Title: current["title"]})
+	if r.Type == Event {
+		return flow.DeleteEvent(q, id)
+	}
+	return flow.Delete(q, id)
+}
+
+// create adds a row for a remote record.
+func create(q db.Querier, r Record, report *Report, refs *[]reference) error {
+	f := r.Fields
+	var id int64
+	if r.Type == Event {
+		if !validWall(f["start"]) || !validWall(f["end"]) {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("event %q skipped: invalid start or end", f["title"]))
+			return nil
+		}
+		res, err := q.Exec(`INSERT INTO events (title, description, location, starts_at, ends_at, tz, recur)
+			VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))`,
+			f["title"], f["description"], f["location"], f["start"], f["end"], "", f["recur"])
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		if err := writeField(q, Event, id, "tz", f["tz"]); err != nil {
+			if !isInvalid(err) {
+				return err
+			}
+			report.Warnings = append(report.Warnings, fmt.Sprintf("event %q: %v", f["title"], err))
+		}
+	} else {
+		t, err := flow.Create(q, flow.Task{Title: f["title"]})
+		if err != nil {
+			return err
+		}
+		id = t.ID
+		for _, field := range Fields[Task] {
+			value, ok := f[field]
+			switch {
+			case !ok || field == "title":
+			case field == "parent" || field == "blocked_by":
+				*refs = append(*refs, reference{Task, id, field, value, f["title"]})
+			default:
+				if err := writeField(q, Task, id, field, value); err != nil {
+					if !isInvalid(err) {
+						return err
+					}
+					report.Warnings = append(report.Warnings, fmt.Sprintf("task %q: %v", f["title"], err))
+				}
+			}
+		}
+	}
+	if _, err := q.Exec("UPDATE "+table(r.Type)+" SET remote_id = ? WHERE id = ?", r.ID, id); err != nil {
+		return err
+	}
+	report.add(Change{Action: "create", Kind: r.Type, Title: f["title"]})
+	return nil
+}
+
+// plan lists what a push would send.
+func plan(q db.Querier, report *Report) error {
+	rows, err := q.Query("SELECT kind, title FROM flow_tombstones ORDER BY deleted_at")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		c := Change{Push: true, Action: "delete"}
+		if err := rows.Scan(&c.Kind, &c.Title); err != nil {
+			rows.Close()
+			return err
+		}
+		report.add(c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, kind := range []string{Task, Event} {
+		ids, err := unsynced(q, kind, false)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			fields, err := readFields(q, kind, id)
+			if err != nil {
+				return err
+			}
+			report.add(Change{Push: true, Action: "create", Kind: kind, Title: fields["title"]})
+		}
+	}
+
+	queued, err := queuedRows(q)
+	if err != nil {
+		return err
+	}
+	for _, row := range queued {
+		fields, err := readFields(q, row.kind, row.id)
+		if err != nil || fields == nil {
+			return err
+		}
+		pending, err := pendingFields(q, row.kind, row.id)
+		if err != nil {
+			return err
+		}
+		report.add(Change{Push: true, Action: "update", Kind: row.kind, Title: fields["title"], Fields: ordered(row.kind, pending)})
+	}
+	return nil
+}
+
+// ordered lists the fields in a set in their usual order.
+func ordered(kind string, set map[string]string) []string {
+	var fields []string
+	for _, f := range Fields[kind] {
+		if _, ok := set[f]; ok {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// unsynced lists the rows never pushed, oldest first. With retries set it
+// only lists those already sent once.
+func unsynced(q db.Querier, kind string, retries bool) ([]int64, error) {
+	cond := "remote_id IS NULL"
+	if retries {
+		cond += " AND push_key IS NOT NULL"
+	}
+	rows, err := q.Query("SELECT id FROM " + table(kind) + " WHERE " + cond + " ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+type row struct {
+	kind string
+	id   int64
+}
+
+// queuedRows lists the rows with queued field changes.
+func queuedRows(q db.Querier) ([]row, error) {
+	rows, err := q.Query("SELECT DISTINCT kind, row_id FROM flow_pending ORDER BY kind DESC, row_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.kind, &r.id); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// Pending counts the local changes waiting to be pushed: deletions, records
+// never synced and records with queued field changes.
+func Pending(q db.Querier) (int, error) {
+	var n int
+	err := q.QueryRow(`SELECT (SELECT COUNT(*) FROM flow_tombstones)
+		+ (SELECT COUNT(*) FROM tasks WHERE remote_id IS NULL)
+		+ (SELECT COUNT(*) FROM events WHERE remote_id IS NULL)
+		+ (SELECT COUNT(*) FROM (SELECT DISTINCT kind, row_id FROM flow_pending))`).Scan(&n)
+	return n, err
+}
+
+func decode(resp *api.Response) (Record, error) {
+	var r Record
+	if err := json.Unmarshal(resp.Body, &r); err != nil {
+		return Record{}, errors.Wrap(err, "failed to unmarshal response")
+	}
+	return r, nil
+}
+
+func (s *Syncer) pushDeletes(report *Report) error {
+	rows, err := s.DB.Query("SELECT kind, remote_id, title, deleted_at FROM flow_tombstones ORDER BY deleted_at")
+	if err != nil {
+		return err
+	}
+	type tombstone struct{ kind, remoteID, title, deletedAt string }
+	var tombstones []tombstone
+	for rows.Next() {
+		var t tombstone
+		if err := rows.Scan(&t.kind, &t.remoteID, &t.title, &t.deletedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		tombstones = append(tombstones, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tombstones {
+		_, err := s.Client.Do("DELETE", recordPath(t.kind, t.remoteID)+"?deleted_at="+url.QueryEscape(t.deletedAt), nil, nil)
+		var restore *Record
+		switch {
+		case err == nil || api.IsStatus(err, http.StatusNotFound):
+			report.add(Change{Push: true, Action: "delete", Kind: t.kind, Title: t.title})
+		case api.IsStatus(err, http.StatusConflict):
+			// Edited remotely after the local delete: the edit wins.
+			var r Record
+			if err := s.Client.Execute("GET", recordPath(t.kind, t.remoteID), nil, &r); err != nil {
+				return errors.Wrapf(err, "%s %q", t.kind, t.title)
+			}
+			r.Type, r.ID = t.kind, t.remoteID
+			restore = &r
+		default:
+			return errors.Wrapf(err, "%s %q", t.kind, t.title)
+		}
+		err = s.withTx(func(tx *sql.Tx) error {
+			if _, err := tx.Exec("DELETE FROM flow_tombstones WHERE kind = ? AND remote_id = ?", t.kind, t.remoteID); err != nil {
+				return err
+			}
+			if restore == nil {
+				return nil
+			}
+			err := logConflict(tx, report, Conflict{Kind: t.kind, Title: t.title, Field: "deleted",
+				Local: "deleted", Remote: "edited", Winner: "remote"})
+			if err != nil {
+				return err
+			}
+			return apply(tx, []Record{*restore}, report)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "%s %q", t.kind, t.title)
+		}
+	}
+	return nil
+}
+
+// pushNew creates the records never synced; with retries set, only those
+// already sent once. Parents and blockers not synced yet when a task is sent
+// are queued and follow with the updates.
+func (s *Syncer) pushNew(report *Report, retries bool) error {
+	for _, kind := range []string{Task, Event} {
+		ids, err := unsynced(s.DB, kind, retries)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := s.pushCreate(kind, id, report); err != nil {
+				return errors.Wrapf(err, "%s %d", kind, id)
+			}
+		}
+	}
+	return nil
+}
+
+// pushKey returns the idempotency key for creating a row remotely, storing a
+// new one first if needed. It is committed before the POST goes out, so a
+// retry after a lost reply reuses it.
+func pushKey(q db.Querier, kind string, id int64) (string, error) {
+	_, err := q.Exec("UPDATE "+table(kind)+" SET push_key = COALESCE(push_key, lower(hex(randomblob(16)))) WHERE id = ?", id)
+	if err != nil {
+		return "", err
+	}
+	var key string
+	err = q.QueryRow("SELECT push_key FROM "+table(kind)+" WHERE id = ?", id).Scan(&key)
+	return key, err
+}
+
+// pushCreate sends a new record and records its remote ID once the reply is
+// back.
+func (s *Syncer) pushCreate(kind string, id int64, report *Report) error {
+	fields, err := readFields(s.DB, kind, id)
+	if err != nil || fields == nil {
+		return err
+	}
+	key, err := pushKey(s.DB, kind, id)
+	if err != nil {
+		return err
+	}
+	stamp := s.Now().UTC().Format(stampLayout)
+	modified := make(map[string]string)
+	for f := range fields {
+		modified[f] = stamp
+	}
+	resp, err := s.Client.Do("POST", "/v1/flow/"+table(kind), Record{Type: kind, Fields: fields, Modified: modified},
+		http.Header{"Idempotency-Key": {key}})
+	if err != nil {
+		return err
+	}
+	stored, err := decode(resp)
+	if err != nil {
+		return err
+	}
+	if stored.ID == "" {
+		return errors.New("the backend returned no ID")
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		report.add(Change{Push: true, Action: "create", Kind: kind, Title: fields["title"]})
+		current, err := readFields(tx, kind, id)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			// Deleted while the request was out.
+			_, err := tx.Exec("INSERT OR REPLACE INTO flow_tombstones (kind, remote_id, title, deleted_at) VALUES (?, ?, ?, ?)",
+				kind, stored.ID, fields["title"], s.Now().UTC().Format(stampLayout))
+			return err
+		}
+		if _, err := tx.Exec("UPDATE "+table(kind)+" SET remote_id = ?, push_key = NULL WHERE id = ?", stored.ID, id); err != nil {
+			return err
+		}
+		// Edits made meanwhile were not queued, as the row had no remote
+		// ID yet.
+		for _, f := range Fields[kind] {
+			if current[f] == fields[f] {
+				continue
+			}
+			_, err := tx.Exec("INSERT OR REPLACE INTO flow_pending (kind, row_id, field, changed_at) VALUES (?, ?, ?, ?)",
+				kind, id, f, s.Now().UTC().Format(stampLayout))
+			if err != nil {
+				return err
+			}
+		}
+		if kind == Task {
+			return queueUnresolved(tx, id, stamp)
+		}
+		return nil
+	})
+}
+
+// queueUnresolved queues the parent and blockers of a task that were not
+// synced when it was created remotely.
+func queueUnresolved(q db.Querier, id int64, stamp string) error {
+	_, err := q.Exec(`INSERT OR REPLACE INTO flow_pending (kind, row_id, field, changed_at)
+		SELECT 'task', t.id, 'parent', ? FROM tasks t JOIN tasks p ON p.id = t.parent_id
+		WHERE t.id = ? AND p.remote_id IS NULL`, stamp, id)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(`INSERT OR REPLACE INTO flow_pending (kind, row_id, field, changed_at)
+		SELECT 'task', ?, 'blocked_by', ? WHERE EXISTS (SELECT 1 FROM task_deps d JOIN tasks b ON b.id = d.blocked_by
+		WHERE d.task_id = ? AND b.remote_id IS NULL)`, id, stamp, id)
+	return err
+}
+
+// pushUpdates sends the queued fields of each record. The backend keeps the
+// later of its value and ours and returns the stored record; values it kept
+// over ours are applied here and logged as conflicts.
+func (s *Syncer) pushUpdates(report *Report) error {
+	queued, err := queuedRows(s.DB)
+	if err != nil {
+		return err
+	}
+	for _, r := range queued {
+		if err := s.pushUpdate(r, report); err != nil {
+			return errors.Wrapf(err, "%s %d", r.kind, r.id)
+		}
+	}
+	return nil
+}
+
+// pushUpdate sends the queued fields of one record. Fields changed again
+// while the request was out stay queued for the next sync.
+func (s *Syncer) pushUpdate(r row, report *Report) error {
+	fields, err := readFields(s.DB, r.kind, r.id)
+	if err != nil {
+		return err
+	}
+	var remoteID sql.NullString
+	if fields != nil {
+		if err := s.DB.QueryRow("SELECT remote_id FROM "+table(r.kind)+" WHERE id = ?", r.id).Scan(&remoteID); err != nil {
+			return err
+		}
+	}
+	pending, err := pendingFields(s.DB, r.kind, r.id)
+	if err != nil {
+		return err
+	}
+	if fields == nil || !remoteID.Valid {
+		return dropPending(s.DB, r.kind, r.id, ordered(r.kind, pending)...)
+	}
+
+	body := Record{Type: r.kind, ID: remoteID.String, Fields: map[string]string{}, Modified: pending}
+	sent := ordered(r.kind, pending)
+	for _, f := range sent {
+		body.Fields[f] = fields[f]
+	}
+	resp, err := s.Client.Do("PATCH", recordPath(r.kind, remoteID.String), body, nil)
+	if api.IsStatus(err, http.StatusNotFound) {
+		// Deleted remotely since the pull; our edits are newer, so the
+		// record is created again.
+		return detach(s.DB, r.kind, r.id)
+	}
+	if err != nil {
+		return err
+	}
+	stored, err := decode(resp)
+	if err != nil {
+		return err
+	}
+
+	return s.withTx(func(tx *sql.Tx) error {
+		report.add(Change{Push: true, Action: "update", Kind: r.kind, Title: fields["title"], Fields: sent})
+		before, err := pendingFields(tx, r.kind, r.id)
+		if err != nil {
+			return err
+		}
+		for _, f := range sent {
+			value, ok := stored.Fields[f]
+			if !ok || value == fields[f] || before[f] != pending[f] {
+				continue
+			}
+			err := logConflict(tx, report, Conflict{Kind: r.kind, Title: fields["title"], Field: f,
+				Local: fields[f], Remote: value, Winner: "remote"})
+			if err != nil {
+				return err
+			}
+			if err := writeField(tx, r.kind, r.id, f, value); err != nil {
+				if !isInvalid(err) {
+					return err
+				}
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s %q: %v", r.kind, fields["title"], err))
+			}
+		}
+		// Drop what was sent and what the writes above queued; keep fields
+		// edited since the request went out.
+		after, err := pendingFields(tx, r.kind, r.id)
+		if err != nil {
+			return err
+		}
+		var done []string
+		for f, at := range after {
+			if at == pending[f] || at != before[f] {
+				done = append(done, f)
+			}
+		}
+		return dropPending(tx, r.kind, r.id, done...)
+	})
+}
+
+// LoggedConflict is a conflict kept in the log.
+type LoggedConflict struct {
+	Conflict
+	ResolvedAt string
+}
+
+// Conflicts returns the most recently logged conflicts, newest first.
+func Conflicts(q db.Querier, limit int) ([]LoggedConflict, error) {
+	rows, err := q.Query(`SELECT kind, title, field, local_value, remote_value, winner, resolved_at
+		FROM flow_conflicts ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []LoggedConflict
+	for rows.Next() {
+		var c LoggedConflict
+		if err := rows.Scan(&c.Kind, &c.Title, &c.Field, &c.Local, &c.Remote, &c.Winner, &c.ResolvedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,347 @@
+package flowsync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api/apitest"
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+	"github.com/nathfavour/kylrix/cli/pkg/flow"
+)
+
+// fakeBackend is an in-memory Kylrix Flow backend resolving updates field by
+// field, the later change winning.
+type fakeBackend struct {
+	*apitest.Backend[Record]
+	garble bool // reply to the next POST with a broken body
+}
+
+func newFakeBackend() *fakeBackend {
+	f := &fakeBackend{}
+	f.Backend = apitest.NewBackend[Record](f.serve)
+	return f
+}
+
+// edit changes a field as another client would.
+func (f *fakeBackend) edit(id, field, value, at string) {
+	f.Lock()
+	defer f.Unlock()
+	r := f.Records[id]
+	r.Fields[field], r.Modified[field] = value, at
+	f.Store(id, r)
+}
+
+func (f *fakeBackend) serve(w http.ResponseWriter, r *http.Request) {
+	reply := func(status int, rec *Record) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(rec)
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/flow/"), "/")
+	switch {
+	case r.URL.Path == "/v1/flow/changes":
+		var page changes
+		page.Changes, page.Cursor, page.HasMore = f.Changes(r.URL.Query().Get("since"))
+		json.NewEncoder(w).Encode(page)
+
+	case r.Method == "POST" && len(parts) == 1:
+		var rec Record
+		json.NewDecoder(r.Body).Decode(&rec)
+		stored, _ := f.Create(r.Header.Get("Idempotency-Key"), func(id string) *Record {
+			rec.ID = id
+			return &rec
+		})
+		if f.garble {
+			f.garble = false
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "{")
+			return
+		}
+		reply(http.StatusCreated, stored)
+
+	default:
+		id := parts[len(parts)-1]
+		current, ok := f.Records[id]
+		if !ok || current.Deleted {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			reply(http.StatusOK, current)
+		case "PATCH":
+			var rec Record
+			json.NewDecoder(r.Body).Decode(&rec)
+			for field, value := range rec.Fields {
+				if !later(current.Modified[field], rec.Modified[field]) {
+					current.Fields[field], current.Modified[field] = value, rec.Modified[field]
+				}
+			}
+			f.Store(id, current)
+			reply(http.StatusOK, current)
+		case "DELETE":
+			deletedAt := r.URL.Query().Get("deleted_at")
+			if later(latest(current.Modified), deletedAt) {
+				http.Error(w, "edited since", http.StatusConflict)
+				return
+			}
+			f.Store(id, &Record{Type: current.Type, ID: id, Deleted: true, DeletedAt: deletedAt})
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+type device struct {
+	t  *testing.T
+	db *sql.DB
+	s  *Syncer
+}
+
+func newDevice(t *testing.T, server *httptest.Server) *device {
+	database := dbtest.Open(t)
+	s := New(apitest.Client(server), database)
+	s.Now = func() time.Time { return time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC) }
+	return &device{t: t, db: database, s: s}
+}
+
+func (d *device) sync() *Report {
+	d.t.Helper()
+	report, err := d.s.Sync(false)
+	if err != nil {
+		d.t.Fatalf("Sync failed: %v", err)
+	}
+	return report
+}
+
+func (d *device) task(ref string) *flow.Task {
+	d.t.Helper()
+	task, err := flow.Get(d.db, ref)
+	if err != nil {
+		d.t.Fatalf("Get(%q) failed: %v", ref, err)
+	}
+	return task
+}
+
+// backdate sets when the queued changes to a task were made.
+func (d *device) backdate(id int64, at string) {
+	d.t.Helper()
+	if _, err := d.db.Exec("UPDATE flow_pending SET changed_at = ? WHERE kind = 'task' AND row_id = ?", at, id); err != nil {
+		d.t.Fatal(err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	backend := newFakeBackend()
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	a, b := newDevice(t, server), newDevice(t, server)
+
+	launch, _ := flow.Create(a.db, flow.Task{Title: "Launch", Priority: 3, Project: "site", Tags: []string{"web"}})
+	draft, _ := flow.Create(a.db, flow.Task{Title: "Write copy", Due: "2026-05-04"})
+	// The parent comes after its subtask, so it is linked once both exist.
+	review, _ := flow.Create(a.db, flow.Task{Title: "Review"})
+	flow.SetParent(a.db, draft.ID, review.ID)
+	flow.AddBlocker(a.db, launch.ID, review.ID)
+	flow.CreateEvent(a.db, flow.Event{Title: "Demo", Start: time.Date(2026, 5, 5, 14, 0, 0, 0, time.Local),
+		End: time.Date(2026, 5, 5, 15, 0, 0, 0, time.Local)})
+
+	if r := a.sync(); r.Count(true) != 6 { // four records, then two links
+		t.Fatalf("first sync: %+v", r)
+	}
+	if r := b.sync(); r.Count(false) != 4 {
+		t.Fatalf("second device pulled %+v", r)
+	}
+	got := b.task("Write copy")
+	if got.Due != "2026-05-04" || got.ParentID != b.task("Review").ID {
+		t.Fatalf("pulled subtask = %+v", got)
+	}
+	if got := b.task("Launch"); got.Project != "site" || got.Waiting != 1 || len(got.Tags) != 1 {
+		t.Fatalf("pulled task = %+v", got)
+	}
+	if e, err := flow.GetEvent(b.db, "Demo"); err != nil || e.Start.Hour() != 14 {
+		t.Fatalf("pulled event = %+v, %v", e, err)
+	}
+
+	// Echoes of our own pushes change nothing.
+	backend.Requests = nil
+	if r := a.sync(); len(r.Changes) != 0 {
+		t.Fatalf("idle sync: %+v", r.Changes)
+	}
+	for _, req := range backend.Requests {
+		if !strings.HasPrefix(req, "GET /v1/flow/changes?") {
+			t.Fatalf("idle sync requests: %v", backend.Requests)
+		}
+	}
+
+	// Both sides edit the launch task: each field goes to the later edit.
+	l := a.task("Launch")
+	l.Title, l.Priority = "Launch site", 2
+	flow.Update(a.db, l)
+	a.backdate(l.ID, "2026-05-01T10:00:00.000Z")
+	l = b.task("Launch")
+	l.Title = "Ship it"
+	flow.Update(b.db, l)
+	b.backdate(l.ID, "2026-05-01T11:00:00.000Z")
+	a.sync()
+	r := b.sync()
+	if len(r.Conflicts) != 1 || r.Conflicts[0].Field != "title" || r.Conflicts[0].Winner != "local" {
+		t.Fatalf("conflicting sync: %+v", r.Conflicts)
+	}
+	a.sync()
+	for _, d := range []*device{a, b} {
+		if got := d.task("Ship it"); got.Priority != 2 {
+			t.Fatalf("merged task = %+v", got)
+		}
+	}
+	var logged int
+	b.db.QueryRow("SELECT COUNT(*) FROM flow_conflicts").Scan(&logged)
+	if logged != 1 {
+		t.Errorf("%d conflicts logged, want 1", logged)
+	}
+
+	// Offline edits stay queued and go out on the next sync.
+	backend.Offline = true
+	c := a.task("Write copy")
+	c.Status = flow.Done
+	flow.Update(a.db, c)
+	if _, err := a.s.Sync(false); err == nil {
+		t.Fatal("sync succeeded offline")
+	}
+	if n, _ := Pending(a.db); n != 1 {
+		t.Fatalf("%d changes pending, want 1", n)
+	}
+	backend.Offline = false
+
+	// A dry run shows the plan and sends nothing.
+	backend.Requests = nil
+	r, err := a.s.Sync(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Changes) != 1 || !r.Changes[0].Push || r.Changes[0].Fields[0] != "status" {
+		t.Fatalf("dry run: %+v", r.Changes)
+	}
+	if len(backend.Requests) != 1 {
+		t.Fatalf("dry run requests: %v", backend.Requests)
+	}
+	a.sync()
+	b.sync()
+	if got := b.task("Write copy"); got.Status != flow.Done {
+		t.Fatalf("offline edit not replayed: %+v", got)
+	}
+
+	// Deletes propagate.
+	flow.DeleteEvent(a.db, eventID(t, a, "Demo"))
+	if r := a.sync(); r.Count(true) != 1 {
+		t.Fatalf("delete sync: %+v", r.Changes)
+	}
+	b.sync()
+	if _, err := flow.GetEvent(b.db, "Demo"); err == nil {
+		t.Fatal("deleted event still present on the second device")
+	}
+
+	// A deletion loses to a later edit on the other side.
+	remoteID := b.remoteID("Ship it")
+	flow.Delete(b.db, b.task("Ship it").ID)
+	b.db.Exec("UPDATE flow_tombstones SET deleted_at = '2026-05-01T12:00:00.000Z'")
+	backend.edit(remoteID, "status", "doing", "2026-05-01T13:00:00.000Z")
+	r = b.sync()
+	if len(r.Conflicts) != 1 || r.Conflicts[0].Field != "deleted" || r.Conflicts[0].Winner != "remote" {
+		t.Fatalf("delete conflict: %+v", r.Conflicts)
+	}
+	if got := b.task("Ship it"); got.Status != flow.Doing || got.Waiting != 1 {
+		t.Fatalf("restored task = %+v", got)
+	}
+}
+
+func eventID(t *testing.T, d *device, ref string) int64 {
+	t.Helper()
+	e, err := flow.GetEvent(d.db, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.ID
+}
+
+func (d *device) remoteID(ref string) string {
+	d.t.Helper()
+	var id string
+	if err := d.db.QueryRow("SELECT remote_id FROM tasks WHERE id = ?", d.task(ref).ID).Scan(&id); err != nil {
+		d.t.Fatal(err)
+	}
+	return id
+}
+
+func TestSyncLostCreate(t *testing.T) {
+	backend := newFakeBackend()
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	a, b := newDevice(t, server), newDevice(t, server)
+
+	flow.Create(a.db, flow.Task{Title: "Once"})
+	backend.garble = true
+	if _, err := a.s.Sync(false); err == nil {
+		t.Fatal("sync succeeded with a broken reply")
+	}
+	a.sync()
+	if len(backend.Records) != 1 {
+		t.Fatalf("backend has %d records, want the one created", len(backend.Records))
+	}
+	if r := a.sync(); len(r.Changes) != 0 {
+		t.Fatalf("the retried create came back as %+v", r.Changes)
+	}
+	if r := b.sync(); r.Count(false) != 1 {
+		t.Fatalf("second device pulled %+v", r.Changes)
+	}
+}
+
+// Edits made while a request is out are not lost: no transaction is held
+// across the request, and the edit stays queued for the next sync.
+func TestSyncEditInFlight(t *testing.T) {
+	backend := newFakeBackend()
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	a, b := newDevice(t, server), newDevice(t, server)
+
+	task, _ := flow.Create(a.db, flow.Task{Title: "Draft"})
+	rename := func(title string) func(r *http.Request) {
+		return func(r *http.Request) {
+			if r.Method == "POST" || r.Method == "PATCH" {
+				backend.After = nil
+				task, _ := flow.GetByID(a.db, task.ID)
+				task.Title = title
+				if err := flow.Update(a.db, task); err != nil {
+					t.Errorf("edit during %s: %v", r.Method, err)
+				}
+			}
+		}
+	}
+
+	// The edit is queued when the create is recorded, and sent with the
+	// updates of the same sync.
+	backend.After = rename("Draft v2")
+	a.sync()
+	if got := backend.Records[a.remoteID("Draft v2")]; got.Fields["title"] != "Draft v2" {
+		t.Fatalf("backend has %+v after an edit during the create", got)
+	}
+
+	task.Priority = 2
+	flow.Update(a.db, task)
+	backend.After = rename("Draft v3")
+	a.sync()
+	if n, _ := Pending(a.db); n != 1 {
+		t.Fatalf("%d changes pending after an edit during the update, want 1", n)
+	}
+
+	a.sync()
+	b.sync()
+	if got := b.task("Draft v3"); got.Priority != 2 {
+		t.Fatalf("second device has %+v", got)
+	}
+}
@@ -0,0 +1,77 @@
+// Package gitcred implements the git credential-helper protocol, see
+// gitcredentials(7), and names the vault entries credentials are kept under.
+package gitcred
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Prefix starts the vault entry name of every git credential.
+const Prefix = "git:"
+
+// Credential holds the attributes git sends to a credential helper.
+type Credential struct {
+	Protocol string
+	Host     string
+	Path     string
+	Username string
+	Password string
+}
+
+// Read parses the key=value lines git writes to a helper, up to a blank line
+// or the end of input. Unknown keys are ignored, as the protocol requires.
+func Read(r io.Reader) (*Credential, error) {
+	c := &Credential{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed credential line: %q", line)
+		}
+		switch key {
+		case "protocol":
+			c.Protocol = value
+		case "host":
+			c.Host = value
+		case "path":
+			c.Path = value
+		case "username":
+			c.Username = value
+		case "password":
+			c.Password = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if c.Protocol == "" || c.Host == "" {
+		return nil, errors.New("credential request is missing protocol or host")
+	}
+	return c, nil
+}
+
+// SecretNames returns the vault entry names for c, most specific first:
+// git:proto://host/path, then git:proto://host. Paths are only sent by git
+// when credential.useHttpPath is enabled.
+func (c *Credential) SecretNames() []string {
+	base := fmt.Sprintf("%s%s://%s", Prefix, c.Protocol, c.Host)
+	if path := strings.TrimPrefix(c.Path, "/"); path != "" {
+		return []string{base + "/" + path, base}
+	}
+	return []string{base}
+}
+
+// Accepts reports whether a credential stored for username answers c. A
+// request naming a user (from a URL like https://alice@host) only matches
+// credentials of that user.
+func (c *Credential) Accepts(username string) bool {
+	return c.Username == "" || c.Username == username
+}
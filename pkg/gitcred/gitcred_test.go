@@ -0,0 +1,91 @@
+package gitcred
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  *Credential
+		err   string
+	}{
+		{
+			name:  "get",
+			input: "protocol=https\nhost=github.com\n\n",
+			want:  &Credential{Protocol: "https", Host: "github.com"},
+		},
+		{
+			name:  "store",
+			input: "protocol=https\nhost=example.com:8443\npath=org/repo.git\nusername=alice\npassword=p=w\n",
+			want: &Credential{Protocol: "https", Host: "example.com:8443", Path: "org/repo.git",
+				Username: "alice", Password: "p=w"},
+		},
+		{
+			name:  "crlf and unknown keys",
+			input: "protocol=https\r\nhost=github.com\r\nwwwauth[]=Basic\r\ncapability[]=authtype\r\n",
+			want:  &Credential{Protocol: "https", Host: "github.com"},
+		},
+		{
+			name:  "stops at blank line",
+			input: "protocol=https\nhost=github.com\n\nusername=mallory\n",
+			want:  &Credential{Protocol: "https", Host: "github.com"},
+		},
+		{name: "malformed", input: "protocol=https\nhost\n", err: "malformed"},
+		{name: "no host", input: "protocol=https\n", err: "missing protocol or host"},
+		{name: "empty", input: "", err: "missing protocol or host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.input))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != *tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSecretNames(t *testing.T) {
+	tests := []struct {
+		c    Credential
+		want []string
+	}{
+		{Credential{Protocol: "https", Host: "github.com"}, []string{"git:https://github.com"}},
+		{Credential{Protocol: "https", Host: "github.com", Path: "org/repo.git"},
+			[]string{"git:https://github.com/org/repo.git", "git:https://github.com"}},
+		{Credential{Protocol: "https", Host: "github.com", Path: "/org/repo.git"},
+			[]string{"git:https://github.com/org/repo.git", "git:https://github.com"}},
+		{Credential{Protocol: "http", Host: "localhost:3000", Path: "/"}, []string{"git:http://localhost:3000"}},
+	}
+	for _, tt := range tests {
+		if got := tt.c.SecretNames(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: expected %v, got %v", tt.c, tt.want, got)
+		}
+	}
+}
+
+func TestAccepts(t *testing.T) {
+	anyone := Credential{Protocol: "https", Host: "github.com"}
+	alice := Credential{Protocol: "https", Host: "github.com", Username: "alice"}
+	if !anyone.Accepts("bob") {
+		t.Error("a request without a username should accept any stored user")
+	}
+	if !alice.Accepts("alice") {
+		t.Error("expected alice to be accepted for alice")
+	}
+	if alice.Accepts("bob") || alice.Accepts("") {
+		t.Error("a request for alice must not accept another user")
+	}
+}
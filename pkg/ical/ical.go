@@ -0,0 +1,302 @@
+// Package ical reads and writes iCalendar data (RFC 5545): components such as
+// VCALENDAR, VEVENT and VTODO made of properties, and the date, time and text
+// values Flow stores.
+package ical
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Property is a content line: a name, its parameters and a raw value. TEXT
+// values are kept escaped; use Component.Text to read them.
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Param returns a parameter value, or "" when it is missing.
+func (p *Property) Param(name string) string {
+	return p.Params[strings.ToUpper(name)]
+}
+
+// Component is a BEGIN/END block with its properties and nested components.
+type Component struct {
+	Name       string
+	Props      []Property
+	Components []*Component
+}
+
+// New returns an empty component.
+func New(name string) *Component {
+	return &Component{Name: strings.ToUpper(name)}
+}
+
+// Prop returns the first property with the given name, or nil.
+func (c *Component) Prop(name string) *Property {
+	name = strings.ToUpper(name)
+	for i := range c.Props {
+		if c.Props[i].Name == name {
+			return &c.Props[i]
+		}
+	}
+	return nil
+}
+
+// PropsNamed returns every property with the given name.
+func (c *Component) PropsNamed(name string) []*Property {
+	name = strings.ToUpper(name)
+	var result []*Property
+	for i := range c.Props {
+		if c.Props[i].Name == name {
+			result = append(result, &c.Props[i])
+		}
+	}
+	return result
+}
+
+// Text returns the unescaped TEXT value of a property, or "".
+func (c *Component) Text(name string) string {
+	if p := c.Prop(name); p != nil {
+		return Unescape(p.Value)
+	}
+	return ""
+}
+
+// TextList returns the unescaped values of a comma-separated TEXT list, such
+// as CATEGORIES, across every property with that name.
+func (c *Component) TextList(name string) []string {
+	var result []string
+	for _, p := range c.PropsNamed(name) {
+		var item strings.Builder
+		for i := 0; i < len(p.Value); i++ {
+			switch {
+			case p.Value[i] == '\\' && i+1 < len(p.Value):
+				item.WriteString(Unescape(p.Value[i : i+2]))
+				i++
+			case p.Value[i] == ',':
+				result = append(result, item.String())
+				item.Reset()
+			default:
+				item.WriteByte(p.Value[i])
+			}
+		}
+		result = append(result, item.String())
+	}
+	return result
+}
+
+// Add appends a property with a raw value. params are name, value pairs.
+func (c *Component) Add(name, value string, params ...string) {
+	p := Property{Name: strings.ToUpper(name), Value: value}
+	if len(params) > 0 {
+		p.Params = make(map[string]string)
+		for i := 0; i+1 < len(params); i += 2 {
+			p.Params[strings.ToUpper(params[i])] = params[i+1]
+		}
+	}
+	c.Props = append(c.Props, p)
+}
+
+// AddText appends a TEXT property, escaping it. Empty text is left out.
+func (c *Component) AddText(name, text string) {
+	if text != "" {
+		c.Add(name, Escape(text))
+	}
+}
+
+// Children returns the nested components with the given name.
+func (c *Component) Children(name string) []*Component {
+	name = strings.ToUpper(name)
+	var result []*Component
+	for _, child := range c.Components {
+		if child.Name == name {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+var (
+	escaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+// Escape encodes text for a TEXT value.
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// Unescape decodes a TEXT value.
+func Unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+// Decode reads the top-level components (normally a single VCALENDAR) from r.
+func Decode(r io.Reader) ([]*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []*Component
+	var stack []*Component
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", n+1)
+		}
+		switch p.Name {
+		case "BEGIN":
+			c := New(p.Value)
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.Components = append(parent.Components, c)
+			} else {
+				roots = append(roots, c)
+			}
+			stack = append(stack, c)
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1].Name != strings.ToUpper(p.Value) {
+				return nil, errors.Errorf("line %d: unexpected END:%s", n+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			if len(stack) == 0 {
+				return nil, errors.Errorf("line %d: %s outside a component", n+1, p.Name)
+			}
+			c := stack[len(stack)-1]
+			c.Props = append(c.Props, p)
+		}
+	}
+	if len(stack) > 0 {
+		return nil, errors.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+	return roots, nil
+}
+
+// unfold joins continuation lines (starting with a space or tab) to the line
+// before them.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// parseLine splits "NAME;PARAM=value;PARAM="quoted":value". Quoted parameter
+// values may contain ':' and ';'.
+func parseLine(line string) (Property, error) {
+	var p Property
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return p, errors.Errorf("invalid content line %q", line)
+	}
+	p.Name = strings.ToUpper(line[:i])
+	for line[i] == ';' {
+		rest := line[i+1:]
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return p, errors.Errorf("invalid parameter in %q", line)
+		}
+		name := strings.ToUpper(rest[:eq])
+		j := i + 1 + eq + 1
+		var value string
+		if j < len(line) && line[j] == '"' {
+			end := strings.IndexByte(line[j+1:], '"')
+			if end < 0 {
+				return p, errors.Errorf("unterminated quote in %q", line)
+			}
+			value = line[j+1 : j+1+end]
+			j += end + 2
+		} else {
+			end := strings.IndexAny(line[j:], ";:")
+			if end < 0 {
+				return p, errors.Errorf("missing value in %q", line)
+			}
+			value = line[j : j+end]
+			j += end
+		}
+		if p.Params == nil {
+			p.Params = make(map[string]string)
+		}
+		p.Params[name] = value
+		if j >= len(line) {
+			return p, errors.Errorf("missing value in %q", line)
+		}
+		i = j
+	}
+	if line[i] != ':' {
+		return p, errors.Errorf("invalid content line %q", line)
+	}
+	p.Value = line[i+1:]
+	return p, nil
+}
+
+// Encode writes c with CRLF line endings, folding lines longer than 75 octets.
+func Encode(w io.Writer, c *Component) error {
+	bw := bufio.NewWriter(w)
+	encode(bw, c)
+	return bw.Flush()
+}
+
+func encode(w *bufio.Writer, c *Component) {
+	writeLine(w, "BEGIN:"+c.Name)
+	for _, p := range c.Props {
+		var b strings.Builder
+		b.WriteString(p.Name)
+		for _, name := range sortedKeys(p.Params) {
+			value := p.Params[name]
+			if strings.ContainsAny(value, ";:,") {
+				value = `"` + value + `"`
+			}
+			b.WriteString(";" + name + "=" + value)
+		}
+		b.WriteString(":" + p.Value)
+		writeLine(w, b.String())
+	}
+	for _, child := range c.Components {
+		encode(w, child)
+	}
+	writeLine(w, "END:"+c.Name)
+}
+
+// writeLine folds line at 75 octets without splitting a UTF-8 sequence.
+func writeLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // the leading space counts
+	}
+	w.WriteString(line + "\r\n")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,158 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const sample = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VTIMEZONE\r\n" +
+	"TZID:Custom Standard Time\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"DTSTART:16010101T000000\r\n" +
+	"TZOFFSETFROM:+0200\r\n" +
+	"TZOFFSETTO:+0130\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:1@example.com\r\n" +
+	"SUMMARY:Planning\\, round 2\r\n" +
+	"DESCRIPTION:Bring the\\nslides\r\n" +
+	"DTSTART;TZID=\"Europe/Berlin\":20260310T090000\r\n" +
+	"DTEND;TZID=Custom Standard Time:20260310T100000\r\n" +
+	"CATEGORIES:work,a\\,b\r\n" +
+	"X-LONG:abcdefghij\r\n" +
+	" klmnop\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestDecode(t *testing.T) {
+	roots, err := Decode(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if len(roots) != 1 || roots[0].Name != "VCALENDAR" {
+		t.Fatalf("roots = %+v", roots)
+	}
+	cal := roots[0]
+	events := cal.Children("VEVENT")
+	if len(events) != 1 {
+		t.Fatalf("got %d events", len(events))
+	}
+	v := events[0]
+	if got := v.Text("SUMMARY"); got != "Planning, round 2" {
+		t.Errorf("SUMMARY = %q", got)
+	}
+	if got := v.Text("DESCRIPTION"); got != "Bring the\nslides" {
+		t.Errorf("DESCRIPTION = %q", got)
+	}
+	if got := v.Text("X-LONG"); got != "abcdefghijklmnop" {
+		t.Errorf("folded line = %q", got)
+	}
+	if got := v.TextList("CATEGORIES"); len(got) != 2 || got[1] != "a,b" {
+		t.Errorf("CATEGORIES = %q", got)
+	}
+
+	zones := ZonesOf(cal)
+	start, err := v.Prop("DTSTART").DateTime(zones)
+	if err != nil || start.TZID != "Europe/Berlin" || start.Time.Hour() != 9 {
+		t.Fatalf("DTSTART = %+v, %v", start, err)
+	}
+	// A zone Go does not know falls back to the VTIMEZONE offset, in UTC.
+	end, err := v.Prop("DTEND").DateTime(zones)
+	if err != nil || end.TZID != "UTC" || !end.Time.Equal(time.Date(2026, 3, 10, 8, 30, 0, 0, time.UTC)) {
+		t.Fatalf("DTEND = %+v, %v", end, err)
+	}
+
+	if _, err := Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nEND:VCALENDAR\r\n")); err == nil {
+		t.Error("Decode accepted mismatched END")
+	}
+}
+
+func TestDateTime(t *testing.T) {
+	for _, tc := range []struct {
+		prop   Property
+		want   string
+		allDay bool
+		tzid   string
+	}{
+		{Property{Name: "DTSTART", Value: "20260310", Params: map[string]string{"VALUE": "DATE"}}, "2026-03-10 00:00", true, ""},
+		{Property{Name: "DTSTART", Value: "20260310T170000Z"}, "2026-03-10 17:00", false, "UTC"},
+		{Property{Name: "DTSTART", Value: "20260310T170000"}, "2026-03-10 17:00", false, ""},
+	} {
+		got, err := tc.prop.DateTime(nil)
+		if err != nil || got.Time.Format("2006-01-02 15:04") != tc.want || got.AllDay != tc.allDay || got.TZID != tc.tzid {
+			t.Errorf("DateTime(%s) = %+v, %v", tc.prop.Value, got, err)
+		}
+	}
+	bad := Property{Name: "DTSTART", Value: "20260310T1700", Params: map[string]string{"TZID": "Nowhere/Land"}}
+	if _, err := bad.DateTime(nil); err == nil {
+		t.Error("accepted an unknown zone")
+	}
+}
+
+func TestAddDuration(t *testing.T) {
+	start := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	for in, want := range map[string]time.Time{
+		"PT1H30M": start.Add(90 * time.Minute),
+		"P1D":     start.AddDate(0, 0, 1),
+		"P1W":     start.AddDate(0, 0, 7),
+		"-PT15M":  start.Add(-15 * time.Minute),
+	} {
+		if got, err := AddDuration(start, in); err != nil || !got.Equal(want) {
+			t.Errorf("AddDuration(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := AddDuration(start, "1 hour"); err == nil {
+		t.Error("accepted an invalid duration")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	v := New("VEVENT")
+	v.AddText("SUMMARY", strings.Repeat("é", 60)+", done; ok")
+	v.Add("DTSTART", "20260310T090000", "TZID", "Europe/Berlin")
+	var buf bytes.Buffer
+	if err := Encode(&buf, v); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line longer than 75 octets: %q", line)
+		}
+	}
+	roots, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := roots[0].Text("SUMMARY"); got != strings.Repeat("é", 60)+", done; ok" {
+		t.Errorf("round trip SUMMARY = %q", got)
+	}
+	if got := roots[0].Prop("DTSTART").Param("TZID"); got != "Europe/Berlin" {
+		t.Errorf("round trip TZID = %q", got)
+	}
+}
+
+func TestVTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	tz := VTimezone(berlin, 2026)
+	daylight, standard := tz.Children("DAYLIGHT"), tz.Children("STANDARD")
+	if len(daylight) != 1 || len(standard) != 1 {
+		t.Fatalf("VTIMEZONE = %+v", tz)
+	}
+	if got := daylight[0].Text("DTSTART"); got != "20260329T020000" {
+		t.Errorf("DAYLIGHT DTSTART = %s", got)
+	}
+	if got := daylight[0].Text("RRULE"); got != "FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU" {
+		t.Errorf("DAYLIGHT RRULE = %s", got)
+	}
+	if got := standard[0].Text("TZOFFSETTO"); got != "+0100" {
+		t.Errorf("STANDARD TZOFFSETTO = %s", got)
+	}
+}
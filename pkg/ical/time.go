@@ -0,0 +1,245 @@
+package ical
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Layouts of DATE and DATE-TIME values.
+const (
+	DateLayout     = "20060102"
+	DateTimeLayout = "20060102T150405"
+	UTCLayout      = "20060102T150405Z"
+)
+
+// DateTime is a DATE or DATE-TIME value.
+type DateTime struct {
+	Time   time.Time // in its zone; dates and floating times are in time.Local
+	AllDay bool      // a DATE without a time of day
+	TZID   string    // IANA zone name or "UTC"; "" for dates and floating times
+}
+
+// Zones resolves TZID parameters. Names Go knows (IANA names such as
+// "Europe/Berlin") are used as they are; for others the standard offset of the
+// calendar's VTIMEZONE is used, which is exact outside daylight saving time.
+type Zones map[string]*time.Location
+
+// ZonesOf collects the VTIMEZONE definitions of a calendar.
+func ZonesOf(cal *Component) Zones {
+	zones := make(Zones)
+	for _, tz := range cal.Children("VTIMEZONE") {
+		id := tz.Text("TZID")
+		parts := tz.Children("STANDARD")
+		if len(parts) == 0 {
+			parts = tz.Children("DAYLIGHT")
+		}
+		if id == "" || len(parts) == 0 {
+			continue
+		}
+		if offset, err := parseOffset(parts[0].Text("TZOFFSETTO")); err == nil {
+			zones[id] = time.FixedZone(id, offset)
+		}
+	}
+	return zones
+}
+
+// Location looks up a TZID. known is false when the zone is only approximated
+// from a VTIMEZONE.
+func (z Zones) Location(tzid string) (loc *time.Location, known bool, err error) {
+	name := strings.TrimPrefix(tzid, "/")
+	if loc, err := time.LoadLocation(name); err == nil && name != "" && name != "Local" {
+		return loc, true, nil
+	}
+	if loc := z[tzid]; loc != nil {
+		return loc, false, nil
+	}
+	return nil, false, errors.Errorf("unknown time zone %q", tzid)
+}
+
+var offsetRe = regexp.MustCompile(`^([+-])(\d{2})(\d{2})(\d{2})?$`)
+
+// parseOffset reads a UTC offset such as "+0100" or "-053000" in seconds.
+func parseOffset(s string) (int, error) {
+	m := offsetRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, errors.Errorf("invalid UTC offset %q", s)
+	}
+	h, _ := strconv.Atoi(m[2])
+	min, _ := strconv.Atoi(m[3])
+	sec := 0
+	if m[4] != "" {
+		sec, _ = strconv.Atoi(m[4])
+	}
+	offset := h*3600 + min*60 + sec
+	if m[1] == "-" {
+		offset = -offset
+	}
+	return offset, nil
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+	if seconds%60 != 0 {
+		s += fmt.Sprintf("%02d", seconds%60)
+	}
+	return s
+}
+
+// DateTime reads a DATE or DATE-TIME property. Times in a zone only known from
+// its VTIMEZONE are converted to UTC, so TZID is always a name Go can load.
+func (p *Property) DateTime(zones Zones) (DateTime, error) {
+	value := strings.TrimSpace(p.Value)
+	if p.Param("VALUE") == "DATE" || len(value) == len(DateLayout) {
+		t, err := time.ParseInLocation(DateLayout, value, time.Local)
+		if err != nil {
+			return DateTime{}, errors.Errorf("invalid %s date %q", p.Name, value)
+		}
+		return DateTime{Time: t, AllDay: true}, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(UTCLayout, value)
+		if err != nil {
+			return DateTime{}, errors.Errorf("invalid %s time %q", p.Name, value)
+		}
+		return DateTime{Time: t, TZID: "UTC"}, nil
+	}
+
+	id := p.Param("TZID")
+	if id == "" {
+		// A floating time: the same wall time wherever it is read.
+		t, err := time.ParseInLocation(DateTimeLayout, value, time.Local)
+		if err != nil {
+			return DateTime{}, errors.Errorf("invalid %s time %q", p.Name, value)
+		}
+		return DateTime{Time: t}, nil
+	}
+	loc, known, err := zones.Location(id)
+	if err != nil {
+		return DateTime{}, err
+	}
+	t, err := time.ParseInLocation(DateTimeLayout, value, loc)
+	if err != nil {
+		return DateTime{}, errors.Errorf("invalid %s time %q", p.Name, value)
+	}
+	if !known {
+		return DateTime{Time: t.UTC(), TZID: "UTC"}, nil
+	}
+	return DateTime{Time: t, TZID: loc.String()}, nil
+}
+
+// AddDateTime appends a DATE or DATE-TIME property for d.
+func (c *Component) AddDateTime(name string, d DateTime) {
+	switch {
+	case d.AllDay:
+		c.Add(name, d.Time.Format(DateLayout), "VALUE", "DATE")
+	case d.TZID == "UTC":
+		c.Add(name, d.Time.UTC().Format(UTCLayout))
+	case d.TZID == "":
+		c.Add(name, d.Time.Format(DateTimeLayout))
+	default:
+		c.Add(name, d.Time.Format(DateTimeLayout), "TZID", d.TZID)
+	}
+}
+
+var durationRe = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// AddDuration moves t by a DURATION value such as "PT1H30M" or "P1D". Days
+// and weeks are calendar days, so they keep the time of day across daylight
+// saving changes.
+func AddDuration(t time.Time, s string) (time.Time, error) {
+	m := durationRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		return time.Time{}, errors.Errorf("invalid duration %q", s)
+	}
+	n := make([]int, 7)
+	for i := 2; i <= 6; i++ {
+		n[i], _ = strconv.Atoi(m[i])
+	}
+	sign := 1
+	if m[1] == "-" {
+		sign = -1
+	}
+	t = t.AddDate(0, 0, sign*(7*n[2]+n[3]))
+	return t.Add(time.Duration(sign) * (time.Duration(n[4])*time.Hour + time.Duration(n[5])*time.Minute + time.Duration(n[6])*time.Second)), nil
+}
+
+// VTimezone describes loc as it is in the given year, so that times written
+// with its TZID can be read by calendars that do not know the zone's name.
+// Zones with daylight saving time get yearly rules for both changes.
+func VTimezone(loc *time.Location, year int) *Component {
+	tz := New("VTIMEZONE")
+	tz.Add("TZID", loc.String())
+
+	jan := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	changes := transitions(loc, year)
+	if len(changes) != 2 {
+		_, offset := jan.Zone()
+		std := New("STANDARD")
+		std.Add("DTSTART", "19700101T000000")
+		std.Add("TZOFFSETFROM", formatOffset(offset))
+		std.Add("TZOFFSETTO", formatOffset(offset))
+		tz.Components = append(tz.Components, std)
+		return tz
+	}
+
+	for _, at := range changes {
+		before := at.Add(-time.Second)
+		name, to := at.Zone()
+		_, from := before.Zone()
+		kind := "STANDARD"
+		if to > from {
+			kind = "DAYLIGHT"
+		}
+		// DTSTART is the local time the change happens at, in the old offset.
+		local := at.Add(time.Duration(from) * time.Second).UTC()
+		part := New(kind)
+		part.Add("DTSTART", local.Format(DateTimeLayout))
+		part.Add("TZOFFSETFROM", formatOffset(from))
+		part.Add("TZOFFSETTO", formatOffset(to))
+		part.Add("TZNAME", name)
+		week := (local.Day()-1)/7 + 1
+		if local.AddDate(0, 0, 7).Month() != local.Month() {
+			week = -1
+		}
+		part.Add("RRULE", "FREQ=YEARLY;BYMONTH="+strconv.Itoa(int(local.Month()))+
+			";BYDAY="+strconv.Itoa(week)+strings.ToUpper(local.Weekday().String()[:2]))
+		tz.Components = append(tz.Components, part)
+	}
+	return tz
+}
+
+// transitions finds the moments in year when loc changes its UTC offset.
+func transitions(loc *time.Location, year int) []time.Time {
+	var result []time.Time
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	end := time.Date(year+1, time.January, 1, 0, 0, 0, 0, loc)
+	for day := start; day.Before(end); day = day.Add(24 * time.Hour) {
+		next := day.Add(24 * time.Hour)
+		_, a := day.Zone()
+		_, b := next.Zone()
+		if a == b {
+			continue
+		}
+		// Narrow down to the second.
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if _, m := mid.Zone(); m == a {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		result = append(result, hi.Truncate(time.Second))
+	}
+	return result
+}
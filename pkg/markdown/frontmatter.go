@@ -0,0 +1,191 @@
+package markdown
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+const fence = "---"
+
+var plainScalarRe = regexp.MustCompile(`^[\p{L}\p{N}_][\p{L}\p{N}_ ./@+-]*$`)
+
+// FrontMatter is the YAML block at the top of a Markdown file. Only flat keys
+// with scalar or list values are understood, which is what Kylrix exports and
+// what Obsidian writes; other lines are ignored when parsing.
+type FrontMatter struct {
+	keys   []string
+	values map[string][]string
+	lists  map[string]bool
+}
+
+// NewFrontMatter returns an empty front matter block.
+func NewFrontMatter() *FrontMatter {
+	return &FrontMatter{values: make(map[string][]string), lists: make(map[string]bool)}
+}
+
+func (f *FrontMatter) set(key string, values []string, list bool) {
+	if _, ok := f.values[key]; !ok {
+		f.keys = append(f.keys, key)
+	}
+	f.values[key] = values
+	f.lists[key] = list
+}
+
+// Set stores a scalar value. Keys keep the order they were first set in.
+func (f *FrontMatter) Set(key, value string) { f.set(key, []string{value}, false) }
+
+// SetList stores a list value.
+func (f *FrontMatter) SetList(key string, values []string) { f.set(key, values, true) }
+
+// Has reports whether key is present.
+func (f *FrontMatter) Has(key string) bool {
+	_, ok := f.values[key]
+	return ok
+}
+
+// Get returns a scalar value, or "" when key is missing.
+func (f *FrontMatter) Get(key string) string {
+	if v := f.values[key]; len(v) > 0 && !f.lists[key] {
+		return v[0]
+	}
+	return ""
+}
+
+// List returns a list value. A scalar is split on commas and spaces, the way
+// Obsidian accepts "tags: a, b".
+func (f *FrontMatter) List(key string) []string {
+	v := f.values[key]
+	if f.lists[key] || len(v) == 0 {
+		return v
+	}
+	return strings.FieldsFunc(v[0], func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+// String renders the block including its --- fences and trailing newline.
+func (f *FrontMatter) String() string {
+	var b strings.Builder
+	b.WriteString(fence + "\n")
+	for _, key := range f.keys {
+		b.WriteString(key + ":")
+		if !f.lists[key] {
+			b.WriteString(" " + quote(f.values[key][0]) + "\n")
+			continue
+		}
+		items := make([]string, len(f.values[key]))
+		for i, v := range f.values[key] {
+			items[i] = quote(v)
+		}
+		b.WriteString(" [" + strings.Join(items, ", ") + "]\n")
+	}
+	b.WriteString(fence + "\n")
+	return b.String()
+}
+
+// quote leaves simple scalars bare and writes everything else as a JSON
+// string, which is also a valid YAML double-quoted scalar.
+func quote(s string) string {
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return s
+	}
+	if plainScalarRe.MatchString(s) && strings.TrimSpace(s) == s {
+		return s
+	}
+	q, _ := json.Marshal(s)
+	return string(q)
+}
+
+func unquote(s string) string {
+	s = strings.TrimSpace(s)
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		var v string
+		if json.Unmarshal([]byte(s), &v) == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	}
+	return s
+}
+
+// splitFlow splits the items of a [a, "b, c"] flow sequence.
+func splitFlow(s string) []string {
+	var items []string
+	var cur strings.Builder
+	var quoteChar rune
+	for _, r := range s {
+		switch {
+		case quoteChar != 0:
+			if r == quoteChar {
+				quoteChar = 0
+			}
+		case r == '"' || r == '\'':
+			quoteChar = r
+		case r == ',':
+			items = append(items, unquote(cur.String()))
+			cur.Reset()
+			continue
+		}
+		cur.WriteRune(r)
+	}
+	if strings.TrimSpace(cur.String()) != "" {
+		items = append(items, unquote(cur.String()))
+	}
+	return items
+}
+
+// SplitFrontMatter separates the front matter from the body of src. When src
+// has no front matter the result is empty and body is src unchanged.
+func SplitFrontMatter(src string) (*FrontMatter, string) {
+	f := NewFrontMatter()
+	text := strings.ReplaceAll(src, "\r\n", "\n")
+	if !strings.HasPrefix(text, fence+"\n") {
+		return f, src
+	}
+	end := strings.Index(text[len(fence)+1:], "\n"+fence)
+	if end < 0 {
+		return f, src
+	}
+	block := text[len(fence)+1 : len(fence)+1+end]
+	body := text[len(fence)+1+end+1+len(fence):]
+	// The closing fence may be the last line of the file.
+	if i := strings.IndexByte(body, '\n'); i >= 0 && strings.TrimSpace(body[:i]) == "" {
+		body = body[i+1:]
+	} else if strings.TrimSpace(body) == "" {
+		body = ""
+	}
+
+	var listKey string
+	for _, line := range strings.Split(block, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if listKey != "" && strings.HasPrefix(trimmed, "- ") {
+			f.values[listKey] = append(f.values[listKey], unquote(trimmed[2:]))
+			continue
+		}
+		listKey = ""
+		if line[0] == ' ' || line[0] == '\t' {
+			continue // nested mapping, not supported
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case value == "":
+			f.SetList(key, nil)
+			listKey = key
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			f.SetList(key, splitFlow(value[1:len(value)-1]))
+		default:
+			f.Set(key, unquote(value))
+		}
+	}
+	return f, body
+}
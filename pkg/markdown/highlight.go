@@ -0,0 +1,170 @@
+package markdown
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+var (
+	keywordStyle = color.New(color.FgBlue, color.Bold)
+	stringStyle  = color.New(color.FgGreen)
+	numberStyle  = color.New(color.FgMagenta)
+	commentStyle = color.New(color.Faint, color.Italic)
+	literalStyle = color.New(color.FgMagenta)
+	plainStyle   = color.New(color.FgCyan)
+)
+
+// language describes just enough of a language to colour it line by line.
+type language struct {
+	keywords map[string]bool
+	literals map[string]bool
+	comments []string
+	quotes   string
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	cLike = language{
+		literals: words("true false nil null undefined iota"),
+		comments: []string{"//"},
+		quotes:   "\"'`",
+	}
+	languages = map[string]language{
+		"go": {
+			keywords: words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var"),
+			literals: cLike.literals, comments: cLike.comments, quotes: cLike.quotes,
+		},
+		"js": {
+			keywords: words("async await break case catch class const continue default delete do else export extends finally for from function if import in instanceof let new of return static super switch this throw try typeof var void while yield interface type enum implements"),
+			literals: cLike.literals, comments: cLike.comments, quotes: cLike.quotes,
+		},
+		"rust": {
+			keywords: words("as async await break const continue crate else enum extern fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait type unsafe use where while"),
+			literals: words("true false None Some Ok Err"), comments: cLike.comments, quotes: "\"",
+		},
+		"python": {
+			keywords: words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield"),
+			literals: words("True False None self"), comments: []string{"#"}, quotes: "\"'",
+		},
+		"sh": {
+			keywords: words("if then else elif fi for while until do done case esac in function return export local set unset echo cd exit"),
+			literals: words("true false"), comments: []string{"#"}, quotes: "\"'",
+		},
+		"sql": {
+			keywords: words("select from where and or not insert into values update set delete create table index view drop alter add column join left right inner outer on group by order having limit offset as distinct union primary key references default trigger begin end case when then else null is in like exists SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX VIEW DROP ALTER ADD COLUMN JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS DISTINCT UNION PRIMARY KEY REFERENCES DEFAULT TRIGGER BEGIN END CASE WHEN THEN ELSE NULL IS IN LIKE EXISTS"),
+			comments: []string{"--"}, quotes: "'\"",
+		},
+		"json": {
+			literals: words("true false null"), quotes: "\"",
+		},
+		"yaml": {
+			literals: words("true false null yes no on off"), comments: []string{"#"}, quotes: "\"'",
+		},
+	}
+	aliases = map[string]string{
+		"golang": "go", "javascript": "js", "ts": "js", "typescript": "js", "jsx": "js", "tsx": "js",
+		"rs": "rust", "py": "python", "bash": "sh", "shell": "sh", "zsh": "sh", "console": "sh",
+		"yml": "yaml", "sqlite": "sql", "c": "go", "cpp": "go", "java": "go",
+	}
+)
+
+// Highlight colours the lines of a code block written in lang. Unknown
+// languages are shown in a single code colour.
+func Highlight(lang string, lines []string) []string {
+	lang = strings.ToLower(lang)
+	if alias, ok := aliases[lang]; ok {
+		lang = alias
+	}
+	spec, known := languages[lang]
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if !known {
+			out[i] = plainStyle.Sprint(line)
+			continue
+		}
+		out[i] = spec.highlight(line)
+	}
+	return out
+}
+
+func (l language) highlight(line string) string {
+	var b strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+
+		if l.isComment(rest) {
+			b.WriteString(commentStyle.Sprint(rest))
+			break
+		}
+
+		r := runes[i]
+		switch {
+		case strings.ContainsRune(l.quotes, r):
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			b.WriteString(stringStyle.Sprint(string(runes[i : j+1])))
+			i = j + 1
+
+		case unicode.IsDigit(r) && (i == 0 || !isIdent(runes[i-1])):
+			j := i
+			for j < len(runes) && (isIdent(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			b.WriteString(numberStyle.Sprint(string(runes[i:j])))
+			i = j
+
+		case isIdent(r):
+			j := i
+			for j < len(runes) && isIdent(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			switch {
+			case l.keywords[word]:
+				b.WriteString(keywordStyle.Sprint(word))
+			case l.literals[word]:
+				b.WriteString(literalStyle.Sprint(word))
+			default:
+				b.WriteString(word)
+			}
+			i = j
+
+		default:
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
+
+func (l language) isComment(s string) bool {
+	for _, c := range l.comments {
+		if strings.HasPrefix(s, c) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdent(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,36 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// wikiLinkRe matches [[Target]], [[Target|alias]] and [[Target#heading]] but
+// not ![[embeds]].
+var wikiLinkRe = regexp.MustCompile(`(^|[^!])\[\[([^\]|#^\n]+)(?:[#^][^\]|\n]*)?(?:\|[^\]\n]*)?\]\]`)
+
+// WikiLinks returns the distinct targets of the [[wikilinks]] in src, in order
+// of appearance, ignoring fenced code blocks.
+func WikiLinks(src string) []string {
+	var targets []string
+	seen := make(map[string]bool)
+	inCode := false
+	for _, line := range strings.Split(src, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		for _, m := range wikiLinkRe.FindAllStringSubmatch(line, -1) {
+			target := strings.TrimSpace(m[2])
+			if target != "" && !seen[strings.ToLower(target)] {
+				seen[strings.ToLower(target)] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
@@ -0,0 +1,236 @@
+// Package markdown renders Markdown notes for display in a terminal.
+//
+// It covers what notes actually use: ATX headings, emphasis, inline code,
+// fenced code blocks (with syntax highlighting), lists and task lists, block
+// quotes, rules, links and pipe tables. Anything else passes through as text.
+// Colors follow fatih/color, so NO_COLOR and non-terminal output are honoured.
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+var (
+	headingRe  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	fenceRe    = regexp.MustCompile("^(```+|~~~+)\\s*([\\w+#.-]*)")
+	ruleRe     = regexp.MustCompile(`^(?:(?:\*\s*){3,}|(?:-\s*){3,}|(?:_\s*){3,})$`)
+	listRe     = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	taskRe     = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+	tableSepRe = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+
+	codeSpanRe = regexp.MustCompile("`([^`]+)`")
+	imageRe    = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	linkRe     = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)[^)]*\)`)
+	autoLinkRe = regexp.MustCompile(`<(https?://[^>\s]+)>`)
+	strongRe   = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*|__(\S(?:.*?\S)?)__`)
+	strikeRe   = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	emStarRe   = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	emUnderRe  = regexp.MustCompile(`(^|[^\w])_(\S(?:[^_]*?\S)?)_([^\w]|$)`)
+	heldRe     = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+var (
+	h1Style     = color.New(color.FgMagenta, color.Bold, color.Underline)
+	h2Style     = color.New(color.FgMagenta, color.Bold)
+	hStyle      = color.New(color.Bold)
+	strongStyle = color.New(color.Bold)
+	emStyle     = color.New(color.Italic)
+	strikeStyle = color.New(color.CrossedOut)
+	codeStyle   = color.New(color.FgCyan)
+	linkStyle   = color.New(color.FgBlue, color.Underline)
+	dimStyle    = color.New(color.Faint)
+	quoteStyle  = color.New(color.Faint, color.Italic)
+	bulletStyle = color.New(color.FgYellow)
+)
+
+// Render formats src for a terminal that is width columns wide.
+func Render(src string, width int) string {
+	if width <= 0 {
+		width = 80
+	}
+	var out strings.Builder
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	blank := false
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if trimmed == "" {
+			if !blank && out.Len() > 0 {
+				out.WriteString("\n")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+
+		switch {
+		case fenceRe.MatchString(trimmed):
+			m := fenceRe.FindStringSubmatch(trimmed)
+			var code []string
+			for i++; i < len(lines); i++ {
+				if strings.HasPrefix(strings.TrimSpace(lines[i]), m[1]) {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			if m[2] != "" {
+				out.WriteString(dimStyle.Sprint("  ╭─ "+m[2]) + "\n")
+			}
+			for _, l := range Highlight(m[2], code) {
+				out.WriteString(dimStyle.Sprint("  │ ") + l + "\n")
+			}
+
+		case headingRe.MatchString(trimmed):
+			m := headingRe.FindStringSubmatch(trimmed)
+			text := inline(m[2])
+			switch len(m[1]) {
+			case 1:
+				out.WriteString(h1Style.Sprint(text) + "\n")
+			case 2:
+				out.WriteString(h2Style.Sprint(text) + "\n")
+			default:
+				out.WriteString(hStyle.Sprint(m[1]+" "+text) + "\n")
+			}
+
+		case ruleRe.MatchString(trimmed):
+			out.WriteString(dimStyle.Sprint(strings.Repeat("─", width)) + "\n")
+
+		case strings.Contains(line, "|") && i+1 < len(lines) && tableSepRe.MatchString(lines[i+1]):
+			header := tableCells(line)
+			var rows [][]string
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, tableCells(lines[i]))
+			}
+			i--
+			out.WriteString(renderTable(header, rows))
+
+		case strings.HasPrefix(trimmed, ">"):
+			text := strings.TrimSpace(strings.TrimLeft(trimmed, "> "))
+			out.WriteString(dimStyle.Sprint("│ ") + quoteStyle.Sprint(inline(text)) + "\n")
+
+		case listRe.MatchString(line):
+			m := listRe.FindStringSubmatch(line)
+			indent := strings.Repeat("  ", len(strings.ReplaceAll(m[1], "\t", "    "))/2)
+			marker, text := "•", m[3]
+			if _, err := strconv.Atoi(strings.TrimRight(m[2], ".)")); err == nil {
+				marker = m[2]
+			}
+			if t := taskRe.FindStringSubmatch(text); t != nil {
+				marker, text = "☐", t[2]
+				if t[1] != " " {
+					marker = "☑"
+					text = dimStyle.Sprint(t[2])
+				}
+			}
+			out.WriteString(indent + bulletStyle.Sprint(marker) + " " + inline(text) + "\n")
+
+		default:
+			out.WriteString(inline(trimmed) + "\n")
+		}
+	}
+	return strings.TrimRight(out.String(), "\n") + "\n"
+}
+
+// tableCells splits a pipe table row, honouring escaped pipes.
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, inline(strings.TrimSpace(cell.String())))
+			cell.Reset()
+		default:
+			cell.WriteByte(line[i])
+		}
+	}
+	return append(cells, inline(strings.TrimSpace(cell.String())))
+}
+
+func renderTable(header []string, rows [][]string) string {
+	var buf bytes.Buffer
+	table := tablewriter.NewWriter(&buf)
+	table.Header(header)
+	for _, row := range rows {
+		// Pad or trim ragged rows to the header width.
+		cells := make([]string, len(header))
+		copy(cells, row)
+		table.Append(cells)
+	}
+	table.Render()
+	return buf.String()
+}
+
+// inline applies span-level formatting to a single line of text. Code spans
+// and link targets are held aside first so emphasis markers inside them are
+// left alone. The markers use NUL bytes, so any in the text are dropped.
+func inline(text string) string {
+	text = strings.ReplaceAll(text, "\x00", "")
+	var held []string
+	hold := func(s string) string {
+		held = append(held, s)
+		return fmt.Sprintf("\x00%d\x00", len(held)-1)
+	}
+
+	text = codeSpanRe.ReplaceAllStringFunc(text, func(s string) string {
+		return hold(codeStyle.Sprint(codeSpanRe.FindStringSubmatch(s)[1]))
+	})
+	text = imageRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := imageRe.FindStringSubmatch(s)
+		return hold(dimStyle.Sprintf("[image: %s] (%s)", m[1], m[2]))
+	})
+	text = linkRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := linkRe.FindStringSubmatch(s)
+		if m[1] == m[2] {
+			return hold(linkStyle.Sprint(m[2]))
+		}
+		return hold(linkStyle.Sprint(m[1]) + " " + dimStyle.Sprintf("(%s)", m[2]))
+	})
+	text = autoLinkRe.ReplaceAllStringFunc(text, func(s string) string {
+		return hold(linkStyle.Sprint(autoLinkRe.FindStringSubmatch(s)[1]))
+	})
+
+	text = strongRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := strongRe.FindStringSubmatch(s)
+		return strongStyle.Sprint(m[1] + m[2])
+	})
+	text = strikeRe.ReplaceAllStringFunc(text, func(s string) string {
+		return strikeStyle.Sprint(strikeRe.FindStringSubmatch(s)[1])
+	})
+	text = emStarRe.ReplaceAllStringFunc(text, func(s string) string {
+		return emStyle.Sprint(emStarRe.FindStringSubmatch(s)[1])
+	})
+	text = emUnderRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := emUnderRe.FindStringSubmatch(s)
+		return m[1] + emStyle.Sprint(m[2]) + m[3]
+	})
+
+	// Held spans may themselves contain held spans (code inside link text).
+	for heldRe.MatchString(text) {
+		text = heldRe.ReplaceAllStringFunc(text, func(s string) string {
+			n, err := strconv.Atoi(heldRe.FindStringSubmatch(s)[1])
+			if err != nil || n >= len(held) {
+				return ""
+			}
+			return held[n]
+		})
+	}
+	return text
+}
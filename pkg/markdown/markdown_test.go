@@ -0,0 +1,67 @@
+package markdown
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestRender(t *testing.T) {
+	color.NoColor = true
+
+	tests := []struct {
+		name, src string
+		want      []string
+		absent    []string
+	}{
+		{"heading", "## Deploy *now*", []string{"Deploy now"}, []string{"##", "*"}},
+		{"emphasis", "a **bold** and _em_ and ~~old~~ word", []string{"a bold and em and old word"}, nil},
+		{"snake case", "call my_func_name here", []string{"my_func_name"}, nil},
+		{"code span", "run `a*b*c` here", []string{"run a*b*c here"}, nil},
+		{"link", "see [docs](https://x.dev/a_b_c)", []string{"docs (https://x.dev/a_b_c)"}, []string{"]("}},
+		{"list", "- one\n  - two\n1. first", []string{"• one", "  • two", "1. first"}, nil},
+		{"tasks", "- [ ] open\n- [x] done", []string{"☐ open", "☑ done"}, nil},
+		{"quote", "> careful", []string{"│ careful"}, nil},
+		{"fence", "```go\nfunc main() {}\n```", []string{"╭─ go", "│ func main() {}"}, []string{"```"}},
+		{"table", "| Host | Port |\n|---|--:|\n| db | 5432 |", []string{"HOST", "5432", "│"}, []string{"--:"}},
+		{"nul markers", "a \x007\x00 and `b` \x000\x00", []string{"a 7 and b 0"}, []string{"\x00"}},
+	}
+	for _, tt := range tests {
+		got := Render(tt.src, 40)
+		for _, w := range tt.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: output missing %q:\n%s", tt.name, w, got)
+			}
+		}
+		for _, a := range tt.absent {
+			if strings.Contains(got, a) {
+				t.Errorf("%s: output should not contain %q:\n%s", tt.name, a, got)
+			}
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	color.NoColor = false
+	defer func() { color.NoColor = true }()
+
+	line := Highlight("golang", []string{`return "x" // done`})[0]
+	for _, part := range []string{keywordStyle.Sprint("return"), stringStyle.Sprint(`"x"`), commentStyle.Sprint("// done")} {
+		if !strings.Contains(line, part) {
+			t.Errorf("highlighted line %q missing %q", line, part)
+		}
+	}
+	if got := Highlight("brainfuck", []string{"+++"})[0]; got != plainStyle.Sprint("+++") {
+		t.Errorf("unknown language should use the plain code style, got %q", got)
+	}
+}
+
+func TestWikiLinks(t *testing.T) {
+	src := "See [[Plan]], [[plan|the plan]] and [[Runbook#Failover]].\n![[diagram.png]]\n```\n[[not a link]]\n```\n[[a1b2c3d4]]"
+	want := []string{"Plan", "Runbook", "a1b2c3d4"}
+	if got := WikiLinks(src); !reflect.DeepEqual(got, want) {
+		t.Errorf("WikiLinks = %v, want %v", got, want)
+	}
+}
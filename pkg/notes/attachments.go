@@ -0,0 +1,115 @@
+package notes
+
+import (
+	"github.com/nathfavour/kylrix/cli/pkg/attachments"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+)
+
+// Attachment is a file attached to a note. The file itself is kept in an
+// attachments.Store under its hash; Data is only filled in for JSON export.
+type Attachment struct {
+	Hash      string `json:"hash"`
+	Name      string `json:"name"`
+	Mime      string `json:"mime,omitempty"`
+	Size      int64  `json:"size"`
+	CreatedAt string `json:"created,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+}
+
+// Embed returns the Markdown that shows a in a note.
+func (a *Attachment) Embed() string {
+	return "![" + a.Name + "](" + attachments.URL(a.Hash) + ")"
+}
+
+// Attach records that noteID uses the stored file a.Hash. Attaching the same
+// file again only renames it.
+func Attach(q db.Querier, noteID int64, a Attachment) error {
+	if _, err := q.Exec("INSERT OR IGNORE INTO attachments (hash, size, mime) VALUES (?, ?, ?)", a.Hash, a.Size, a.Mime); err != nil {
+		return err
+	}
+	_, err := q.Exec(`INSERT INTO note_attachments (note_id, hash, name) VALUES (?, ?, ?)
+		ON CONFLICT (note_id, hash) DO UPDATE SET name = excluded.name`, noteID, a.Hash, a.Name)
+	return err
+}
+
+// Attachments lists the files attached to a note, oldest first.
+func Attachments(q db.Querier, noteID int64) ([]Attachment, error) {
+	rows, err := q.Query(`SELECT a.hash, na.name, a.mime, a.size, na.created_at
+		FROM note_attachments na JOIN attachments a ON a.hash = na.hash
+		WHERE na.note_id = ? ORDER BY na.created_at, na.name`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.Hash, &a.Name, &a.Mime, &a.Size, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// referenced is true for a note_attachments row na whose note still mentions
+// the file, in its content or in a revision that could be restored. Encrypted
+// text cannot be checked, so it always counts as a reference.
+const referenced = `EXISTS (SELECT 1 FROM notes n WHERE n.id = na.note_id
+		AND (n.encrypted = 1 OR instr(n.content, 'kylrix://attach/' || na.hash) > 0))
+	OR EXISTS (SELECT 1 FROM note_revisions r WHERE r.note_id = na.note_id
+		AND (r.encrypted = 1 OR instr(r.content, 'kylrix://attach/' || na.hash) > 0))`
+
+// UnusedAttachments returns the hashes of stored files that no note refers to
+// any more: their notes were deleted or no longer link to them.
+func UnusedAttachments(q db.Querier) ([]string, error) {
+	rows, err := q.Query(`SELECT hash FROM attachments WHERE hash NOT IN (
+		SELECT na.hash FROM note_attachments na WHERE ` + referenced + `
+	) ORDER BY hash`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
+
+// PruneAttachments forgets the attachments returned by UnusedAttachments, and
+// the note attachments whose notes no longer mention them. The caller removes
+// the files.
+func PruneAttachments(q db.Querier) ([]string, error) {
+	if _, err := q.Exec(`DELETE FROM note_attachments AS na WHERE NOT (` + referenced + `)`); err != nil {
+		return nil, err
+	}
+	hashes, err := UnusedAttachments(q)
+	if err != nil {
+		return nil, err
+	}
+	_, err = q.Exec("DELETE FROM attachments WHERE hash NOT IN (SELECT hash FROM note_attachments)")
+	return hashes, err
+}
+
+// KnownAttachments reports whether each hash has an attachments row.
+func KnownAttachments(q db.Querier) (map[string]bool, error) {
+	rows, err := q.Query("SELECT hash FROM attachments")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	known := make(map[string]bool)
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		known[hash] = true
+	}
+	return known, rows.Err()
+}
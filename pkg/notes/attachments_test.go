@@ -0,0 +1,50 @@
+package notes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestAttachments(t *testing.T) {
+	q := dbtest.Open(t)
+	shot := Attachment{Hash: strings.Repeat("ab", 32), Name: "screen.png", Mime: "image/png", Size: 10}
+	log := Attachment{Hash: strings.Repeat("cd", 32), Name: "app.log", Size: 20}
+
+	a, _ := Create(q, Note{Title: "Incident", Content: shot.Embed() + "\n" + log.Embed()})
+	b, _ := Create(q, Note{Title: "Postmortem", Content: shot.Embed()})
+	for _, att := range []Attachment{shot, log} {
+		if err := Attach(q, a.ID, att); err != nil {
+			t.Fatalf("Attach failed: %v", err)
+		}
+	}
+	Attach(q, b.ID, shot)
+
+	list, err := Attachments(q, a.ID)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("Attachments = %+v, %v; want 2", list, err)
+	}
+
+	// The log is still in a revision, so dropping it from the note keeps it.
+	a.Content = shot.Embed()
+	Update(q, a)
+	if unused, _ := UnusedAttachments(q); len(unused) != 0 {
+		t.Fatalf("unused after edit = %v, want none", unused)
+	}
+
+	// Deleting the note leaves the log unused; the screenshot is still in b.
+	if err := Delete(q, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	pruned, err := PruneAttachments(q)
+	if err != nil {
+		t.Fatalf("PruneAttachments failed: %v", err)
+	}
+	if len(pruned) != 1 || pruned[0] != log.Hash {
+		t.Fatalf("pruned %v, want the log only", pruned)
+	}
+	if known, _ := KnownAttachments(q); !known[shot.Hash] || known[log.Hash] {
+		t.Errorf("known attachments after prune: %v", known)
+	}
+}
@@ -0,0 +1,101 @@
+package notes
+
+import (
+	"strconv"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/markdown"
+)
+
+// Notes link to each other with [[Title]] or [[id]]. Links are stored as
+// written and resolved when queried, like Get resolves a reference: against
+// note IDs, ID prefixes that match a single note, and titles, all
+// case-insensitively. Encrypted notes record no links, which would leak their
+// content.
+
+// resolves is the join condition between note_links l and a target note t.
+var resolves = `(t.uid = lower(l.target)
+	OR (length(l.target) >= ` + strconv.Itoa(minPrefix) + ` AND substr(t.uid, 1, length(l.target)) = lower(l.target)
+		AND (SELECT COUNT(*) FROM notes u WHERE substr(u.uid, 1, length(l.target)) = lower(l.target)) = 1)
+	OR t.title = l.target COLLATE NOCASE)`
+
+// setLinks replaces the stored links of a note with those in its content.
+func setLinks(q db.Querier, n *Note) error {
+	if _, err := q.Exec("DELETE FROM note_links WHERE source_id = ?", n.ID); err != nil {
+		return err
+	}
+	if n.Encrypted {
+		return nil
+	}
+	for _, target := range markdown.WikiLinks(n.Content) {
+		if _, err := q.Exec("INSERT OR IGNORE INTO note_links (source_id, target) VALUES (?, ?)", n.ID, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backlinks lists the notes that link to n.
+func Backlinks(q db.Querier, n *Note) ([]Note, error) {
+	rows, err := q.Query(`SELECT `+columns+` FROM notes n WHERE n.id IN (
+		SELECT l.source_id FROM note_links l JOIN notes t ON `+resolves+` WHERE t.id = ?
+	) ORDER BY n.updated_at DESC, n.id DESC`, n.ID)
+	if err != nil {
+		return nil, err
+	}
+	return scan(rows)
+}
+
+// Edge is a resolved link between two notes, by UID.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Edges returns every link that resolves to a note.
+func Edges(q db.Querier) ([]Edge, error) {
+	rows, err := q.Query(`SELECT DISTINCT s.uid, t.uid FROM note_links l
+		JOIN notes s ON s.id = l.source_id
+		JOIN notes t ON ` + resolves + `
+		ORDER BY s.uid, t.uid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var edges []Edge
+	for rows.Next() {
+		var e Edge
+		if err := rows.Scan(&e.From, &e.To); err != nil {
+			return nil, err
+		}
+		edges = append(edges, e)
+	}
+	return edges, rows.Err()
+}
+
+// BrokenLink is a link whose target matches no note.
+type BrokenLink struct {
+	Source Note
+	Target string
+}
+
+// BrokenLinks lists links that do not resolve, grouped by source note.
+func BrokenLinks(q db.Querier) ([]BrokenLink, error) {
+	rows, err := q.Query(`SELECT ` + columns + `, l.target FROM note_links l
+		JOIN notes n ON n.id = l.source_id
+		WHERE NOT EXISTS (SELECT 1 FROM notes t WHERE ` + resolves + `)
+		ORDER BY n.title COLLATE NOCASE, l.target`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var broken []BrokenLink
+	for rows.Next() {
+		var b BrokenLink
+		if err := scanNote(rows, &b.Source, &b.Target); err != nil {
+			return nil, err
+		}
+		broken = append(broken, b)
+	}
+	return broken, rows.Err()
+}
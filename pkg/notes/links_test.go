@@ -0,0 +1,49 @@
+package notes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestLinks(t *testing.T) {
+	q := dbtest.Open(t)
+	runbook, _ := Create(q, Note{Title: "Runbook", Content: "steps"})
+	idx, err := Create(q, Note{Title: "Index", Content: "[[runbook]] and [[Missing]]"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	byID, _ := Create(q, Note{Title: "Ref", Content: "[[" + runbook.UID + "]]"})
+	// IDs resolve whatever their case, and by a unique prefix.
+	upper, _ := Create(q, Note{Title: "Upper", Content: "[[" + strings.ToUpper(runbook.UID) + "]]"})
+	prefix, _ := Create(q, Note{Title: "Prefix", Content: "[[" + runbook.UID[:6] + "]]"})
+
+	back, err := Backlinks(q, runbook)
+	if err != nil || len(back) != 4 {
+		t.Fatalf("Backlinks = %d notes, %v; want 4", len(back), err)
+	}
+	Delete(q, upper.ID)
+	Delete(q, prefix.ID)
+
+	broken, _ := BrokenLinks(q)
+	if len(broken) != 1 || broken[0].Target != "Missing" || broken[0].Source.ID != idx.ID {
+		t.Fatalf("unexpected broken links: %+v", broken)
+	}
+
+	// Creating the target fixes the link; editing the source drops old links.
+	if _, err := Create(q, Note{Title: "missing", Content: ""}); err != nil {
+		t.Fatal(err)
+	}
+	byID.Content = "no links now"
+	if err := Update(q, byID); err != nil {
+		t.Fatal(err)
+	}
+	if broken, _ := BrokenLinks(q); len(broken) != 0 {
+		t.Errorf("expected no broken links, got %+v", broken)
+	}
+	edges, _ := Edges(q)
+	if len(edges) != 2 {
+		t.Errorf("expected 2 edges, got %+v", edges)
+	}
+}
@@ -0,0 +1,194 @@
+package notes
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when no note matches a reference.
+var ErrNotFound = errors.New("note not found")
+
+// minPrefix is the shortest ID prefix accepted when looking a note up.
+const minPrefix = 4
+
+// Note is a row of the notes table.
+type Note struct {
+	ID        int64
+	UID       string
+	Title     string
+	Content   string
+	CreatedAt string
+	UpdatedAt string
+	Pinned    bool
+	Encrypted bool // Content holds crypto.Encrypt ciphertext under the vault MEK
+	Notebook  string
+	Tags      []string
+}
+
+// AmbiguousError lists the notes matching a reference that is not unique.
+type AmbiguousError struct {
+	Ref     string
+	Matches []Note
+}
+
+func (e *AmbiguousError) Error() string {
+	ids := make([]string, len(e.Matches))
+	for i, n := range e.Matches {
+		ids[i] = n.UID
+	}
+	return fmt.Sprintf("'%s' matches %d notes (%s); use an ID", e.Ref, len(e.Matches), strings.Join(ids, ", "))
+}
+
+// columns selects a Note from "notes n", including its notebook name and tags.
+const columns = `n.id, n.uid, n.title, n.content, n.created_at, n.updated_at, n.pinned, n.encrypted,
+	COALESCE((SELECT name FROM notebooks WHERE id = n.notebook_id), ''),
+	COALESCE((SELECT group_concat(t.name, ',') FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = n.id), '')`
+
+// scanNote reads the columns above, followed by any extra destinations.
+func scanNote(rows *sql.Rows, n *Note, extra ...interface{}) error {
+	var tags string
+	dest := append([]interface{}{&n.ID, &n.UID, &n.Title, &n.Content, &n.CreatedAt, &n.UpdatedAt, &n.Pinned, &n.Encrypted, &n.Notebook, &tags}, extra...)
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	n.Tags = nil
+	if tags != "" {
+		n.Tags = strings.Split(tags, ",")
+		sort.Strings(n.Tags)
+	}
+	return nil
+}
+
+func scan(rows *sql.Rows) ([]Note, error) {
+	defer rows.Close()
+	var result []Note
+	for rows.Next() {
+		var n Note
+		if err := scanNote(rows, &n); err != nil {
+			return nil, err
+		}
+		result = append(result, n)
+	}
+	return result, rows.Err()
+}
+
+// Filter narrows List. Empty fields match everything; all Tags must be present.
+type Filter struct {
+	Tags      []string
+	Notebook  string
+	Encrypted bool // only encrypted notes
+}
+
+// List returns the notes matching f, pinned first, then most recently updated.
+func List(q db.Querier, f Filter) ([]Note, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if f.Notebook != "" {
+		where = append(where, "n.notebook_id = (SELECT id FROM notebooks WHERE name = ?)")
+		args = append(args, f.Notebook)
+	}
+	if f.Encrypted {
+		where = append(where, "n.encrypted = 1")
+	}
+	for _, tag := range f.Tags {
+		where = append(where, `EXISTS (SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+			WHERE nt.note_id = n.id AND t.name = ?)`)
+		args = append(args, tag)
+	}
+
+	rows, err := q.Query("SELECT "+columns+" FROM notes n WHERE "+strings.Join(where, " AND ")+
+		" ORDER BY n.pinned DESC, n.updated_at DESC, n.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	return scan(rows)
+}
+
+// Get resolves ref as an exact ID, then an ID prefix, then an exact title.
+func Get(q db.Querier, ref string) (*Note, error) {
+	type lookup struct {
+		where string
+		args  []interface{}
+	}
+	id := strings.ToLower(ref)
+	lookups := []lookup{{"n.uid = ?", []interface{}{id}}}
+	if len(ref) >= minPrefix {
+		lookups = append(lookups, lookup{"substr(n.uid, 1, ?) = ?", []interface{}{len(id), id}})
+	}
+	lookups = append(lookups, lookup{"n.title = ?", []interface{}{ref}})
+
+	for _, l := range lookups {
+		rows, err := q.Query("SELECT "+columns+" FROM notes n WHERE "+l.where+" ORDER BY n.id", l.args...)
+		if err != nil {
+			return nil, err
+		}
+		matches, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		switch len(matches) {
+		case 0:
+			continue
+		case 1:
+			return &matches[0], nil
+		default:
+			return nil, &AmbiguousError{Ref: ref, Matches: matches}
+		}
+	}
+	return nil, errors.Wrapf(ErrNotFound, "'%s'", ref)
+}
+
+// GetByID loads a note by its row ID.
+func GetByID(q db.Querier, id int64) (*Note, error) {
+	rows, err := q.Query("SELECT "+columns+" FROM notes n WHERE n.id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+	return &matches[0], nil
+}
+
+// Create inserts a note from n's title, content and encryption flag and returns
+// it with its generated ID and timestamps. Its links are recorded too.
+func Create(q db.Querier, n Note) (*Note, error) {
+	res, err := q.Exec("INSERT INTO notes (title, content, encrypted) VALUES (?, ?, ?)", n.Title, n.Content, n.Encrypted)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	created, err := GetByID(q, id)
+	if err != nil {
+		return nil, err
+	}
+	return created, setLinks(q, created)
+}
+
+// Update saves the title, content and encryption flag of n and refreshes its
+// links. updated_at is maintained by a trigger.
+func Update(q db.Querier, n *Note) error {
+	_, err := q.Exec("UPDATE notes SET title = ?, content = ?, encrypted = ? WHERE id = ?", n.Title, n.Content, n.Encrypted, n.ID)
+	if err != nil {
+		return err
+	}
+	return setLinks(q, n)
+}
+
+// Delete removes a note.
+func Delete(q db.Querier, id int64) error {
+	_, err := q.Exec("DELETE FROM notes WHERE id = ?", id)
+	return err
+}
@@ -0,0 +1,108 @@
+package notes
+
+import (
+	"strings"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/pkg/errors"
+)
+
+// normalizeTag strips a leading '#' and surrounding space; tags match case-insensitively.
+func normalizeTag(tag string) string {
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// AddTags tags a note, creating tags that don't exist yet.
+func AddTags(q db.Querier, noteID int64, tags ...string) error {
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		if _, err := q.Exec("INSERT OR IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+			return err
+		}
+		_, err := q.Exec(`INSERT OR IGNORE INTO note_tags (note_id, tag_id)
+			SELECT ?, id FROM tags WHERE name = ?`, noteID, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveTags untags a note. Unknown tags are ignored.
+func RemoveTags(q db.Querier, noteID int64, tags ...string) error {
+	for _, tag := range tags {
+		_, err := q.Exec(`DELETE FROM note_tags
+			WHERE note_id = ? AND tag_id = (SELECT id FROM tags WHERE name = ?)`, noteID, normalizeTag(tag))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetTags replaces the tags of a note.
+func SetTags(q db.Querier, noteID int64, tags ...string) error {
+	if _, err := q.Exec("DELETE FROM note_tags WHERE note_id = ?", noteID); err != nil {
+		return err
+	}
+	return AddTags(q, noteID, tags...)
+}
+
+// SetNotebook files a note into the named notebook, creating it if needed.
+// An empty name takes the note out of any notebook.
+func SetNotebook(q db.Querier, noteID int64, notebook string) error {
+	notebook = strings.TrimSpace(notebook)
+	if notebook == "" {
+		_, err := q.Exec("UPDATE notes SET notebook_id = NULL WHERE id = ?", noteID)
+		return err
+	}
+	if _, err := q.Exec("INSERT OR IGNORE INTO notebooks (name) VALUES (?)", notebook); err != nil {
+		return err
+	}
+	_, err := q.Exec("UPDATE notes SET notebook_id = (SELECT id FROM notebooks WHERE name = ?) WHERE id = ?", notebook, noteID)
+	return err
+}
+
+// SetPinned pins or unpins a note. Pinned notes are listed first.
+func SetPinned(q db.Querier, noteID int64, pinned bool) error {
+	_, err := q.Exec("UPDATE notes SET pinned = ? WHERE id = ?", pinned, noteID)
+	return err
+}
+
+// Count is a name with the number of notes that use it.
+type Count struct {
+	Name  string
+	Notes int
+}
+
+// TagCounts lists every tag with the number of notes carrying it.
+func TagCounts(q db.Querier) ([]Count, error) {
+	return counts(q, `SELECT t.name, COUNT(nt.note_id) FROM tags t
+		LEFT JOIN note_tags nt ON nt.tag_id = t.id GROUP BY t.id ORDER BY t.name`)
+}
+
+// NotebookCounts lists every notebook with the number of notes filed in it.
+func NotebookCounts(q db.Querier) ([]Count, error) {
+	return counts(q, `SELECT nb.name, COUNT(n.id) FROM notebooks nb
+		LEFT JOIN notes n ON n.notebook_id = nb.id GROUP BY nb.id ORDER BY nb.name`)
+}
+
+func counts(q db.Querier, query string) ([]Count, error) {
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to count notes")
+	}
+	defer rows.Close()
+	var result []Count
+	for rows.Next() {
+		var c Count
+		if err := rows.Scan(&c.Name, &c.Notes); err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
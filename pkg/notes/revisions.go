@@ -0,0 +1,145 @@
+package notes
+
+import (
+	"database/sql"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/pkg/errors"
+)
+
+// DefaultRevisionLimit is how many revisions per note are kept when the
+// retention setting is left at zero.
+const DefaultRevisionLimit = 50
+
+// Revision is an earlier version of a note. Revisions are written by a trigger
+// whenever a note's title or content changes.
+type Revision struct {
+	NoteID    int64
+	Rev       int
+	Title     string
+	Content   string
+	Encrypted bool
+	CreatedAt string
+}
+
+// AsNote returns the revision as a note value, e.g. for decryption or display.
+func (r *Revision) AsNote(n *Note) *Note {
+	v := *n
+	v.Title, v.Content, v.Encrypted = r.Title, r.Content, r.Encrypted
+	return &v
+}
+
+// Revisions lists a note's revisions, oldest first.
+func Revisions(q db.Querier, noteID int64) ([]Revision, error) {
+	rows, err := q.Query(`SELECT note_id, rev, title, content, encrypted, created_at
+		FROM note_revisions WHERE note_id = ? ORDER BY rev`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []Revision
+	for rows.Next() {
+		var r Revision
+		if err := rows.Scan(&r.NoteID, &r.Rev, &r.Title, &r.Content, &r.Encrypted, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// GetRevision loads a single revision.
+func GetRevision(q db.Querier, noteID int64, rev int) (*Revision, error) {
+	r := Revision{NoteID: noteID, Rev: rev}
+	err := q.QueryRow(`SELECT title, content, encrypted, created_at
+		FROM note_revisions WHERE note_id = ? AND rev = ?`, noteID, rev).
+		Scan(&r.Title, &r.Content, &r.Encrypted, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, errors.Errorf("revision %d not found", rev)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// LatestRevision returns the highest revision number of a note, or 0.
+func LatestRevision(q db.Querier, noteID int64) (int, error) {
+	var rev int
+	err := q.QueryRow("SELECT COALESCE(MAX(rev), 0) FROM note_revisions WHERE note_id = ?", noteID).Scan(&rev)
+	return rev, err
+}
+
+// PruneRevisions keeps only the newest keep revisions of every note.
+// keep < 0 disables pruning.
+func PruneRevisions(q db.Querier, keep int) error {
+	if keep < 0 {
+		return nil
+	}
+	_, err := q.Exec(`DELETE FROM note_revisions WHERE id IN (
+		SELECT id FROM (
+			SELECT id, ROW_NUMBER() OVER (PARTITION BY note_id ORDER BY rev DESC) AS age
+			FROM note_revisions
+		) WHERE age > ?
+	)`, keep)
+	return err
+}
+
+// Reencrypt rewrites the content of every encrypted note and revision with
+// convert, e.g. to move it to a new key. Rewriting the notes does not add
+// revisions: the old ciphertext would be unreadable once the key is gone.
+func Reencrypt(q db.Querier, convert func(string) (string, error)) error {
+	var last int64
+	if err := q.QueryRow("SELECT COALESCE(MAX(id), 0) FROM note_revisions").Scan(&last); err != nil {
+		return err
+	}
+
+	// query yields the row id, a label for errors and the content.
+	rewrite := func(table, query string) error {
+		rows, err := q.Query(query)
+		if err != nil {
+			return err
+		}
+		type row struct {
+			id      int64
+			label   string
+			content string
+		}
+		var pending []row
+		for rows.Next() {
+			var r row
+			if err := rows.Scan(&r.id, &r.label, &r.content); err != nil {
+				rows.Close()
+				return err
+			}
+			pending = append(pending, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, r := range pending {
+			content, err := convert(r.content)
+			if err != nil {
+				return errors.Wrapf(err, "note %s", r.label)
+			}
+			if _, err := q.Exec("UPDATE "+table+" SET content = ? WHERE id = ?", content, r.id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	err := rewrite("note_revisions", `SELECT r.id, n.uid || ' r' || r.rev, r.content
+		FROM note_revisions r JOIN notes n ON n.id = r.note_id WHERE r.encrypted = 1`)
+	if err != nil {
+		return err
+	}
+	if err := rewrite("notes", "SELECT id, uid, content FROM notes WHERE encrypted = 1"); err != nil {
+		return err
+	}
+
+	// Drop the snapshots the revision trigger took of the old ciphertext.
+	_, err = q.Exec("DELETE FROM note_revisions WHERE id > ?", last)
+	return err
+}
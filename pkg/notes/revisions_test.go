@@ -0,0 +1,117 @@
+package notes
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nathfavour/kylrix/cli/pkg/crypto"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestRevisions(t *testing.T) {
+	database := dbtest.Open(t)
+
+	n, err := Create(database, Note{Title: "Draft", Content: "v1"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for _, content := range []string{"v2", "v3", "v3", "v4"} {
+		n.Content = content
+		if err := Update(database, n); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+	if err := SetPinned(database, n.ID, true); err != nil {
+		t.Fatalf("SetPinned failed: %v", err)
+	}
+
+	revs, err := Revisions(database, n.ID)
+	if err != nil {
+		t.Fatalf("Revisions failed: %v", err)
+	}
+	// The no-op save and pinning must not create revisions.
+	if len(revs) != 3 {
+		t.Fatalf("expected 3 revisions, got %d", len(revs))
+	}
+	for i, want := range []string{"v1", "v2", "v3"} {
+		if revs[i].Rev != i+1 || revs[i].Content != want {
+			t.Errorf("revision %d = r%d %q, want r%d %q", i, revs[i].Rev, revs[i].Content, i+1, want)
+		}
+	}
+
+	if err := PruneRevisions(database, 2); err != nil {
+		t.Fatalf("PruneRevisions failed: %v", err)
+	}
+	revs, _ = Revisions(database, n.ID)
+	if len(revs) != 2 || revs[0].Rev != 2 {
+		t.Fatalf("expected r2 and r3 after pruning, got %+v", revs)
+	}
+	if _, err := GetRevision(database, n.ID, 1); err == nil {
+		t.Error("expected pruned r1 to be gone")
+	}
+
+	// Numbering continues after pruning.
+	n.Content = "v5"
+	if err := Update(database, n); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if latest, _ := LatestRevision(database, n.ID); latest != 4 {
+		t.Errorf("expected latest revision 4, got %d", latest)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	database := dbtest.Open(t)
+
+	oldKey, newKey := make([]byte, 32), make([]byte, 32)
+	newKey[0] = 1
+	encrypt := func(s string) string {
+		c, err := crypto.Encrypt(s, oldKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	n, err := Create(database, Note{Title: "Secret", Content: encrypt("v1"), Encrypted: true})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	n.Content = encrypt("v2")
+	if err := Update(database, n); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	err = Reencrypt(database, func(payload string) (string, error) {
+		plaintext, err := crypto.Decrypt(payload, oldKey)
+		if err != nil {
+			return "", err
+		}
+		defer plaintext.Destroy()
+		return crypto.Encrypt(json.RawMessage(plaintext.Bytes()), newKey)
+	})
+	if err != nil {
+		t.Fatalf("Reencrypt failed: %v", err)
+	}
+
+	revs, _ := Revisions(database, n.ID)
+	if len(revs) != 1 {
+		t.Fatalf("expected the one earlier revision, got %d", len(revs))
+	}
+	for _, content := range []string{revs[0].Content, mustGet(t, database, n.UID).Content} {
+		plaintext, err := crypto.Decrypt(content, newKey)
+		if err != nil {
+			t.Fatalf("Decrypt with the new key failed: %v", err)
+		}
+		plaintext.Destroy()
+	}
+}
+
+func mustGet(t *testing.T, q db.Querier, ref string) *Note {
+	t.Helper()
+	n, err := Get(q, ref)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	return n
+}
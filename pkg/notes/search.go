@@ -0,0 +1,238 @@
+package notes
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+)
+
+// Snippet highlight markers. Callers replace them with terminal styling.
+const (
+	MarkStart = "\x02"
+	MarkEnd   = "\x03"
+)
+
+// Query is a parsed search string: free-text terms plus field filters.
+type Query struct {
+	Terms  []string // full-text terms or "quoted phrases"; a trailing * means prefix
+	Titles []string // title:<term> filters
+	Tags   []string // tag:<name> filters, matching tagged notes or inline #name
+}
+
+// SearchResult is a note matched by Search together with its best snippet.
+type SearchResult struct {
+	Note
+	Snippet string
+	Rank    float64
+}
+
+// ParseQuery splits s into terms and title:/tag: filters. Double quotes group
+// words into a phrase, both bare and after a field prefix (title:"on call").
+func ParseQuery(s string) Query {
+	var q Query
+	for _, tok := range tokenize(s) {
+		field, value, hasField := strings.Cut(tok, ":")
+		value = strings.Trim(value, `"`)
+		switch {
+		case hasField && strings.EqualFold(field, "title") && value != "":
+			q.Titles = append(q.Titles, value)
+		case hasField && strings.EqualFold(field, "tag") && value != "":
+			q.Tags = append(q.Tags, strings.TrimPrefix(value, "#"))
+		default:
+			if term := strings.Trim(tok, `"`); term != "" {
+				q.Terms = append(q.Terms, term)
+			}
+		}
+	}
+	return q
+}
+
+func tokenize(s string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case !inQuote && (r == ' ' || r == '\t' || r == '\n'):
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// ftsString quotes a term as an FTS5 string so user input can't inject syntax.
+func ftsString(term string) string {
+	prefix := strings.HasSuffix(term, "*")
+	term = strings.TrimSuffix(term, "*")
+	quoted := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	if prefix {
+		quoted += "*"
+	}
+	return quoted
+}
+
+// Match renders the FTS5 MATCH expression, or "" when there is nothing to match.
+func (q Query) Match() string {
+	var parts []string
+	for _, t := range q.Terms {
+		parts = append(parts, ftsString(t))
+	}
+	for _, t := range q.Titles {
+		parts = append(parts, "title : "+ftsString(t))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// hasTag reports whether n is tagged with tag, either through the tags table
+// or with an inline #tag in its content.
+func hasTag(n *Note, tag string) bool {
+	for _, t := range n.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	re := regexp.MustCompile(`(?i)(^|\s)#` + regexp.QuoteMeta(tag) + `\b`)
+	return re.MatchString(n.Content)
+}
+
+func (q Query) matchesTags(n *Note) bool {
+	for _, tag := range q.Tags {
+		if !hasTag(n, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// Search runs q against the full-text index, best matches first (bm25, with
+// title hits weighted above content hits). limit <= 0 means no limit.
+func Search(dbq db.Querier, q Query, limit int) ([]SearchResult, error) {
+	var results []SearchResult
+	match := q.Match()
+
+	if match == "" {
+		// Only field filters that FTS can't express: scan notes directly.
+		all, err := List(dbq, Filter{})
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range all {
+			results = append(results, SearchResult{Note: n, Snippet: firstLine(n.Content)})
+		}
+	} else {
+		rows, err := dbq.Query(`SELECT `+columns+`,
+				snippet(notes_fts, -1, ?, ?, '…', 12),
+				bm25(notes_fts, 10.0, 1.0) AS rank
+			FROM notes_fts JOIN notes n ON n.id = notes_fts.rowid
+			WHERE notes_fts MATCH ?
+			ORDER BY rank`, MarkStart, MarkEnd, match)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r SearchResult
+			if err := scanNote(rows, &r.Note, &r.Snippet, &r.Rank); err != nil {
+				return nil, err
+			}
+			results = append(results, r)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	filtered := results[:0]
+	for _, r := range results {
+		if q.matchesTags(&r.Note) {
+			filtered = append(filtered, r)
+		}
+	}
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+	return filtered, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// snippetRadius is how much context MatchPlaintext keeps around a hit.
+const snippetRadius = 40
+
+// MatchPlaintext applies q to a note whose content was decrypted in memory,
+// since encrypted content never reaches the FTS index. Terms match as
+// case-insensitive substrings. It returns a snippet with the first hit marked.
+func MatchPlaintext(q Query, n *Note, content string) (string, bool) {
+	plain := *n
+	plain.Content = content
+	if !q.matchesTags(&plain) {
+		return "", false
+	}
+
+	lowerTitle := strings.ToLower(n.Title)
+	for _, t := range q.Titles {
+		if !strings.Contains(lowerTitle, strings.ToLower(strings.TrimSuffix(t, "*"))) {
+			return "", false
+		}
+	}
+
+	lowerContent := strings.ToLower(content)
+	snippet := ""
+	for _, t := range q.Terms {
+		term := strings.ToLower(strings.TrimSuffix(t, "*"))
+		at := strings.Index(lowerContent, term)
+		if at < 0 {
+			if !strings.Contains(lowerTitle, term) {
+				return "", false
+			}
+			continue
+		}
+		// Lower-casing can change byte lengths for some scripts; only mark
+		// the hit when offsets still line up with the original text.
+		if snippet == "" && len(lowerContent) == len(content) {
+			snippet = markAround(content, at, len(term))
+		}
+	}
+	if snippet == "" {
+		snippet = firstLine(content)
+	}
+	return snippet, true
+}
+
+// markAround cuts a snippet around content[at:at+size] and marks the hit.
+func markAround(content string, at, size int) string {
+	start := at - snippetRadius
+	prefix := "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	end := at + size + snippetRadius
+	suffix := "…"
+	if end >= len(content) {
+		end, suffix = len(content), ""
+	}
+	// Don't split multi-byte characters at the cut points.
+	for start > 0 && !utf8.RuneStart(content[start]) {
+		start--
+	}
+	for end < len(content) && !utf8.RuneStart(content[end]) {
+		end++
+	}
+	return prefix + content[start:at] + MarkStart + content[at:at+size] + MarkEnd + content[at+size:end] + suffix
+}
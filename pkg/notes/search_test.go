@@ -0,0 +1,71 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestParseQuery(t *testing.T) {
+	got := ParseQuery(`deploy "on call" title:runbook tag:#incident title:"post mortem" rollb*`)
+	want := Query{
+		Terms:  []string{"deploy", "on call", "rollb*"},
+		Titles: []string{"runbook", "post mortem"},
+		Tags:   []string{"incident"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ParseQuery mismatch:\n got %+v\nwant %+v", got, want)
+	}
+	if m := want.Match(); m != `"deploy" AND "on call" AND "rollb"* AND title : "runbook" AND title : "post mortem"` {
+		t.Errorf("unexpected MATCH expression: %s", m)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	database := dbtest.Open(t)
+
+	fixtures := [][2]string{
+		{"Database failover runbook", "Promote the replica, then repoint the app."},
+		{"Standup", "Talked about the database migration. #incident"},
+		{"Groceries", "Milk, eggs"},
+	}
+	for _, f := range fixtures {
+		if _, err := Create(database, Note{Title: f[0], Content: f[1]}); err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	results, err := Search(database, ParseQuery("database"), 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 2 || results[0].Title != "Database failover runbook" {
+		t.Fatalf("expected the title hit to rank first, got %+v", results)
+	}
+
+	results, err = Search(database, ParseQuery("database tag:incident"), 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Title != "Standup" {
+		t.Fatalf("tag filter failed: %+v", results)
+	}
+
+	// Updates must be reflected in the index through the triggers.
+	n, err := Get(database, "Groceries")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	n.Content = "Order a new database server"
+	if err := Update(database, n); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	results, err = Search(database, ParseQuery("title:groceries server"), 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected the updated note to match, got %+v", results)
+	}
+}
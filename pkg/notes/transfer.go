@@ -0,0 +1,260 @@
+package notes
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/markdown"
+	"github.com/pkg/errors"
+)
+
+// sqliteTime is the layout CURRENT_TIMESTAMP uses; imported timestamps are
+// stored the same way so ordering by created_at/updated_at stays correct.
+const sqliteTime = "2006-01-02 15:04:05"
+
+// Record is the portable form of a note used by export and import.
+type Record struct {
+	ID        string   `json:"id,omitempty"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Notebook  string   `json:"notebook,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Pinned    bool     `json:"pinned,omitempty"`
+	Encrypted bool     `json:"encrypted,omitempty"`
+	Created   string   `json:"created,omitempty"`
+	Updated   string   `json:"updated,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// NewRecord converts a note for export.
+func NewRecord(n *Note) Record {
+	return Record{
+		ID:        n.UID,
+		Title:     n.Title,
+		Content:   n.Content,
+		Notebook:  n.Notebook,
+		Tags:      n.Tags,
+		Pinned:    n.Pinned,
+		Encrypted: n.Encrypted,
+		Created:   n.CreatedAt,
+		Updated:   n.UpdatedAt,
+	}
+}
+
+// inlineTagRe matches Obsidian-style #tags; "# Heading" needs the space and is
+// not a tag.
+var inlineTagRe = regexp.MustCompile(`(?:^|\s)#([\p{L}_][\p{L}\p{N}_/-]*)`)
+
+// Markdown renders r as a Markdown file with YAML front matter.
+func (r Record) Markdown() string {
+	fm := markdown.NewFrontMatter()
+	if r.ID != "" {
+		fm.Set("id", r.ID)
+	}
+	fm.Set("title", r.Title)
+	if len(r.Tags) > 0 {
+		fm.SetList("tags", r.Tags)
+	}
+	if r.Notebook != "" {
+		fm.Set("notebook", r.Notebook)
+	}
+	if r.Pinned {
+		fm.Set("pinned", "true")
+	}
+	if r.Encrypted {
+		fm.Set("encrypted", "true")
+	}
+	fm.Set("created", r.Created)
+	fm.Set("updated", r.Updated)
+	return fm.String() + r.Content
+}
+
+// ParseMarkdown reads a Markdown file exported by Kylrix or written by another
+// tool such as Obsidian. name (the file name without extension) is the title
+// when the front matter has none. Files without a Kylrix id also take their
+// inline #tags as tags; [[wikilinks]] are kept as written.
+func ParseMarkdown(src, name string) Record {
+	fm, body := markdown.SplitFrontMatter(src)
+	r := Record{
+		ID:        fm.Get("id"),
+		Title:     fm.Get("title"),
+		Content:   body,
+		Notebook:  fm.Get("notebook"),
+		Pinned:    fm.Get("pinned") == "true",
+		Encrypted: fm.Get("encrypted") == "true",
+		Created:   fm.Get("created"),
+		Updated:   fm.Get("updated"),
+	}
+	if r.Title == "" {
+		r.Title = name
+	}
+
+	tags := append(fm.List("tags"), fm.List("tag")...)
+	if r.ID == "" && !r.Encrypted {
+		tags = append(tags, InlineTags(body)...)
+	}
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag != "" && !seen[strings.ToLower(tag)] {
+			seen[strings.ToLower(tag)] = true
+			r.Tags = append(r.Tags, tag)
+		}
+	}
+	return r
+}
+
+// InlineTags returns the #tags used in content outside fenced code blocks.
+func InlineTags(content string) []string {
+	var tags []string
+	inCode := false
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		for _, m := range inlineTagRe.FindAllStringSubmatch(line, -1) {
+			tags = append(tags, m[1])
+		}
+	}
+	return tags
+}
+
+// ImportResult says what Import did with a record.
+type ImportResult int
+
+const (
+	Unchanged ImportResult = iota
+	Created
+	Updated
+)
+
+// ParseTime accepts RFC 3339 and SQLite timestamps and returns the SQLite form
+// in UTC.
+func ParseTime(s string) (string, error) {
+	for _, layout := range []string{time.RFC3339Nano, sqliteTime, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t.UTC().Format(sqliteTime), nil
+		}
+	}
+	return "", errors.Errorf("invalid timestamp %q", s)
+}
+
+func sameTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Import creates or updates the note described by r. A record whose ID matches
+// an existing note updates it (keeping the old version as a revision); one that
+// is identical to what is stored is left alone. Timestamps, when present, are
+// carried over so an export/import round trip preserves them. The files of
+// r.Attachments must already be in the attachment store.
+func Import(q db.Querier, r Record) (*Note, ImportResult, error) {
+	var n *Note
+	result := Created
+
+	if r.ID != "" {
+		existing, err := getUID(q, r.ID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, 0, err
+		}
+		n = existing
+	}
+
+	if n == nil {
+		res, err := q.Exec("INSERT INTO notes (uid, title, content, encrypted) VALUES (NULLIF(?, ''), ?, ?, ?)",
+			r.ID, r.Title, r.Content, r.Encrypted)
+		if err != nil {
+			return nil, 0, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, 0, err
+		}
+		if n, err = GetByID(q, id); err != nil {
+			return nil, 0, err
+		}
+		if err := setLinks(q, n); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		if n.Title == r.Title && n.Content == r.Content && n.Encrypted == r.Encrypted &&
+			n.Notebook == r.Notebook && n.Pinned == r.Pinned && sameTags(n.Tags, r.Tags) {
+			return n, Unchanged, attachAll(q, n.ID, r.Attachments)
+		}
+		result = Updated
+		n.Title, n.Content, n.Encrypted = r.Title, r.Content, r.Encrypted
+		if err := Update(q, n); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := SetTags(q, n.ID, r.Tags...); err != nil {
+		return nil, 0, err
+	}
+	if err := SetNotebook(q, n.ID, r.Notebook); err != nil {
+		return nil, 0, err
+	}
+	if err := SetPinned(q, n.ID, r.Pinned); err != nil {
+		return nil, 0, err
+	}
+	if err := attachAll(q, n.ID, r.Attachments); err != nil {
+		return nil, 0, err
+	}
+	for col, value := range map[string]string{"created_at": r.Created, "updated_at": r.Updated} {
+		if value == "" {
+			continue
+		}
+		ts, err := ParseTime(value)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := q.Exec("UPDATE notes SET "+col+" = ? WHERE id = ?", ts, n.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	n, err := GetByID(q, n.ID)
+	return n, result, err
+}
+
+func attachAll(q db.Querier, noteID int64, list []Attachment) error {
+	for _, a := range list {
+		if err := Attach(q, noteID, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getUID(q db.Querier, uid string) (*Note, error) {
+	var id int64
+	err := q.QueryRow("SELECT id FROM notes WHERE uid = ?", uid).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetByID(q, id)
+}
@@ -0,0 +1,65 @@
+package notes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+)
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	src := dbtest.Open(t)
+	n, err := Create(src, Note{Title: `Q3: "plan" #1`, Content: "---\nnot front matter\n\n- [[Other note]]\n"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := AddTags(src, n.ID, "work", "planning"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetNotebook(src, n.ID, "Projects/2026"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetPinned(src, n.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.Exec("UPDATE notes SET created_at = '2026-01-02 03:04:05' WHERE id = ?", n.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = GetByID(src, n.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	exported := NewRecord(n)
+	parsed := ParseMarkdown(exported.Markdown(), "ignored")
+	if !reflect.DeepEqual(parsed, exported) {
+		t.Fatalf("Markdown round trip changed the record:\n got %+v\nwant %+v", parsed, exported)
+	}
+
+	dst := dbtest.Open(t)
+	imported, result, err := Import(dst, parsed)
+	if err != nil || result != Created {
+		t.Fatalf("Import = %v, %v; want Created", result, err)
+	}
+	imported.ID = n.ID
+	if !reflect.DeepEqual(imported, n) {
+		t.Fatalf("imported note differs:\n got %+v\nwant %+v", imported, n)
+	}
+
+	if _, result, err := Import(dst, parsed); err != nil || result != Unchanged {
+		t.Fatalf("re-import = %v, %v; want Unchanged", result, err)
+	}
+}
+
+func TestParseObsidianMarkdown(t *testing.T) {
+	src := "---\naliases: [x]\ntags:\n  - Inbox\n  - '#reading'\n---\nSee [[Book list]] #later and #reading.\n\n```sh\n#not-a-tag\n```\n"
+	r := ParseMarkdown(src, "Reading notes")
+	if r.Title != "Reading notes" || r.ID != "" {
+		t.Errorf("unexpected title/id: %q %q", r.Title, r.ID)
+	}
+	if want := []string{"Inbox", "reading", "later"}; !reflect.DeepEqual(r.Tags, want) {
+		t.Errorf("tags = %v, want %v", r.Tags, want)
+	}
+	if r.Content != "See [[Book list]] #later and #reading.\n\n```sh\n#not-a-tag\n```\n" {
+		t.Errorf("unexpected body %q", r.Content)
+	}
+}
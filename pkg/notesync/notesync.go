@@ -0,0 +1,526 @@
+// Package notesync synchronises local notes with the Kylrix Note backend.
+//
+// A sync pulls the remote changes made since the stored cursor, pushes local
+// deletions, then pushes every note changed since it was last synced. Updates
+// carry the note's ETag in If-Match; when the backend has a newer version the
+// two are merged three ways against the last synced text (pkg/diff). Edits
+// that cannot be merged are kept as a conflict copy of the note and the
+// remote version wins. Encrypted notes travel as ciphertext.
+//
+// No transaction is open while a request is out. A new note is created with an
+// Idempotency-Key stored beforehand, so a create whose reply never arrives is
+// retried on the next sync instead of repeated.
+package notesync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api"
+	"github.com/nathfavour/kylrix/cli/pkg/db"
+	"github.com/nathfavour/kylrix/cli/pkg/diff"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+	"github.com/pkg/errors"
+)
+
+// cursorKey is the sync_state key of the notes change-feed cursor.
+const cursorKey = "notes.cursor"
+
+// RemoteNote is a note as exchanged with the backend.
+type RemoteNote struct {
+	ID        string   `json:"id,omitempty"`
+	Title     string   `json:"title"`
+	Content   string   `json:"content"`
+	Notebook  string   `json:"notebook,omitempty"`
+	Tags      []string `json:"tags"`
+	Pinned    bool     `json:"pinned"`
+	Encrypted bool     `json:"encrypted"`
+	UpdatedAt string   `json:"updated_at,omitempty"`
+	Deleted   bool     `json:"deleted,omitempty"`
+	ETag      string   `json:"etag,omitempty"`
+}
+
+// changes is a page of the change feed.
+type changes struct {
+	Changes []RemoteNote `json:"changes"`
+	Cursor  string       `json:"cursor"`
+	HasMore bool         `json:"has_more"`
+}
+
+// Report summarises a sync.
+type Report struct {
+	Pulled    int
+	Pushed    int
+	Merged    int
+	Deleted   int
+	Conflicts []string // titles of the conflict copies created
+}
+
+// Syncer syncs the notes in DB through Client.
+type Syncer struct {
+	Client *api.Client
+	DB     *sql.DB
+	Now    func() time.Time
+}
+
+// New returns a Syncer using the current time for conflict copy names.
+func New(client *api.Client, database *sql.DB) *Syncer {
+	return &Syncer{Client: client, DB: database, Now: time.Now}
+}
+
+// local is a note with its sync bookkeeping.
+type local struct {
+	*notes.Note
+	RemoteID    sql.NullString
+	ETag        sql.NullString
+	LocalRev    int
+	SyncedRev   int
+	BaseTitle   sql.NullString
+	BaseContent sql.NullString
+	PushKey     sql.NullString
+}
+
+func (l *local) dirty() bool {
+	return !l.RemoteID.Valid || l.LocalRev > l.SyncedRev
+}
+
+func (l *local) remote() RemoteNote {
+	tags := l.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return RemoteNote{
+		ID:        l.RemoteID.String,
+		Title:     l.Title,
+		Content:   l.Content,
+		Notebook:  l.Notebook,
+		Tags:      tags,
+		Pinned:    l.Pinned,
+		Encrypted: l.Encrypted,
+	}
+}
+
+// loadLocal loads the first note matching cond, or nil.
+func loadLocal(q db.Querier, cond string, args ...interface{}) (*local, error) {
+	l := &local{}
+	var id int64
+	err := q.QueryRow("SELECT id, remote_id, etag, local_rev, synced_rev, base_title, base_content, push_key FROM notes WHERE "+cond, args...).
+		Scan(&id, &l.RemoteID, &l.ETag, &l.LocalRev, &l.SyncedRev, &l.BaseTitle, &l.BaseContent, &l.PushKey)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.Note, err = notes.GetByID(q, id); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// markSynced records that the note now matches the remote version r. rev is
+// the local revision that was sent, or -1 to take the current one.
+func markSynced(q db.Querier, id int64, r RemoteNote, rev int) error {
+	_, err := q.Exec(`UPDATE notes SET remote_id = ?, etag = ?, base_title = ?, base_content = ?, push_key = NULL,
+		synced_rev = CASE WHEN ? < 0 THEN local_rev ELSE ? END WHERE id = ?`,
+		r.ID, r.ETag, r.Title, r.Content, rev, rev, id)
+	return err
+}
+
+// apply writes the remote version r into n, or into a new note when n is nil.
+func apply(q db.Querier, n *notes.Note, r RemoteNote) (*notes.Note, error) {
+	var err error
+	if n == nil {
+		n, err = notes.Create(q, notes.Note{Title: r.Title, Content: r.Content, Encrypted: r.Encrypted})
+	} else {
+		n.Title, n.Content, n.Encrypted = r.Title, r.Content, r.Encrypted
+		err = notes.Update(q, n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := notes.SetTags(q, n.ID, r.Tags...); err != nil {
+		return nil, err
+	}
+	if err := notes.SetNotebook(q, n.ID, r.Notebook); err != nil {
+		return nil, err
+	}
+	if err := notes.SetPinned(q, n.ID, r.Pinned); err != nil {
+		return nil, err
+	}
+	return n, markSynced(q, n.ID, r, -1)
+}
+
+// Sync runs a full pull/push cycle.
+func (s *Syncer) Sync() (*Report, error) {
+	report := &Report{}
+	// Finish creates whose reply was lost first, so the change feed echoing
+	// them is recognised instead of pulled as more notes.
+	if err := s.pushNew(report, true); err != nil {
+		return report, errors.Wrap(err, "push")
+	}
+	if err := s.pull(report); err != nil {
+		return report, errors.Wrap(err, "pull")
+	}
+	if err := s.pushDeletes(report); err != nil {
+		return report, errors.Wrap(err, "push deletions")
+	}
+	if err := s.push(report); err != nil {
+		return report, errors.Wrap(err, "push")
+	}
+	return report, nil
+}
+
+// withTx runs fn in a transaction, so each remote change is applied whole.
+func (s *Syncer) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Syncer) pull(report *Report) error {
+	var cursor string
+	err := s.DB.QueryRow("SELECT value FROM sync_state WHERE key = ?", cursorKey).Scan(&cursor)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	for {
+		var page changes
+		if err := s.Client.Execute("GET", "/v1/notes/changes?since="+url.QueryEscape(cursor), nil, &page); err != nil {
+			return err
+		}
+		err := s.withTx(func(tx *sql.Tx) error {
+			for _, r := range page.Changes {
+				if err := s.pullOne(tx, r, report); err != nil {
+					return errors.Wrapf(err, "note %s", r.ID)
+				}
+			}
+			// The cursor only moves once the whole page is applied.
+			_, err := tx.Exec("INSERT OR REPLACE INTO sync_state (key, value) VALUES (?, ?)", cursorKey, page.Cursor)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		cursor = page.Cursor
+		if !page.HasMore {
+			return nil
+		}
+	}
+}
+
+func (s *Syncer) pullOne(tx *sql.Tx, r RemoteNote, report *Report) error {
+	var tombstoneETag string
+	err := tx.QueryRow("SELECT COALESCE(etag, '') FROM note_tombstones WHERE remote_id = ?", r.ID).Scan(&tombstoneETag)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return err
+	case r.Deleted || r.ETag != tombstoneETag:
+		// Deleted on both sides, or edited remotely after the local delete:
+		// the remote edit wins and the note comes back.
+		if _, err := tx.Exec("DELETE FROM note_tombstones WHERE remote_id = ?", r.ID); err != nil {
+			return err
+		}
+	default:
+		return nil // the local delete is pushed later
+	}
+
+	l, err := loadLocal(tx, "remote_id = ?", r.ID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case r.Deleted:
+		if l == nil {
+			return nil
+		}
+		// Detach first so the delete does not leave a tombstone behind.
+		if _, err := tx.Exec("UPDATE notes SET remote_id = NULL, etag = NULL WHERE id = ?", l.ID); err != nil {
+			return err
+		}
+		if l.dirty() {
+			return nil // local edits survive and are pushed as a new note
+		}
+		report.Deleted++
+		return notes.Delete(tx, l.ID)
+
+	case l == nil:
+		report.Pulled++
+		_, err := apply(tx, nil, r)
+		return err
+
+	case l.ETag.String == r.ETag:
+		return nil // our own push coming back
+
+	case !l.dirty():
+		report.Pulled++
+		_, err := apply(tx, l.Note, r)
+		return err
+	}
+
+	return s.merge(tx, l, r, report)
+}
+
+// merge reconciles a locally changed note with a newer remote version. On
+// success the note keeps local changes to push; otherwise the local version
+// becomes a conflict copy and the remote version is applied.
+func (s *Syncer) merge(tx *sql.Tx, l *local, r RemoteNote, report *Report) error {
+	title, titleOK := diff.Merge3Value(l.BaseTitle.String, l.Title, r.Title)
+	content, contentOK := diff.Merge3Value(l.BaseContent.String, l.Content, r.Content)
+	if !contentOK && !l.Encrypted && !r.Encrypted {
+		content, contentOK = diff.Merge3(l.BaseContent.String, l.Content, r.Content)
+	}
+
+	if titleOK && contentOK {
+		report.Merged++
+		// Ciphertext is never merged, so the flag follows the content chosen.
+		encrypted := false
+		switch content {
+		case l.Content:
+			encrypted = l.Encrypted
+		case r.Content:
+			encrypted = r.Encrypted
+		}
+		l.Title, l.Content, l.Encrypted = title, content, encrypted
+		if err := notes.Update(tx, l.Note); err != nil {
+			return err
+		}
+		// Rebase on the remote version; the merged note stays dirty and is
+		// pushed with the new ETag. Local tags, notebook and pin win.
+		_, err := tx.Exec("UPDATE notes SET etag = ?, base_title = ?, base_content = ? WHERE id = ?",
+			r.ETag, r.Title, r.Content, l.ID)
+		return err
+	}
+
+	copyTitle := fmt.Sprintf("%s (conflict %s)", l.Title, s.Now().Format("2006-01-02 15:04"))
+	conflict, err := notes.Create(tx, notes.Note{Title: copyTitle, Content: l.Content, Encrypted: l.Encrypted})
+	if err != nil {
+		return err
+	}
+	if err := notes.SetTags(tx, conflict.ID, l.Tags...); err != nil {
+		return err
+	}
+	if err := notes.SetNotebook(tx, conflict.ID, l.Notebook); err != nil {
+		return err
+	}
+	report.Conflicts = append(report.Conflicts, copyTitle)
+	_, err = apply(tx, l.Note, r)
+	return err
+}
+
+// send creates or updates the remote copy of l and returns the stored version.
+// It runs outside any transaction; callers record the result afterwards.
+func (s *Syncer) send(l *local) (RemoteNote, error) {
+	body := l.remote()
+	var resp *api.Response
+	var err error
+	if l.RemoteID.Valid {
+		resp, err = s.Client.Do("PUT", "/v1/notes/"+url.PathEscape(l.RemoteID.String), body,
+			http.Header{"If-Match": {l.ETag.String}})
+	}
+	if !l.RemoteID.Valid || api.IsStatus(err, http.StatusNotFound) {
+		var key string
+		if key, err = pushKey(s.DB, l); err != nil {
+			return RemoteNote{}, err
+		}
+		body.ID = ""
+		resp, err = s.Client.Do("POST", "/v1/notes", body, http.Header{"Idempotency-Key": {key}})
+	}
+	if err != nil {
+		return RemoteNote{}, err
+	}
+
+	var stored RemoteNote
+	if err := json.Unmarshal(resp.Body, &stored); err != nil {
+		return RemoteNote{}, errors.Wrap(err, "failed to unmarshal response")
+	}
+	if stored.ID == "" {
+		return RemoteNote{}, errors.New("the backend returned no note ID")
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		stored.ETag = etag
+	}
+	return stored, nil
+}
+
+// pushKey returns the idempotency key for creating l remotely, storing a new
+// one first if needed. It is committed before the POST goes out, so a retry
+// after a lost reply reuses it.
+func pushKey(q db.Querier, l *local) (string, error) {
+	if l.PushKey.Valid {
+		return l.PushKey.String, nil
+	}
+	_, err := q.Exec("UPDATE notes SET push_key = COALESCE(push_key, lower(hex(randomblob(16)))) WHERE id = ?", l.ID)
+	if err != nil {
+		return "", err
+	}
+	if err := q.QueryRow("SELECT push_key FROM notes WHERE id = ?", l.ID).Scan(&l.PushKey); err != nil {
+		return "", err
+	}
+	return l.PushKey.String, nil
+}
+
+func (s *Syncer) fetch(remoteID string) (RemoteNote, error) {
+	var r RemoteNote
+	err := s.Client.Execute("GET", "/v1/notes/"+url.PathEscape(remoteID), nil, &r)
+	return r, err
+}
+
+func (s *Syncer) push(report *Report) error {
+	rows, err := s.DB.Query("SELECT id FROM notes WHERE remote_id IS NULL OR local_rev > synced_rev ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := s.pushOne(id, report); err != nil {
+			return errors.Wrapf(err, "note %d", id)
+		}
+	}
+
+	// Conflict copies created while pushing are new notes; send them too.
+	return s.pushNew(report, false)
+}
+
+// pushOne sends a changed note. No transaction is held while a request is
+// out; the result is recorded once it is back.
+func (s *Syncer) pushOne(id int64, report *Report) error {
+	l, err := loadLocal(s.DB, "id = ?", id)
+	if err != nil || l == nil {
+		return err
+	}
+	// One retry: after a 412 the note is merged with the newer remote
+	// version and sent again with its ETag.
+	for attempt := 0; ; attempt++ {
+		stored, err := s.send(l)
+		if err == nil {
+			report.Pushed++
+			return markSynced(s.DB, l.ID, stored, l.LocalRev)
+		}
+		if !api.IsStatus(err, http.StatusPreconditionFailed) || attempt > 0 {
+			return err
+		}
+		r, err := s.fetch(l.RemoteID.String)
+		if err != nil {
+			return err
+		}
+		conflicts := len(report.Conflicts)
+		err = s.withTx(func(tx *sql.Tx) error {
+			// Reload: the note may have been edited while the request was out.
+			if l, err = loadLocal(tx, "id = ?", id); err != nil || l == nil {
+				return err
+			}
+			return s.merge(tx, l, r, report)
+		})
+		if err != nil || l == nil {
+			return err
+		}
+		if len(report.Conflicts) > conflicts {
+			return nil // remote version applied; the copy is pushed separately
+		}
+		if l, err = loadLocal(s.DB, "id = ?", id); err != nil || l == nil {
+			return err
+		}
+	}
+}
+
+// pushNew sends notes that have never been synced, e.g. conflict copies made
+// during push. With retries set it only sends those already tried once.
+func (s *Syncer) pushNew(report *Report, retries bool) error {
+	cond := "remote_id IS NULL"
+	if retries {
+		cond += " AND push_key IS NOT NULL"
+	}
+	for {
+		l, err := loadLocal(s.DB, cond+" ORDER BY id LIMIT 1")
+		if err != nil || l == nil {
+			return err
+		}
+		stored, err := s.send(l)
+		if err != nil {
+			return err
+		}
+		if err := markSynced(s.DB, l.ID, stored, l.LocalRev); err != nil {
+			return err
+		}
+		report.Pushed++
+	}
+}
+
+func (s *Syncer) pushDeletes(report *Report) error {
+	rows, err := s.DB.Query("SELECT remote_id, COALESCE(etag, '') FROM note_tombstones")
+	if err != nil {
+		return err
+	}
+	tombstones := make(map[string]string)
+	for rows.Next() {
+		var id, etag string
+		if err := rows.Scan(&id, &etag); err != nil {
+			rows.Close()
+			return err
+		}
+		tombstones[id] = etag
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, etag := range tombstones {
+		_, err := s.Client.Do("DELETE", "/v1/notes/"+url.PathEscape(id), nil, http.Header{"If-Match": {etag}})
+		var restore *RemoteNote
+		switch {
+		case err == nil || api.IsStatus(err, http.StatusNotFound):
+			report.Deleted++
+		case api.IsStatus(err, http.StatusPreconditionFailed):
+			// Changed remotely since we last saw it: keep the remote edit.
+			r, err := s.fetch(id)
+			if err != nil {
+				return errors.Wrapf(err, "note %s", id)
+			}
+			restore = &r
+		default:
+			return errors.Wrapf(err, "note %s", id)
+		}
+		err = s.withTx(func(tx *sql.Tx) error {
+			if restore != nil {
+				report.Pulled++
+				if _, err := apply(tx, nil, *restore); err != nil {
+					return err
+				}
+			}
+			_, err := tx.Exec("DELETE FROM note_tombstones WHERE remote_id = ?", id)
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(err, "note %s", id)
+		}
+	}
+	return nil
+}
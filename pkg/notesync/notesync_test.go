@@ -0,0 +1,282 @@
+package notesync
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/api/apitest"
+	"github.com/nathfavour/kylrix/cli/pkg/db/dbtest"
+	"github.com/nathfavour/kylrix/cli/pkg/notes"
+)
+
+// fakeBackend is an in-memory Kylrix Note backend.
+type fakeBackend struct {
+	*apitest.Backend[RemoteNote]
+	garble bool // reply to the next POST with a broken body
+	noID   bool // leave the ID out of POST replies
+}
+
+func newFakeBackend() *fakeBackend {
+	f := &fakeBackend{}
+	f.Backend = apitest.NewBackend[RemoteNote](f.serve)
+	return f
+}
+
+// store saves n as a new version. Callers hold the lock.
+func (f *fakeBackend) store(n *RemoteNote) {
+	n.ETag = fmt.Sprintf(`"v%d"`, f.Store(n.ID, n))
+}
+
+// edit changes a note as another client would.
+func (f *fakeBackend) edit(id string, fn func(n *RemoteNote)) {
+	f.Lock()
+	defer f.Unlock()
+	n := *f.Records[id]
+	fn(&n)
+	f.store(&n)
+}
+
+func (f *fakeBackend) serve(w http.ResponseWriter, r *http.Request) {
+	reply := func(status int, n *RemoteNote) {
+		w.Header().Set("ETag", n.ETag)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(n)
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/v1/notes/")
+	switch {
+	case r.URL.Path == "/v1/notes/changes":
+		var page changes
+		page.Changes, page.Cursor, page.HasMore = f.Changes(r.URL.Query().Get("since"))
+		json.NewEncoder(w).Encode(page)
+
+	case r.Method == "POST" && r.URL.Path == "/v1/notes":
+		var n RemoteNote
+		json.NewDecoder(r.Body).Decode(&n)
+		stored, created := f.Create(r.Header.Get("Idempotency-Key"), func(id string) *RemoteNote {
+			n.ID = id
+			return &n
+		})
+		if !created {
+			reply(http.StatusOK, stored)
+			return
+		}
+		stored.ETag = fmt.Sprintf(`"v%d"`, f.Version(stored.ID))
+		switch {
+		case f.garble:
+			f.garble = false
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, "{")
+		case f.noID:
+			reply(http.StatusCreated, &RemoteNote{Title: n.Title, Content: n.Content, ETag: n.ETag})
+		default:
+			reply(http.StatusCreated, stored)
+		}
+
+	default:
+		current, ok := f.Records[id]
+		if !ok || current.Deleted {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if r.Method != "GET" && r.Header.Get("If-Match") != current.ETag {
+			http.Error(w, "etag mismatch", http.StatusPreconditionFailed)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			reply(http.StatusOK, current)
+		case "PUT":
+			var n RemoteNote
+			json.NewDecoder(r.Body).Decode(&n)
+			n.ID = id
+			f.store(&n)
+			reply(http.StatusOK, &n)
+		case "DELETE":
+			f.store(&RemoteNote{ID: id, Deleted: true})
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+type device struct {
+	t  *testing.T
+	db *sql.DB
+	s  *Syncer
+}
+
+func newDevice(t *testing.T, server *httptest.Server) *device {
+	database := dbtest.Open(t)
+	s := New(apitest.Client(server), database)
+	s.Now = func() time.Time { return time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC) }
+	return &device{t: t, db: database, s: s}
+}
+
+func (d *device) sync() *Report {
+	d.t.Helper()
+	report, err := d.s.Sync()
+	if err != nil {
+		d.t.Fatalf("Sync failed: %v", err)
+	}
+	return report
+}
+
+func (d *device) note(ref string) *notes.Note {
+	d.t.Helper()
+	n, err := notes.Get(d.db, ref)
+	if err != nil {
+		d.t.Fatalf("Get(%q) failed: %v", ref, err)
+	}
+	return n
+}
+
+func (d *device) setContent(ref, content string) {
+	d.t.Helper()
+	n := d.note(ref)
+	n.Content = content
+	if err := notes.Update(d.db, n); err != nil {
+		d.t.Fatalf("Update failed: %v", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	backend := newFakeBackend()
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	a, b := newDevice(t, server), newDevice(t, server)
+
+	n, err := notes.Create(a.db, notes.Note{Title: "Plan", Content: "one\ntwo\nthree\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes.AddTags(a.db, n.ID, "work")
+	for i := 0; i < 3; i++ {
+		notes.Create(a.db, notes.Note{Title: fmt.Sprintf("Extra %d", i), Content: "x"})
+	}
+
+	if r := a.sync(); r.Pushed != 4 {
+		t.Fatalf("first sync pushed %d notes, want 4", r.Pushed)
+	}
+	if r := b.sync(); r.Pulled != 4 {
+		t.Fatalf("second device pulled %d notes, want 4", r.Pulled)
+	}
+	if got := b.note("Plan"); got.Content != "one\ntwo\nthree\n" || len(got.Tags) != 1 || got.Tags[0] != "work" {
+		t.Fatalf("pulled note mismatch: %+v", got)
+	}
+
+	// Incremental: once our own pushes have come back through the feed,
+	// nothing is sent and the feed resumes from the stored cursor.
+	if r := a.sync(); r.Pulled != 0 {
+		t.Fatalf("echoed pushes were pulled again: %+v", r)
+	}
+	backend.Requests = nil
+	if r := a.sync(); r.Pushed != 0 || r.Pulled != 0 {
+		t.Fatalf("idle sync did work: %+v", r)
+	}
+	if len(backend.Requests) != 1 || backend.Requests[0] != "GET /v1/notes/changes?since=4" {
+		t.Fatalf("idle sync requests: %v", backend.Requests)
+	}
+
+	// Edits to different lines merge.
+	a.setContent("Plan", "ONE\ntwo\nthree\n")
+	b.setContent("Plan", "one\ntwo\nTHREE\n")
+	a.sync()
+	if r := b.sync(); r.Merged != 1 || r.Pushed != 1 {
+		t.Fatalf("merge sync: %+v", r)
+	}
+	a.sync()
+	for _, d := range []*device{a, b} {
+		if got := d.note("Plan").Content; got != "ONE\ntwo\nTHREE\n" {
+			t.Fatalf("merged content = %q", got)
+		}
+	}
+
+	// Edits to the same line conflict: the remote version wins and the
+	// local one survives as a copy that syncs too.
+	a.setContent("Plan", "ONE\nfrom a\nTHREE\n")
+	b.setContent("Plan", "ONE\nfrom b\nTHREE\n")
+	a.sync()
+	r := b.sync()
+	if len(r.Conflicts) != 1 || r.Conflicts[0] != "Plan (conflict 2026-05-01 09:00)" {
+		t.Fatalf("conflict sync: %+v", r)
+	}
+	if got := b.note("Plan").Content; got != "ONE\nfrom a\nTHREE\n" {
+		t.Fatalf("conflicted note = %q, want the remote version", got)
+	}
+	a.sync()
+	if got := a.note("Plan (conflict 2026-05-01 09:00)").Content; got != "ONE\nfrom b\nTHREE\n" {
+		t.Fatalf("conflict copy = %q", got)
+	}
+
+	// A stale If-Match (another client saved between our pull and push) is
+	// merged and retried.
+	b.setContent("Extra 0", "x\nfrom b\n")
+	backend.After = func(r *http.Request) {
+		if r.URL.Path == "/v1/notes/changes" {
+			backend.edit("r2", func(n *RemoteNote) { n.Title = "Extra zero" })
+			backend.After = nil
+		}
+	}
+	if r := b.sync(); r.Merged != 1 {
+		t.Fatalf("412 sync: %+v", r)
+	}
+	if got := backend.Records["r2"]; got.Title != "Extra zero" || got.Content != "x\nfrom b\n" {
+		t.Fatalf("backend after 412 merge: %+v", got)
+	}
+
+	// Deletes propagate.
+	if err := notes.Delete(a.db, a.note("Plan").ID); err != nil {
+		t.Fatal(err)
+	}
+	if r := a.sync(); r.Deleted != 1 {
+		t.Fatalf("delete sync: %+v", r)
+	}
+	if r := b.sync(); r.Deleted != 1 {
+		t.Fatalf("delete pull: %+v", r)
+	}
+	if _, err := notes.Get(b.db, "Plan"); err == nil {
+		t.Fatal("deleted note still present on the second device")
+	}
+}
+
+func TestSyncLostCreate(t *testing.T) {
+	backend := newFakeBackend()
+	server := httptest.NewServer(backend)
+	defer server.Close()
+	a := newDevice(t, server)
+
+	notes.Create(a.db, notes.Note{Title: "Once", Content: "x"})
+	backend.garble = true
+	if _, err := a.s.Sync(); err == nil {
+		t.Fatal("sync succeeded with a broken reply")
+	}
+	if r := a.sync(); r.Pushed != 1 {
+		t.Fatalf("retry: %+v", r)
+	}
+	if len(backend.Records) != 1 {
+		t.Fatalf("backend has %d notes, want the one created", len(backend.Records))
+	}
+	var key sql.NullString
+	a.db.QueryRow("SELECT push_key FROM notes").Scan(&key)
+	if key.Valid {
+		t.Errorf("push key %q kept after the create was recorded", key.String)
+	}
+
+	// A reply without an ID is an error, not an empty remote ID.
+	n, _ := notes.Create(a.db, notes.Note{Title: "Anonymous", Content: "y"})
+	backend.noID = true
+	if _, err := a.s.Sync(); err == nil {
+		t.Fatal("sync accepted a created note without an ID")
+	}
+	var remoteID sql.NullString
+	a.db.QueryRow("SELECT remote_id FROM notes WHERE id = ?", n.ID).Scan(&remoteID)
+	if remoteID.Valid {
+		t.Errorf("remote ID = %q, want none", remoteID.String)
+	}
+}
@@ -0,0 +1,475 @@
+// Package recur implements the subset of RFC 5545 recurrence rules Flow uses:
+// FREQ (DAILY, WEEKLY, MONTHLY, YEARLY), INTERVAL, BYDAY for weekly and
+// monthly rules (with an ordinal for monthly ones, e.g. 2TU or -1FR),
+// BYMONTHDAY for monthly rules, COUNT and UNTIL.
+//
+// Rules can also be written the short way, as --every takes them: "daily",
+// "2w", "weekdays", "mon,wed,fri", "2nd tue", "last fri" or "15th".
+package recur
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/dateparse"
+	"github.com/pkg/errors"
+)
+
+// Frequencies.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// Day is a BYDAY entry: a weekday, with an ordinal week of the month for
+// monthly rules (1 = first, -1 = last, 0 = every).
+type Day struct {
+	N       int
+	Weekday time.Weekday
+}
+
+var dayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+func (d Day) String() string {
+	if d.N == 0 {
+		return dayCodes[d.Weekday]
+	}
+	return strconv.Itoa(d.N) + dayCodes[d.Weekday]
+}
+
+// Rule is a parsed recurrence rule.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []Day
+	ByMonthDay []int
+	Count      int       // occurrences left, including the current one; 0 = unlimited
+	Until      time.Time // last allowed occurrence; zero = none
+}
+
+var dayRe = regexp.MustCompile(`^([+-]?\d{1,2})?(SU|MO|TU|WE|TH|FR|SA)$`)
+
+// maxSteps bounds the search for the next occurrence. A rule can be valid and
+// still never match, e.g. the 30th of every 12th month starting in February.
+const maxSteps = 1000
+
+// ParseRRule reads an RFC 5545 RRULE value, with or without the "RRULE:"
+// prefix. UNTIL is read in loc unless it is in UTC form.
+func ParseRRule(s string, loc *time.Location) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	r := &Rule{Interval: 1}
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid rule part %q", part)
+		}
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("invalid INTERVAL %q", value)
+			}
+			r.Interval = n
+		case "BYDAY":
+			for _, v := range strings.Split(strings.ToUpper(value), ",") {
+				m := dayRe.FindStringSubmatch(v)
+				if m == nil {
+					return nil, errors.Errorf("invalid BYDAY %q", v)
+				}
+				d := Day{}
+				if m[1] != "" {
+					d.N, _ = strconv.Atoi(m[1])
+				}
+				for i, code := range dayCodes {
+					if code == m[2] {
+						d.Weekday = time.Weekday(i)
+					}
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(v)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, errors.Errorf("invalid BYMONTHDAY %q", v)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.Errorf("invalid COUNT %q", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value, loc)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "WKST":
+			// Weeks start on Monday here; other starts only matter for
+			// rules we do not support.
+		default:
+			return nil, errors.Errorf("unsupported rule part %s", key)
+		}
+	}
+	switch r.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	case "":
+		return nil, errors.New("rule has no FREQ")
+	default:
+		return nil, errors.Errorf("unsupported FREQ %s", r.Freq)
+	}
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// check rejects parts that do not apply to the rule's frequency rather than
+// ignoring them, which would make the rule recur more often than written.
+func (r *Rule) check() error {
+	switch r.Freq {
+	case Daily, Yearly:
+		if len(r.ByDay) > 0 {
+			return errors.Errorf("BYDAY is not supported with FREQ=%s", r.Freq)
+		}
+		if len(r.ByMonthDay) > 0 {
+			return errors.Errorf("BYMONTHDAY is not supported with FREQ=%s", r.Freq)
+		}
+	case Weekly:
+		if len(r.ByMonthDay) > 0 {
+			return errors.New("BYMONTHDAY is not supported with FREQ=WEEKLY")
+		}
+		for _, d := range r.ByDay {
+			if d.N != 0 {
+				return errors.Errorf("BYDAY %s: ordinals need FREQ=MONTHLY", d)
+			}
+		}
+	case Monthly:
+		for _, d := range r.ByDay {
+			if d.N < -5 || d.N > 5 {
+				return errors.Errorf("BYDAY %s: a month has at most 5 of each weekday", d)
+			}
+		}
+	}
+	return nil
+}
+
+func parseUntil(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t.In(loc), nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102", value, loc); err == nil {
+		// A date UNTIL includes that whole day.
+		return t.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, errors.Errorf("invalid UNTIL %q", value)
+}
+
+// String renders r as an RRULE value (without the "RRULE:" prefix).
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+var (
+	everyRe   = regexp.MustCompile(`^(\d+)\s*([a-z]+)$`)
+	nthDayRe  = regexp.MustCompile(`^(1st|2nd|3rd|4th|5th|first|second|third|fourth|fifth|last)\s+([a-z]+)$`)
+	monthDay  = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)$`)
+	ordinals  = map[string]int{"1st": 1, "2nd": 2, "3rd": 3, "4th": 4, "5th": 5, "first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "last": -1}
+	shortFreq = map[string]string{"daily": Daily, "weekly": Weekly, "monthly": Monthly, "yearly": Yearly, "annually": Yearly}
+)
+
+// Parse reads a rule in short form or as an RRULE.
+func Parse(s string, loc *time.Location) (*Rule, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(strings.ToUpper(s), "FREQ=") {
+		return ParseRRule(s, loc)
+	}
+	in := strings.ToLower(s)
+	in = strings.TrimPrefix(strings.TrimPrefix(in, "every "), "on the ")
+
+	if freq, ok := shortFreq[in]; ok {
+		return &Rule{Freq: freq, Interval: 1}, nil
+	}
+	switch in {
+	case "day":
+		return &Rule{Freq: Daily, Interval: 1}, nil
+	case "week":
+		return &Rule{Freq: Weekly, Interval: 1}, nil
+	case "month":
+		return &Rule{Freq: Monthly, Interval: 1}, nil
+	case "year":
+		return &Rule{Freq: Yearly, Interval: 1}, nil
+	case "weekday", "weekdays":
+		r := &Rule{Freq: Weekly, Interval: 1}
+		for wd := time.Monday; wd <= time.Friday; wd++ {
+			r.ByDay = append(r.ByDay, Day{Weekday: wd})
+		}
+		return r, nil
+	}
+
+	if m := everyRe.FindStringSubmatch(in); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if u, ok := dateparse.ParseUnit(m[2]); ok && n > 0 {
+			switch u {
+			case dateparse.Day:
+				return &Rule{Freq: Daily, Interval: n}, nil
+			case dateparse.Week:
+				return &Rule{Freq: Weekly, Interval: n}, nil
+			case dateparse.Month:
+				return &Rule{Freq: Monthly, Interval: n}, nil
+			case dateparse.Year:
+				return &Rule{Freq: Yearly, Interval: n}, nil
+			}
+		}
+	}
+	if m := nthDayRe.FindStringSubmatch(in); m != nil {
+		if wd, ok := dateparse.Weekday(m[2]); ok {
+			return &Rule{Freq: Monthly, Interval: 1, ByDay: []Day{{N: ordinals[m[1]], Weekday: wd}}}, nil
+		}
+	}
+	if m := monthDay.FindStringSubmatch(in); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		if n >= 1 && n <= 31 {
+			return &Rule{Freq: Monthly, Interval: 1, ByMonthDay: []int{n}}, nil
+		}
+	}
+
+	// A list of weekdays: "mon,wed,fri", "tue and thu".
+	fields := strings.FieldsFunc(in, func(r rune) bool { return r == ',' || r == ' ' || r == '/' })
+	r := &Rule{Freq: Weekly, Interval: 1}
+	for _, f := range fields {
+		if f == "and" {
+			continue
+		}
+		wd, ok := dateparse.Weekday(strings.TrimSuffix(f, "s"))
+		if !ok {
+			if wd, ok = dateparse.Weekday(f); !ok {
+				return nil, errors.Errorf("cannot read recurrence %q (try daily, 2w, weekdays, mon,wed,fri, \"2nd tue\", 15th or an RRULE)", s)
+			}
+		}
+		r.ByDay = append(r.ByDay, Day{Weekday: wd})
+	}
+	if len(r.ByDay) == 0 {
+		return nil, errors.Errorf("cannot read recurrence %q", s)
+	}
+	return r, nil
+}
+
+// Describe renders r for people: "every 2 weeks on Mon, Wed".
+func (r *Rule) Describe() string {
+	unit := map[string]string{Daily: "day", Weekly: "week", Monthly: "month", Yearly: "year"}[r.Freq]
+	s := "every " + unit
+	if r.Interval > 1 {
+		s = fmt.Sprintf("every %d %ss", r.Interval, unit)
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, d := range r.ByDay {
+			name := d.Weekday.String()[:3]
+			switch {
+			case d.N == -1:
+				name = "last " + name
+			case d.N > 0:
+				name = ordinal(d.N) + " " + name
+			}
+			days = append(days, name)
+		}
+		s += " on " + strings.Join(days, ", ")
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				days = append(days, "last day")
+			} else {
+				days = append(days, ordinal(d))
+			}
+		}
+		s += " on the " + strings.Join(days, ", ")
+	}
+	if r.Count > 0 {
+		s += fmt.Sprintf(", %d more times", r.Count)
+	}
+	if !r.Until.IsZero() {
+		s += " until " + r.Until.Format("2006-01-02")
+	}
+	return s
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch {
+	case n%100 >= 11 && n%100 <= 13:
+	case n%10 == 1:
+		suffix = "st"
+	case n%10 == 2:
+		suffix = "nd"
+	case n%10 == 3:
+		suffix = "rd"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// Next returns the first occurrence after from, keeping from's time of day.
+// ok is false when the rule has run out (COUNT reached or past UNTIL) or
+// never matches again. The
+// returned rule has its COUNT reduced by one, for the next instance.
+func (r *Rule) Next(from time.Time) (time.Time, *Rule, bool) {
+	if r.Count == 1 {
+		return time.Time{}, nil, false
+	}
+	next, ok := r.next(from)
+	if !ok || !r.Until.IsZero() && next.After(r.Until) {
+		return time.Time{}, nil, false
+	}
+	rest := *r
+	if rest.Count > 0 {
+		rest.Count--
+	}
+	return next, &rest, true
+}
+
+func (r *Rule) next(from time.Time) (time.Time, bool) {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	switch r.Freq {
+	case Daily:
+		return from.AddDate(0, 0, interval), true
+
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return from.AddDate(0, 0, 7*interval), true
+		}
+		// Later days in the same (Monday-based) week, then the first day of
+		// the week interval weeks on.
+		days := r.weekdays()
+		for _, wd := range days {
+			if isoDay(wd) > isoDay(from.Weekday()) {
+				return from.AddDate(0, 0, isoDay(wd)-isoDay(from.Weekday())), true
+			}
+		}
+		monday := from.AddDate(0, 0, -isoDay(from.Weekday()))
+		return monday.AddDate(0, 0, 7*interval+isoDay(days[0])), true
+
+	case Monthly:
+		if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 {
+			// Same day of the month, skipping months too short for it.
+			for step := 1; step <= maxSteps; step++ {
+				t := time.Date(from.Year(), from.Month()+time.Month(step*interval), from.Day(), from.Hour(), from.Minute(), from.Second(), 0, from.Location())
+				if t.Day() == from.Day() {
+					return t, true
+				}
+			}
+			return time.Time{}, false
+		}
+		for step := 0; step <= maxSteps; step++ {
+			first := time.Date(from.Year(), from.Month()+time.Month(step*interval), 1, from.Hour(), from.Minute(), from.Second(), 0, from.Location())
+			for _, t := range r.monthDays(first) {
+				if t.After(from) {
+					return t, true
+				}
+			}
+		}
+		return time.Time{}, false
+
+	default: // Yearly
+		for step := 1; step <= maxSteps; step++ {
+			t := time.Date(from.Year()+step*interval, from.Month(), from.Day(), from.Hour(), from.Minute(), from.Second(), 0, from.Location())
+			if t.Day() == from.Day() {
+				return t, true
+			}
+		}
+		return time.Time{}, false
+	}
+}
+
+// weekdays returns the BYDAY weekdays in Monday-first order.
+func (r *Rule) weekdays() []time.Weekday {
+	var days []time.Weekday
+	for _, d := range r.ByDay {
+		days = append(days, d.Weekday)
+	}
+	sort.Slice(days, func(i, j int) bool { return isoDay(days[i]) < isoDay(days[j]) })
+	return days
+}
+
+// isoDay numbers weekdays from Monday = 0.
+func isoDay(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+// monthDays returns the occurrences of a monthly rule in the month starting at
+// first, in order.
+func (r *Rule) monthDays(first time.Time) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	var days []int
+	for _, n := range r.ByMonthDay {
+		if n < 0 {
+			n = last + 1 + n
+		}
+		if n >= 1 && n <= last {
+			days = append(days, n)
+		}
+	}
+	for _, d := range r.ByDay {
+		offset := (int(d.Weekday) - int(first.Weekday()) + 7) % 7
+		var matches []int
+		for day := 1 + offset; day <= last; day += 7 {
+			matches = append(matches, day)
+		}
+		switch {
+		case d.N == 0:
+			days = append(days, matches...)
+		case d.N > 0 && d.N <= len(matches):
+			days = append(days, matches[d.N-1])
+		case d.N < 0 && -d.N <= len(matches):
+			days = append(days, matches[len(matches)+d.N])
+		}
+	}
+	sort.Ints(days)
+	out := make([]time.Time, len(days))
+	for i, day := range days {
+		out[i] = first.AddDate(0, 0, day-1)
+	}
+	return out
+}
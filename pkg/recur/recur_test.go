@@ -0,0 +1,133 @@
+package recur
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"daily", "FREQ=DAILY"},
+		{"every day", "FREQ=DAILY"},
+		{"weekly", "FREQ=WEEKLY"},
+		{"2w", "FREQ=WEEKLY;INTERVAL=2"},
+		{"every 3 days", "FREQ=DAILY;INTERVAL=3"},
+		{"2mo", "FREQ=MONTHLY;INTERVAL=2"},
+		{"yearly", "FREQ=YEARLY"},
+		{"weekdays", "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR"},
+		{"mon,wed,fri", "FREQ=WEEKLY;BYDAY=MO,WE,FR"},
+		{"tuesdays and thursdays", "FREQ=WEEKLY;BYDAY=TU,TH"},
+		{"2nd tue", "FREQ=MONTHLY;BYDAY=2TU"},
+		{"last friday", "FREQ=MONTHLY;BYDAY=-1FR"},
+		{"on the 15th", "FREQ=MONTHLY;BYMONTHDAY=15"},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3"},
+		{"FREQ=DAILY;UNTIL=20260401", "FREQ=DAILY;UNTIL=20260401T235959Z"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.in, time.UTC)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "sometimes", "FREQ=HOURLY", "FREQ=DAILY;INTERVAL=0", "BYDAY=MO", "FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;BYDAY=MO,TU", "FREQ=YEARLY;BYMONTHDAY=1", "FREQ=WEEKLY;BYDAY=2MO", "FREQ=MONTHLY;BYDAY=6MO"} {
+		if _, err := Parse(in, time.UTC); err == nil {
+			t.Errorf("Parse(%q) succeeded, want an error", in)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	day := func(s string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", s, time.Local)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		rule, from, want string
+	}{
+		{"daily", "2026-03-10 09:00", "2026-03-11 09:00"},
+		{"3d", "2026-03-30 09:00", "2026-04-02 09:00"},
+		{"2w", "2026-03-10 17:00", "2026-03-24 17:00"},
+		// Tuesday: Wednesday is later this week, Friday's successor is Monday.
+		{"mon,wed,fri", "2026-03-10 08:00", "2026-03-11 08:00"},
+		{"mon,wed,fri", "2026-03-13 08:00", "2026-03-16 08:00"},
+		{"weekdays", "2026-03-13 08:00", "2026-03-16 08:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2026-03-12 10:00", "2026-03-23 10:00"},
+		{"FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", "2026-03-09 10:00", "2026-03-12 10:00"},
+		{"monthly", "2026-01-31 09:00", "2026-03-31 09:00"},
+		{"2mo", "2026-03-10 09:00", "2026-05-10 09:00"},
+		{"2nd tue", "2026-03-10 09:00", "2026-04-14 09:00"},
+		{"2nd tue", "2026-03-02 09:00", "2026-03-10 09:00"},
+		{"last fri", "2026-03-10 09:00", "2026-03-27 09:00"},
+		{"last fri", "2026-03-27 09:00", "2026-04-24 09:00"},
+		{"FREQ=MONTHLY;BYDAY=5MO", "2026-03-31 09:00", "2026-06-29 09:00"},
+		{"15th", "2026-03-15 09:00", "2026-04-15 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-31 09:00", "2026-02-28 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "2026-03-31 09:00", "2026-05-31 09:00"},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "2026-03-01 09:00", "2026-03-15 09:00"},
+		{"yearly", "2024-02-29 09:00", "2028-02-29 09:00"},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.rule, time.Local)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.rule, err)
+		}
+		got, _, ok := r.Next(day(tt.from))
+		if !ok || !got.Equal(day(tt.want)) {
+			t.Errorf("%s after %s = %s, %v; want %s", tt.rule, tt.from, got.Format("2006-01-02 15:04 Mon"), ok, tt.want)
+		}
+	}
+}
+
+func TestNextLimits(t *testing.T) {
+	from := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	r, _ := Parse("FREQ=DAILY;COUNT=2", time.UTC)
+	_, rest, ok := r.Next(from)
+	if !ok || rest.Count != 1 {
+		t.Fatalf("first Next = %v, %+v", ok, rest)
+	}
+	if _, _, ok := rest.Next(from); ok {
+		t.Error("COUNT=1 rule produced another occurrence")
+	}
+
+	r, _ = Parse("FREQ=WEEKLY;UNTIL=20260317", time.UTC)
+	if _, _, ok := r.Next(from); !ok {
+		t.Error("occurrence on the UNTIL day was dropped")
+	}
+	if _, _, ok := r.Next(from.AddDate(0, 0, 1)); ok {
+		t.Error("occurrence after UNTIL was produced")
+	}
+
+	// Every 12th month from February never reaches a 30th.
+	r, _ = Parse("FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30", time.UTC)
+	if _, _, ok := r.Next(time.Date(2026, 2, 10, 9, 0, 0, 0, time.UTC)); ok {
+		t.Error("rule that never matches produced an occurrence")
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	for in, want := range map[string]string{
+		"daily":                      "every day",
+		"2w":                         "every 2 weeks",
+		"mon,fri":                    "every week on Mon, Fri",
+		"last fri":                   "every month on last Fri",
+		"FREQ=MONTHLY;BYMONTHDAY=22": "every month on the 22nd",
+	} {
+		r, _ := Parse(in, time.UTC)
+		if got := r.Describe(); got != want {
+			t.Errorf("Describe(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
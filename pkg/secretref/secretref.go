@@ -0,0 +1,88 @@
+package secretref
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Scheme prefixes every secret reference, e.g. vault://github-token or
+// vault://db-prod#password.
+const Scheme = "vault://"
+
+// refPattern matches a reference up to the first whitespace or delimiter that
+// commonly surrounds a link in Markdown.
+var refPattern = regexp.MustCompile("vault://([^\\s#()<>\\[\\]\"'`]+)(?:#([A-Za-z0-9_.-]+))?")
+
+// Ref is a single secret reference found in text.
+type Ref struct {
+	Raw   string // exact text that was matched
+	Name  string // vault_secrets name
+	Field string // optional field inside a structured secret
+}
+
+func (r Ref) String() string {
+	if r.Field == "" {
+		return Scheme + r.Name
+	}
+	return Scheme + r.Name + "#" + r.Field
+}
+
+// parse turns a regexp match into a Ref, dropping sentence punctuation that
+// the pattern swallowed ("see vault://api-key.").
+func parse(match string, sub []string) Ref {
+	name, field := sub[1], sub[2]
+	last := &name
+	if field != "" {
+		last = &field
+	}
+	trimmed := strings.TrimRight(*last, ".,;:!?")
+	raw := strings.TrimSuffix(match, (*last)[len(trimmed):])
+	*last = trimmed
+	return Ref{Raw: strings.TrimSuffix(raw, "#"), Name: name, Field: field}
+}
+
+// Find returns every reference in text, in order of appearance.
+func Find(text string) []Ref {
+	var refs []Ref
+	for _, sub := range refPattern.FindAllStringSubmatch(text, -1) {
+		if ref := parse(sub[0], sub); ref.Name != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// References reports whether text contains a reference to the named secret.
+func References(text, name string) bool {
+	for _, ref := range Find(text) {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve replaces every reference in text with the value returned by lookup.
+// The first lookup error aborts the substitution.
+func Resolve(text string, lookup func(Ref) (string, error)) (string, error) {
+	var firstErr error
+	resolved := refPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if firstErr != nil {
+			return match
+		}
+		ref := parse(match, refPattern.FindStringSubmatch(match))
+		if ref.Name == "" {
+			return match
+		}
+		value, err := lookup(ref)
+		if err != nil {
+			firstErr = err
+			return match
+		}
+		return value + match[len(ref.Raw):]
+	})
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return resolved, nil
+}
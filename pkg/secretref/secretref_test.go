@@ -0,0 +1,53 @@
+package secretref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	text := "Deploy with vault://deploy-key, then log in using vault://db-prod#password.\n" +
+		"Registry: [creds](vault://docker:https://ghcr.io#username)"
+
+	refs := Find(text)
+	want := []Ref{
+		{Raw: "vault://deploy-key", Name: "deploy-key"},
+		{Raw: "vault://db-prod#password", Name: "db-prod", Field: "password"},
+		{Raw: "vault://docker:https://ghcr.io#username", Name: "docker:https://ghcr.io", Field: "username"},
+	}
+	if len(refs) != len(want) {
+		t.Fatalf("expected %d refs, got %d: %+v", len(want), len(refs), refs)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("ref %d: expected %+v, got %+v", i, want[i], refs[i])
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	values := map[string]string{"api-key": "s3cr3t", "db#user": "admin"}
+	lookup := func(r Ref) (string, error) {
+		key := r.Name
+		if r.Field != "" {
+			key += "#" + r.Field
+		}
+		v, ok := values[key]
+		if !ok {
+			return "", errors.New("missing " + key)
+		}
+		return v, nil
+	}
+
+	got, err := Resolve("token: vault://api-key. user: vault://db#user", lookup)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if want := "token: s3cr3t. user: admin"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if _, err := Resolve("vault://unknown", lookup); err == nil {
+		t.Error("expected an error for an unknown secret")
+	}
+}
@@ -0,0 +1,201 @@
+// Package templates renders note templates: Markdown files using text/template
+// syntax, with optional front matter giving the new note's title, notebook and
+// tags.
+//
+//	---
+//	title: 'Standup {{ date }}'
+//	notebook: Standups
+//	tags: [standup]
+//	---
+//	## Yesterday
+//	{{ prompt "What did you do yesterday?" }}
+//
+// Available functions: date, time, yesterday, tomorrow and weekday (date-like
+// ones take an optional Go layout), user, cwd, title, and prompt.
+package templates
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nathfavour/kylrix/cli/pkg/markdown"
+	"github.com/pkg/errors"
+)
+
+// DateLayout is the default layout of the date functions.
+const DateLayout = "2006-01-02"
+
+// Builtin templates are written to the templates folder the first time they
+// are used, so they can be customised there.
+var Builtin = map[string]string{
+	"daily": `---
+title: '{{ date }}'
+notebook: Journal
+tags: [daily]
+---
+# {{ date "Monday, January 2, 2006" }}
+
+## Notes
+
+## Tasks
+- [ ]
+`,
+	"standup": `---
+title: 'Standup {{ date }}'
+notebook: Standups
+tags: [standup]
+---
+# Standup · {{ date "Mon Jan 2" }} · {{ user }}
+
+## Yesterday
+{{ prompt "What did you do yesterday?" }}
+
+## Today
+{{ prompt "What will you do today?" }}
+
+## Blockers
+{{ prompt "Any blockers?" }}
+`,
+}
+
+// Template is a parsed, not yet rendered, template.
+type Template struct {
+	Name     string
+	Title    string
+	Notebook string
+	Tags     []string
+	Body     string
+}
+
+// Parse splits a template source into its front matter fields and body.
+func Parse(name, src string) *Template {
+	fm, body := markdown.SplitFrontMatter(src)
+	return &Template{
+		Name:     name,
+		Title:    fm.Get("title"),
+		Notebook: fm.Get("notebook"),
+		Tags:     fm.List("tags"),
+		Body:     body,
+	}
+}
+
+// Load reads dir/<name>.md, seeding it from Builtin when it does not exist.
+func Load(dir, name string) (*Template, error) {
+	path := filepath.Join(dir, name+".md")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		src, ok := Builtin[name]
+		if !ok {
+			names, _ := List(dir)
+			return nil, errors.Errorf("no template %q in %s (available: %s)", name, dir, strings.Join(names, ", "))
+		}
+		if err := os.WriteFile(path, []byte(src), 0600); err != nil {
+			return nil, err
+		}
+		data = []byte(src)
+	} else if err != nil {
+		return nil, err
+	}
+	return Parse(name, string(data)), nil
+}
+
+// List returns the names of the templates in dir together with the builtins.
+func List(dir string) ([]string, error) {
+	seen := make(map[string]bool)
+	for name := range Builtin {
+		seen[name] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".md" {
+			seen[strings.TrimSuffix(e.Name(), ".md")] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Context supplies the values templates can use. Answers to prompt fields are
+// remembered, so a question repeated in a template is asked once.
+type Context struct {
+	Now    time.Time
+	User   string
+	Cwd    string
+	Title  string
+	Prompt func(question string) (string, error)
+
+	answers map[string]string
+}
+
+// NewContext returns a context for the current time, user and directory.
+func NewContext(prompt func(question string) (string, error)) *Context {
+	c := &Context{Now: time.Now(), Prompt: prompt, User: os.Getenv("USER")}
+	if u, err := user.Current(); err == nil {
+		c.User = u.Username
+	}
+	c.Cwd, _ = os.Getwd()
+	return c
+}
+
+func layout(args []string) string {
+	if len(args) > 0 && args[0] != "" {
+		return args[0]
+	}
+	return DateLayout
+}
+
+func (c *Context) funcs() template.FuncMap {
+	return template.FuncMap{
+		"date":      func(l ...string) string { return c.Now.Format(layout(l)) },
+		"time":      func() string { return c.Now.Format("15:04") },
+		"yesterday": func(l ...string) string { return c.Now.AddDate(0, 0, -1).Format(layout(l)) },
+		"tomorrow":  func(l ...string) string { return c.Now.AddDate(0, 0, 1).Format(layout(l)) },
+		"weekday":   func() string { return c.Now.Weekday().String() },
+		"user":      func() string { return c.User },
+		"cwd":       func() string { return c.Cwd },
+		"title":     func() string { return c.Title },
+		"prompt": func(question string) (string, error) {
+			if answer, ok := c.answers[question]; ok {
+				return answer, nil
+			}
+			if c.Prompt == nil {
+				return "", errors.Errorf("template asks %q but prompting is not available", question)
+			}
+			answer, err := c.Prompt(question)
+			if err != nil {
+				return "", err
+			}
+			if c.answers == nil {
+				c.answers = make(map[string]string)
+			}
+			c.answers[question] = answer
+			return answer, nil
+		},
+	}
+}
+
+// Render executes text as a template named name.
+func (c *Context) Render(name, text string) (string, error) {
+	t, err := template.New(name).Funcs(c.funcs()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, nil); err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	return b.String(), nil
+}
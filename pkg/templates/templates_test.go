@@ -0,0 +1,65 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	asked := 0
+	ctx := &Context{
+		Now:   time.Date(2026, 3, 9, 8, 30, 0, 0, time.UTC),
+		User:  "sam",
+		Cwd:   "/src/app",
+		Title: "Standup",
+		Prompt: func(question string) (string, error) {
+			asked++
+			return "answer to " + question, nil
+		},
+	}
+	got, err := ctx.Render("t", `{{ title }} {{ date }} {{ date "Jan 2" }} {{ yesterday }} {{ weekday }} {{ time }} {{ user }}@{{ cwd }}
+{{ prompt "Q?" }} / {{ prompt "Q?" }}`)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "Standup 2026-03-09 Mar 9 2026-03-08 Monday 08:30 sam@/src/app\nanswer to Q? / answer to Q?"
+	if got != want {
+		t.Errorf("Render =\n%q\nwant\n%q", got, want)
+	}
+	if asked != 1 {
+		t.Errorf("expected the repeated question to be asked once, asked %d times", asked)
+	}
+
+	if _, err := (&Context{}).Render("t", `{{ prompt "x" }}`); err == nil {
+		t.Error("expected an error when prompting is unavailable")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	tmpl, err := Load(dir, "standup")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if tmpl.Title != `Standup {{ date }}` || tmpl.Notebook != "Standups" || len(tmpl.Tags) != 1 {
+		t.Errorf("unexpected front matter: %+v", tmpl)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "standup.md")); err != nil {
+		t.Errorf("builtin template was not written out: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "retro.md"), []byte("# Retro\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if tmpl, err := Load(dir, "retro"); err != nil || tmpl.Body != "# Retro\n" || tmpl.Title != "" {
+		t.Errorf("Load(retro) = %+v, %v", tmpl, err)
+	}
+	if _, err := Load(dir, "missing"); err == nil {
+		t.Error("expected an error for an unknown template")
+	}
+	if names, _ := List(dir); len(names) != 3 {
+		t.Errorf("List = %v, want daily, retro, standup", names)
+	}
+}
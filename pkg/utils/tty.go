@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"io"
+	"os"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+)
+
+// ErrNoTTY is returned by AttachTTY when the process has no controlling terminal.
+var ErrNoTTY = errors.New("no interactive terminal available")
+
+// openTTY opens the controlling terminal; tests replace it.
+var openTTY = func() (io.ReadWriteCloser, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+// AttachTTY points prompts and status messages at the controlling terminal
+// instead of stdin/stdout. Protocol helpers (git, docker) use it so that
+// unlocking the vault never corrupts the data exchanged over the pipes.
+// The returned function restores the previous streams.
+func AttachTTY() (func(), error) {
+	tty, err := openTTY()
+	if err != nil {
+		return nil, ErrNoTTY
+	}
+
+	prevIn, prevOut, prevColor := promptIn, promptOut, color.Output
+	promptIn, promptOut, color.Output = tty, tty, tty
+
+	return func() {
+		promptIn, promptOut, color.Output = prevIn, prevOut, prevColor
+		tty.Close()
+	}, nil
+}
+
+// StdoutIsTerminal reports whether stdout is an interactive terminal rather
+// than a pipe or file.
+func StdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// TerminalWidth returns the width of the terminal on stdout, or 80 when it
+// cannot be determined.
+func TerminalWidth() int {
+	w, _ := TerminalSize()
+	return w
+}
+
+// MakeRaw puts the terminal on stdin into raw mode, so keys arrive as they are
+// pressed and are not echoed. The returned function restores the terminal.
+func MakeRaw() (func(), error) {
+	fd := int(os.Stdin.Fd())
+	state, err := readline.MakeRaw(fd)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot switch the terminal to raw mode")
+	}
+	return func() { readline.Restore(fd, state) }, nil
+}
+
+// TerminalSize returns the width and height of the terminal on stdout, or
+// 80x24 when they cannot be determined.
+func TerminalSize() (int, int) {
+	w, h, err := readline.GetSize(int(os.Stdout.Fd()))
+	if err != nil || w <= 0 || h <= 0 {
+		return 80, 24
+	}
+	return w, h
+}
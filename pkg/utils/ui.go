@@ -1,13 +1,46 @@
 package utils
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/manifoldco/promptui"
 	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+	"github.com/pkg/errors"
 )
 
+// promptIn and promptOut override the terminal used by prompts. They stay nil
+// (meaning os.Stdin/os.Stdout) unless AttachTTY redirects them.
+var (
+	promptIn  io.ReadCloser
+	promptOut io.WriteCloser
+)
+
+// pipedInput hands out piped stdin one line per prompt. promptui buffers the
+// whole pipe on its first prompt, which would leave later prompts at EOF.
+var pipedInput *bufio.Reader
+
+// readPipedAnswer reports whether stdin is piped and, if so, reads the answer
+// to a Prompt from it. PasswordPrompt never does.
+func readPipedAnswer() (string, bool, error) {
+	if promptIn != nil || !StdinIsPiped() {
+		return "", false, nil
+	}
+	if pipedInput == nil {
+		pipedInput = bufio.NewReader(os.Stdin)
+	}
+	line, err := pipedInput.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), true, err
+}
+
 func Success(msg string) {
 	color.Green("✓ %s", msg)
 }
@@ -28,10 +61,38 @@ func Banner(msg string) {
 	color.Cyan("=== %s ===", msg)
 }
 
+// Emphasize styles s for highlighting (e.g. search matches).
+func Emphasize(s string) string {
+	return color.New(color.FgYellow, color.Bold).Sprint(s)
+}
+
+// Alert styles s as needing attention (e.g. overdue dates).
+func Alert(s string) string {
+	return color.New(color.FgRed, color.Bold).Sprint(s)
+}
+
+// PrintDiff prints a unified diff with added lines in green and removed lines in red.
+func PrintDiff(unified string) {
+	for _, line := range strings.Split(strings.TrimSuffix(unified, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			color.New(color.Bold).Println(line)
+		case strings.HasPrefix(line, "@@"):
+			color.Cyan(line)
+		case strings.HasPrefix(line, "+"):
+			color.Green(line)
+		case strings.HasPrefix(line, "-"):
+			color.Red(line)
+		default:
+			fmt.Fprintln(color.Output, line)
+		}
+	}
+}
+
 func Table(header []string, data [][]string) {
-	table := tablewriter.NewWriter(os.Stdout)
-	// Some versions use AppendBulk, some use AddRow
-	// We'll try the most basic approach
+	// Leading spaces are kept so indented cells, like task trees, line up.
+	table := tablewriter.NewTable(os.Stdout, tablewriter.WithTrimSpace(tw.Off))
+	table.Header(header)
 	for _, row := range data {
 		table.Append(row)
 	}
@@ -39,24 +100,55 @@ func Table(header []string, data [][]string) {
 }
 
 func Prompt(label string) (string, error) {
+	if answer, piped, err := readPipedAnswer(); piped {
+		return answer, err
+	}
 	prompt := promptui.Prompt{
-		Label: label,
+		Label:  label,
+		Stdin:  promptIn,
+		Stdout: promptOut,
 	}
 	return prompt.Run()
 }
 
+// PasswordPrompt asks for a secret without echoing it. Secrets are never read
+// from piped stdin: with stdin piped the prompt moves to the controlling
+// terminal, and fails without one.
 func PasswordPrompt(label string) (string, error) {
+	if promptIn == nil && StdinIsPiped() {
+		restore, err := AttachTTY()
+		if err != nil {
+			return "", errors.Wrapf(err, "cannot ask for %s", label)
+		}
+		defer restore()
+	}
 	prompt := promptui.Prompt{
-		Label: label,
-		Mask:  '*',
+		Label:  label,
+		Mask:   '*',
+		Stdin:  promptIn,
+		Stdout: promptOut,
 	}
 	return prompt.Run()
 }
 
+// Confirm asks a yes/no question and reports whether the answer was yes.
+func Confirm(label string) bool {
+	prompt := promptui.Prompt{
+		Label:     label,
+		IsConfirm: true,
+		Stdin:     promptIn,
+		Stdout:    promptOut,
+	}
+	_, err := prompt.Run()
+	return err == nil
+}
+
 func Select(label string, items []string) (int, string, error) {
 	prompt := promptui.Select{
-		Label: label,
-		Items: items,
+		Label:  label,
+		Items:  items,
+		Stdin:  promptIn,
+		Stdout: promptOut,
 	}
 	return prompt.Run()
 }
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// pipeStdin replaces os.Stdin with a pipe holding input for the test.
+func pipeStdin(t *testing.T, input string) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, input); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+		pipedInput = nil
+	})
+}
+
+// fakeTTY stands in for the controlling terminal: it reads input and discards
+// what prompts write.
+type fakeTTY struct{ io.Reader }
+
+func (fakeTTY) Write(p []byte) (int, error) { return len(p), nil }
+func (fakeTTY) Close() error                { return nil }
+
+// setTTY makes AttachTTY use a terminal that types input, or none if input is
+// empty.
+func setTTY(t *testing.T, input string) {
+	prev := openTTY
+	openTTY = func() (io.ReadWriteCloser, error) {
+		if input == "" {
+			return nil, os.ErrNotExist
+		}
+		return fakeTTY{strings.NewReader(input)}, nil
+	}
+	t.Cleanup(func() { openTTY = prev })
+}
+
+func TestPasswordPromptIgnoresPipe(t *testing.T) {
+	pipeStdin(t, "not a password\n")
+	setTTY(t, "")
+
+	if _, err := PasswordPrompt("Vault Master Password"); !errors.Is(err, ErrNoTTY) {
+		t.Fatalf("expected ErrNoTTY, got %v", err)
+	}
+	if answer, err := Prompt("Name"); err != nil || answer != "not a password" {
+		t.Errorf("Prompt = %q, %v; the pipe should be left for it", answer, err)
+	}
+}
+
+func TestPasswordPromptAfterPipedContent(t *testing.T) {
+	pipeStdin(t, "a\nb\n")
+	setTTY(t, "s3cret\n")
+
+	// As 'note create --encrypt' does: the content drains stdin, then the
+	// vault is unlocked.
+	if data, err := io.ReadAll(os.Stdin); err != nil || string(data) != "a\nb\n" {
+		t.Fatalf("ReadAll = %q, %v", data, err)
+	}
+	if password, err := PasswordPrompt("Vault Master Password"); err != nil || password != "s3cret" {
+		t.Errorf("PasswordPrompt = %q, %v", password, err)
+	}
+}